@@ -0,0 +1,92 @@
+package config
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+var timezone struct {
+	once     sync.Once
+	location *time.Location
+}
+
+// GetTimezone 获取计算每日用量窗口所用的时区，默认使用服务器本地时区
+func GetTimezone() *time.Location {
+	timezone.once.Do(func() {
+		timezone.location = time.Local
+		if name := getEnv("APP_TIMEZONE", ""); name != "" {
+			if loc, err := time.LoadLocation(name); err != nil {
+				log.Printf("[CONFIG] invalid APP_TIMEZONE %q: %v", name, err)
+			} else {
+				timezone.location = loc
+			}
+		}
+	})
+	return timezone.location
+}
+
+// GetDefaultPlan 获取套餐过期后回退的默认套餐
+func GetDefaultPlan() string {
+	return getEnv("DEFAULT_PLAN", "basic")
+}
+
+// GetCurrency 获取默认结算币种，套餐未单独设置币种时使用
+func GetCurrency() string {
+	return strings.ToUpper(getEnv("PAY_CURRENCY", "CNY"))
+}
+
+// GetExpireGrace 获取套餐过期后的宽限期，宽限期内仍按原套餐计费
+func GetExpireGrace() time.Duration {
+	grace, err := time.ParseDuration(getEnv("PLAN_EXPIRE_GRACE", "0"))
+	if err != nil || grace < 0 {
+		return 0
+	}
+	return grace
+}
+
+// GetExpireCheckInterval 获取过期套餐定时降级的检查周期，0 表示关闭定时检查
+func GetExpireCheckInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("PLAN_EXPIRE_INTERVAL", "10m"))
+	if err != nil || interval < 0 {
+		return 0
+	}
+	return interval
+}
+
+// GetUsageFlushInterval 获取用量计数回写用户表的周期
+func GetUsageFlushInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("USAGE_FLUSH_INTERVAL", "1m"))
+	if err != nil || interval <= 0 {
+		return time.Minute
+	}
+	return interval
+}
+
+// GetUsageReconcileInterval 获取按日志重建用量计数的周期，0 表示关闭
+func GetUsageReconcileInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("USAGE_RECONCILE_INTERVAL", "24h"))
+	if err != nil || interval < 0 {
+		return 0
+	}
+	return interval
+}
+
+// GetOrderExpireInterval 获取关闭超时未支付订单的检查周期，0 表示关闭
+func GetOrderExpireInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("ORDER_EXPIRE_INTERVAL", "1m"))
+	if err != nil || interval < 0 {
+		return 0
+	}
+	return interval
+}
+
+// GetOrderReconcileInterval 获取主动查询待支付订单的对账周期，0 表示关闭
+func GetOrderReconcileInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("ORDER_RECONCILE_INTERVAL", "2m"))
+	if err != nil || interval < 0 {
+		return 0
+	}
+	return interval
+}
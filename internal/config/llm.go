@@ -1,12 +1,18 @@
 package config
 
+import (
+	"strconv"
+	"time"
+)
+
 // LLMProvider 提供商配置
 type LLMProvider struct {
 	Name string // 提供商名称
 
-	Default string // 默认模型
-	BaseURL string // 基础 URL
-	APIKey  string // API 密钥
+	Default  string // 默认模型
+	BaseURL  string // 基础 URL
+	APIKey   string // API 密钥
+	Discover bool   // 是否通过 GET /models 自动发现模型
 }
 
 // GetProviders 返回已配置的提供商列表
@@ -96,7 +102,7 @@ func GetProviders() []LLMProvider {
 	// OpenAI-Like
 	if apiKey := getEnv("OPENAI_LIKE_API_KEY", ""); apiKey != "" {
 		providers = append(providers, LLMProvider{
-			Name: "openai-like", APIKey: apiKey,
+			Name: "openai-like", APIKey: apiKey, Discover: true,
 			BaseURL: getEnv("OPENAI_LIKE_BASE_URL", ""),
 		})
 	}
@@ -119,3 +125,30 @@ func GetProvider(name string) *LLMProvider {
 func HasProvider(name string) bool {
 	return GetProvider(name) != nil
 }
+
+// GetDiscoverInterval 获取模型自动发现周期，0 表示关闭定时发现
+func GetDiscoverInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("MODEL_DISCOVER_INTERVAL", "30m"))
+	if err != nil || interval < 0 {
+		return 0
+	}
+	return interval
+}
+
+// GetCacheSize 获取进程内响应缓存的最大条目数（未配置 Redis 时生效）
+func GetCacheSize() int {
+	size, err := strconv.Atoi(getEnv("CACHE_MEMORY_SIZE", "1000"))
+	if err != nil || size < 0 {
+		return 1000
+	}
+	return size
+}
+
+// GetDefaultMaxTokens 获取请求未指定 max_tokens 时用于额度预留的默认值
+func GetDefaultMaxTokens() int {
+	tokens, err := strconv.Atoi(getEnv("DEFAULT_MAX_TOKENS", "4096"))
+	if err != nil || tokens < 0 {
+		return 4096
+	}
+	return tokens
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type Wechat struct {
 	AppID      string // 应用ID
 	Token      string // 密钥/Token
@@ -29,11 +31,6 @@ type Creem struct {
 	ApiKey string
 
 	WhSecret string
-
-	PlanBasicId string
-	PlanExtraId string
-	PlanUltraId string
-	PlanSuperId string
 }
 
 func GetCreemConfig() *Creem {
@@ -43,11 +40,6 @@ func GetCreemConfig() *Creem {
 	return &Creem{
 		ApiKey:   getEnv("CREEM_API_KEY", ""),
 		WhSecret: getEnv("CREEM_WH_SECRET", ""),
-
-		PlanBasicId: getEnv("PLAN_BASIC_ID", ""),
-		PlanExtraId: getEnv("PLAN_EXTRA_ID", ""),
-		PlanUltraId: getEnv("PLAN_ULTRA_ID", ""),
-		PlanSuperId: getEnv("PLAN_SUPER_ID", ""),
 	}
 }
 
@@ -55,11 +47,6 @@ type Stripe struct {
 	PublicKey string // 公钥
 	SecretKey string // 私钥
 	WhSecret  string // Webhook签名密钥
-
-	PlanBasicId string
-	PlanExtraId string
-	PlanUltraId string
-	PlanSuperId string
 }
 
 func GetStripeConfig() *Stripe {
@@ -70,17 +57,21 @@ func GetStripeConfig() *Stripe {
 		PublicKey: getEnv("STRIPE_PUBLIC_KEY", ""),
 		SecretKey: getEnv("STRIPE_SECRET_KEY", ""),
 		WhSecret:  getEnv("STRIPE_WH_SECRET", ""),
-
-		PlanBasicId: getEnv("PLAN_BASIC_ID", ""),
-		PlanExtraId: getEnv("PLAN_EXTRA_ID", ""),
-		PlanUltraId: getEnv("PLAN_ULTRA_ID", ""),
-		PlanSuperId: getEnv("PLAN_SUPER_ID", ""),
 	}
 }
 
 type Alipay struct {
 	AppID string // 应用ID
-	Token string // 密钥/Token
+	Token string // 应用私钥
+	Live  bool   // 是否生产环境，默认沙箱
+
+	PublicKey  string // 支付宝公钥，公钥模式验签
+	AppCert    string // 应用公钥证书路径，证书模式
+	RootCert   string // 支付宝根证书路径，证书模式
+	PublicCert string // 支付宝公钥证书路径，证书模式验签
+
+	NotifyURL string // 异步通知地址
+	ReturnURL string // 页面跳转支付完成后的返回地址
 }
 
 func GetAlipayConfig() *Alipay {
@@ -90,12 +81,25 @@ func GetAlipayConfig() *Alipay {
 	return &Alipay{
 		AppID: getEnv("ALIPAY_APP_ID", ""),
 		Token: getEnv("ALIPAY_TOKEN", ""),
+		Live:  getEnv("ALIPAY_MODE", "sandbox") == "live",
+
+		PublicKey:  getEnv("ALIPAY_PUBLIC_KEY", ""),
+		AppCert:    getEnv("ALIPAY_APP_CERT", ""),
+		RootCert:   getEnv("ALIPAY_ROOT_CERT", ""),
+		PublicCert: getEnv("ALIPAY_PUBLIC_CERT", ""),
+
+		NotifyURL: getEnv("ALIPAY_NOTIFY_URL", "http://localhost:8080/api/callback/alipay"),
+		ReturnURL: getEnv("ALIPAY_RETURN_URL", "http://localhost:8080/profile"),
 	}
 }
 
 type PayPal struct {
-	AppID string // 应用ID
-	Token string // 密钥/Token
+	AppID     string // 应用ID（Client ID）
+	Token     string // 密钥（Secret）
+	Live      bool   // 是否生产环境，默认沙箱
+	WebhookID string // Webhook ID，用于校验回调签名
+	ReturnURL string // 用户批准付款后的返回地址
+	CancelURL string // 用户取消付款后的返回地址
 }
 
 func GetPayPalConfig() *PayPal {
@@ -103,23 +107,71 @@ func GetPayPalConfig() *PayPal {
 		return nil
 	}
 	return &PayPal{
-		AppID: getEnv("PAYPAL_APP_ID", ""),
-		Token: getEnv("PAYPAL_TOKEN", ""),
+		AppID:     getEnv("PAYPAL_APP_ID", ""),
+		Token:     getEnv("PAYPAL_TOKEN", ""),
+		Live:      getEnv("PAYPAL_MODE", "sandbox") == "live",
+		WebhookID: getEnv("PAYPAL_WEBHOOK_ID", ""),
+		ReturnURL: getEnv("PAYPAL_RETURN_URL", "http://localhost:8080/api/return/paypal"),
+		CancelURL: getEnv("PAYPAL_CANCEL_URL", "http://localhost:8080/pricing"),
+	}
+}
+
+type Union struct {
+	MerID    string // 商户号
+	SignCert string // 商户签名证书（pfx）路径
+	SignPass string // 签名证书密码
+	Live     bool   // 是否生产环境，默认测试环境
+
+	MiddleCert string // 银联中级证书路径，用于校验应答和通知的签名证书
+	RootCert   string // 银联根证书路径
+
+	FrontURL string // 支付完成后的页面跳转地址
+	BackURL  string // 异步通知地址
+}
+
+func GetUnionConfig() *Union {
+	if getEnv("UNION_MER_ID", "") == "" {
+		return nil
+	}
+	return &Union{
+		MerID:    getEnv("UNION_MER_ID", ""),
+		SignCert: getEnv("UNION_SIGN_CERT", ""),
+		SignPass: getEnv("UNION_SIGN_PASS", ""),
+		Live:     getEnv("UNION_MODE", "sandbox") == "live",
+
+		MiddleCert: getEnv("UNION_MIDDLE_CERT", ""),
+		RootCert:   getEnv("UNION_ROOT_CERT", ""),
+
+		FrontURL: getEnv("UNION_FRONT_URL", "http://localhost:8080/profile"),
+		BackURL:  getEnv("UNION_BACK_URL", "http://localhost:8080/api/callback/union"),
 	}
 }
 
-// HasPayment 检查是否配置了指定的支付配置
-func HasPayment(name string) bool {
-	switch name {
-	case "alipay":
-		return GetAlipayConfig() != nil
-	case "wechat":
-		return GetWechatConfig() != nil
-	case "stripe":
-		return GetStripeConfig() != nil
-	case "creem":
-		return GetCreemConfig() != nil
-	default:
-		return false
+type Mock struct {
+	Secret    string        // 模拟回调的签名密钥
+	Outcome   string        // 新订单默认的支付结果：success、failure、delay、expiry
+	Delay     time.Duration // delay 结果的到账延迟
+	NotifyURL string        // 模拟回调的发送地址
+}
+
+// GetMockConfig 模拟支付仅用于开发测试，生产模式下始终不可用
+// 回调签名密钥必须显式配置，未配置时视为未启用，避免使用公开的默认密钥伪造回调
+func GetMockConfig() *Mock {
+	if getEnv("MOCK_PAYMENT", "") != "true" || getEnv("APP_MODE", "test") == "release" {
+		return nil
+	}
+	secret := getEnv("MOCK_PAYMENT_SECRET", "")
+	if secret == "" {
+		return nil
+	}
+	delay, err := time.ParseDuration(getEnv("MOCK_PAYMENT_DELAY", "30s"))
+	if err != nil || delay < 0 {
+		delay = 30 * time.Second
+	}
+	return &Mock{
+		Secret:    secret,
+		Outcome:   getEnv("MOCK_PAYMENT_OUTCOME", "success"),
+		Delay:     delay,
+		NotifyURL: getEnv("MOCK_NOTIFY_URL", "http://localhost:8080/api/callback/mock"),
 	}
 }
@@ -12,11 +12,27 @@ var (
 	ErrOrderQueryFailed        = errors.New("查找订单失败")
 	ErrOrderStatusUpdateFailed = errors.New("更新订单状态失败")
 	ErrUserPlanUpdateFailed    = errors.New("更新用户套餐失败")
+	ErrInvalidTopupAmount      = errors.New("充值金额无效")
+	ErrInvalidOrderTransition  = errors.New("订单状态不允许此变更")
+	ErrOrderStatusConflict     = errors.New("订单状态已被更新")
+	ErrInvalidOrderAmount      = errors.New("订单金额与套餐价格不一致")
+	ErrOrderNotRefundable      = errors.New("订单当前状态不可退款")
+	ErrOrderNotPayable         = errors.New("订单当前状态不可支付")
+	ErrInvalidRefundAmount     = errors.New("退款金额无效")
+
+	ErrCouponNotFound      = errors.New("优惠码不存在")
+	ErrCouponExpired       = errors.New("优惠码已过期")
+	ErrCouponExhausted     = errors.New("优惠码已被领完")
+	ErrCouponUserLimit     = errors.New("已达到该优惠码的使用次数")
+	ErrCouponNotApplicable = errors.New("该优惠码不适用于当前订单")
+	ErrInvalidCoupon       = errors.New("优惠券设置无效")
 
 	ErrPaymentMethodNotEnabled     = errors.New("支付方式未启用")
 	ErrPaymentOrderCreationFailed  = errors.New("创建支付订单失败")
 	ErrPaymentWebhookMissingParams = errors.New("支付回调参数异常")
 	ErrPaymentCallbackVerification = errors.New("支付回调验证失败")
+	ErrPaymentEventNotFound        = errors.New("支付事件不存在")
+	ErrPaymentEventNotReplayable   = errors.New("未通过签名校验的事件不能重放")
 )
 
 // Token service errors
@@ -27,6 +43,32 @@ var (
 	ErrMonthlyRequestLimitReached = errors.New("已达到每月请求限制")
 	ErrDailyProjectLimitReached   = errors.New("已达到每日项目限制")
 	ErrMonthlyProjectLimitReached = errors.New("已达到每月项目限制")
+	ErrDailyCostLimitReached      = errors.New("已达到每日费用限制")
+	ErrMonthlyCostLimitReached    = errors.New("已达到每月费用限制")
+	ErrPriceTableUnavailable      = errors.New("价格表暂不可用，无法计算费用")
+
+	ErrRequestRateLimitReached = errors.New("已达到每分钟请求限制")
+	ErrTokenRateLimitReached   = errors.New("已达到每分钟 Token 限制")
+	ErrConcurrencyLimitReached = errors.New("已达到最大并发请求数")
+	ErrTokenQuotaInsufficient  = errors.New("剩余 Token 额度不足")
+	ErrModelNotAllowed         = errors.New("当前套餐不支持该模型")
+	ErrContextTooLong          = errors.New("请求上下文超过套餐限制")
+	ErrStreamNotAllowed        = errors.New("当前套餐不支持流式响应")
+	ErrPlanExpired             = errors.New("套餐已过期")
+)
+
+// Wallet service errors
+var (
+	ErrInsufficientBalance = errors.New("钱包余额不足")
+	ErrInvalidWalletAmount = errors.New("无效的金额")
+	ErrWalletUpdateFailed  = errors.New("钱包更新失败")
+)
+
+// Subscription service errors
+var (
+	ErrSubscriptionNotFound     = errors.New("订阅不存在")
+	ErrSubscriptionNotSupported = errors.New("该支付方式不支持订阅")
+	ErrSubscriptionCancelFailed = errors.New("取消订阅失败")
 )
 
 // User service errors
@@ -50,6 +92,9 @@ var (
 	ErrInvalidUsageFormat    = errors.New("invalid usage format")
 	ErrInvalidUsageNumber    = errors.New("invalid usage number")
 	ErrUnsupportedUsageType  = errors.New("unsupported usage type")
+	ErrInvalidEntitlements   = errors.New("套餐权益设置无效")
+	ErrInvalidPlanKey        = errors.New("套餐标识无效")
+	ErrInvalidPlanCurrency   = errors.New("套餐币种无效")
 
 	ErrPlanQueryError       = errors.New("Query Plan error")
 	ErrPlanNotEnabled       = errors.New("Plan is not enabled")
@@ -68,9 +113,11 @@ var (
 	ErrPaymentRefundError        = errors.New("退款处理失败")
 	ErrPaymentWebhookError       = errors.New("支付回调处理失败")
 	ErrPaymentNetworkError       = errors.New("支付网络请求失败")
+	ErrPaymentAmountError        = errors.New("支付金额与订单不一致")
 
 	// 详细的内部错误常量（用于日志记录和开发调试）
 	ErrPaymentProviderNotConfigured       = errors.New("payment provider not configured")
+	ErrPaymentMethodNotRegistered         = errors.New("payment method declared but not registered")
 	ErrPaymentPlanNotSupported            = errors.New("payment plan not supported")
 	ErrPaymentClientCreationFailed        = errors.New("failed to create payment client")
 	ErrPaymentCreationFailed              = errors.New("failed to create payment")
@@ -80,10 +127,13 @@ var (
 	ErrPaymentRefundFailed                = errors.New("failed to process refund")
 	ErrPaymentWebhookNotImplemented       = errors.New("webhook verification not implemented")
 	ErrPaymentConfigIncomplete            = errors.New("payment configuration incomplete")
+	ErrPaymentAmountMismatch              = errors.New("payment amount or currency mismatch")
+	ErrPaymentCurrencyNotSupported        = errors.New("currency not supported by payment provider")
 	ErrPaymentSignGenerationFailed        = errors.New("failed to generate payment sign")
 	ErrPaymentError                       = errors.New("payment error")
 	ErrOrderCannotBeRefunded              = errors.New("order cannot be refunded")
 	ErrRefundNotSuccessful                = errors.New("refund was not successful")
+	ErrRefundProcessing                   = errors.New("refund accepted, result pending")
 	ErrRequestDataMarshalFailed           = errors.New("failed to marshal request data")
 	ErrRequestCreationFailed              = errors.New("failed to create request")
 	ErrRequestSendFailed                  = errors.New("failed to send request")
@@ -132,8 +182,14 @@ var (
 // Relay service errors
 var (
 	ErrUnsupportedModel      = errors.New("unsupported model")
+	ErrModelDisabled         = errors.New("model disabled")
 	ErrProviderNotConfigured = errors.New("provider not configured")
 	ErrAPIError              = errors.New("API error")
+
+	ErrDiscoverNotSupported = errors.New("provider does not support model discovery")
+	ErrDiscoverModelsFailed = errors.New("failed to discover models")
+	ErrPriceNotFound        = errors.New("price not found")
+	ErrCatalogModelNotFound = errors.New("catalog model not found")
 )
 
 // Mail service errors
@@ -5,17 +5,9 @@ import (
 	"fmt"
 )
 
-// PaymentProvider 支付提供商枚举
+// PaymentProvider 支付提供商，取值为支付方式在 payment 注册表中的标识
 type PaymentProvider string
 
-const (
-	ProviderStripe PaymentProvider = "stripe"
-	ProviderAlipay PaymentProvider = "alipay"
-	ProviderWechat PaymentProvider = "wechat"
-	ProviderPaypal PaymentProvider = "paypal"
-	ProviderCreem  PaymentProvider = "creem"
-)
-
 // PaymentErrorType 支付错误类型枚举
 type PaymentErrorType string
 
@@ -36,6 +28,10 @@ var internalToUserErrorMap = map[error]error{
 	ErrPaymentConfigIncomplete:      ErrPaymentConfigurationError,
 	ErrPaymentClientCreationFailed:  ErrPaymentConfigurationError,
 	ErrWebhookSecretNotConfigured:   ErrPaymentConfigurationError,
+	ErrPaymentCurrencyNotSupported:  ErrPaymentConfigurationError,
+
+	// 金额相关错误
+	ErrPaymentAmountMismatch: ErrPaymentAmountError,
 
 	// 创建支付相关错误
 	ErrPaymentCreationFailed:       ErrPaymentCreationError,
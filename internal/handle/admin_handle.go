@@ -19,10 +19,30 @@ type AdminHandle struct {
 	relayService *service.RelayService
 	setupService *service.SetupService
 	statsService *service.StatsService
+
+	catalogService *service.CatalogService
+	couponService  *service.CouponService
+	eventService   *service.PaymentEventService
+	jobService     *service.JobService
+	planService    *service.PlanService
+	priceService   *service.PriceService
+	refundService  *service.RefundService
+	usageService   *service.UsageService
+	walletService  *service.WalletService
 }
 
 func NewAdminHandle() *AdminHandle {
 	return &AdminHandle{
+		catalogService: service.NewCatalogService(),
+		couponService:  service.NewCouponService(),
+		eventService:   service.NewPaymentEventService(),
+		jobService:     service.NewJobService(),
+		planService:    service.NewPlanService(),
+		priceService:   service.NewPriceService(),
+		refundService:  service.NewRefundService(),
+		usageService:   service.NewUsageService(),
+		walletService:  service.NewWalletService(),
+
 		logService:   service.NewLogService(),
 		userService:  service.NewUserService(),
 		orderService: service.NewOrderService(),
@@ -100,6 +120,91 @@ func (h *AdminHandle) DeleteUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "用户删除成功"})
 }
 
+// GetPlanChanges 获取用户套餐变更记录（管理员功能）
+func (h *AdminHandle) GetPlanChanges(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	changes, err := h.planService.GetPlanChanges(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": changes})
+}
+
+// ReconcileUsage 按请求日志重建用量计数（管理员功能），未指定用户时处理全部近期活跃用户
+func (h *AdminHandle) ReconcileUsage(c *gin.Context) {
+	var req struct {
+		UserID uint64 `json:"userId"`
+	}
+	c.ShouldBindJSON(&req)
+
+	if req.UserID == 0 {
+		count, err := h.usageService.ReconcileAll()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"count": count})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if err := h.usageService.Reconcile(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": user.ApiUsage})
+}
+
+// AdjustWallet 调整用户钱包余额（管理员功能），正数入账、负数扣减
+func (h *AdminHandle) AdjustWallet(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	var req model.WalletAdjustRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var err error
+	var entry *model.WalletLedgerModel
+	refID := fmt.Sprintf("admin:%d", c.GetUint64("UserID"))
+	if req.Amount > 0 {
+		entry, err = h.walletService.Credit(userID, req.Amount, model.LedgerAdjust, refID, req.Remark)
+	} else {
+		entry, err = h.walletService.Debit(userID, -req.Amount, model.LedgerAdjust, refID, req.Remark, false)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": entry})
+}
+
+// GetLedger 查询钱包流水（管理员功能）
+func (h *AdminHandle) GetLedger(c *gin.Context) {
+	var req model.PaginateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req.Page, req.Size = 1, 10
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Size < 1 || req.Size > 100 {
+		req.Size = 10
+	}
+
+	response, err := h.walletService.QueryLedger(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // ToggleUserStatus 切换用户状态（管理员功能）
 func (h *AdminHandle) ToggleUserStatus(c *gin.Context) {
 	userID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -141,6 +246,135 @@ func (h *AdminHandle) GetModels(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": models})
 }
 
+// GetCatalog 获取模型目录
+func (h *AdminHandle) GetCatalog(c *gin.Context) {
+	models, err := h.catalogService.GetCatalog()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": models})
+}
+
+// DiscoverModels 立即从上游发现模型
+func (h *AdminHandle) DiscoverModels(c *gin.Context) {
+	var req struct {
+		Provider string `json:"provider"`
+	}
+	c.ShouldBindJSON(&req)
+
+	if req.Provider == "" {
+		result := h.catalogService.DiscoverAll(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"result": result})
+		return
+	}
+	count, err := h.catalogService.DiscoverModels(c.Request.Context(), req.Provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": gin.H{req.Provider: count}})
+}
+
+// ToggleModel 启用或禁用目录中的模型
+func (h *AdminHandle) ToggleModel(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.catalogService.ToggleModel(id, req.Enabled); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "模型状态已更新"})
+}
+
+// GetPrices 获取模型价格表
+func (h *AdminHandle) GetPrices(c *gin.Context) {
+	prices, err := h.priceService.GetPrices()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": prices})
+}
+
+// SetPrice 新增或更新模型价格
+func (h *AdminHandle) SetPrice(c *gin.Context) {
+	var price model.PriceModel
+	if err := c.ShouldBindJSON(&price); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if price.Input < 0 || price.Output < 0 || price.Cached < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price must not be negative"})
+		return
+	}
+
+	price.ID = 0
+	if err := h.priceService.SetPrice(&price); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "价格保存成功"})
+}
+
+// DeletePrice 删除模型价格
+func (h *AdminHandle) DeletePrice(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := h.priceService.DeletePrice(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "价格删除成功"})
+}
+
+// GetCoupons 获取优惠券列表
+func (h *AdminHandle) GetCoupons(c *gin.Context) {
+	coupons, err := h.couponService.GetCoupons()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": coupons})
+}
+
+// SaveCoupon 新增或更新优惠券
+func (h *AdminHandle) SaveCoupon(c *gin.Context) {
+	var req model.CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	coupon, err := h.couponService.SaveCoupon(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "优惠券保存成功", "data": coupon})
+}
+
+// ToggleCoupon 启用或停用优惠券
+func (h *AdminHandle) ToggleCoupon(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.couponService.ToggleCoupon(id, req.Enabled); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "优惠券状态已更新"})
+}
+
 // GetStats 获取统计信息
 func (h *AdminHandle) GetStats(c *gin.Context) {
 	stats, err := h.statsService.GetStats()
@@ -228,6 +462,157 @@ func (h *AdminHandle) GetOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// GetOrderHistory 获取订单状态变更记录
+func (h *AdminHandle) GetOrderHistory(c *gin.Context) {
+	history, err := h.orderService.GetHistory(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": history})
+}
+
+// CancelOrder 管理员取消待支付订单
+func (h *AdminHandle) CancelOrder(c *gin.Context) {
+	change := model.OrderChange{
+		Source: model.OrderSourceAdmin,
+		Actor:  fmt.Sprintf("admin:%d", c.GetUint64("UserID")),
+	}
+	if err := h.orderService.UpdateStatus(c.Param("id"), model.PaymentCanceled, change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "订单已取消"})
+}
+
+// RefundOrder 管理员退款，金额为空时全额退款
+func (h *AdminHandle) RefundOrder(c *gin.Context) {
+	var req model.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	change := model.OrderChange{
+		Source: model.OrderSourceAdmin,
+		Actor:  fmt.Sprintf("admin:%d", c.GetUint64("UserID")),
+	}
+	refund, err := h.refundService.Refund(c.Param("id"), &req, change)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "refund": refund})
+		return
+	}
+	if refund.Status == model.RefundPending { // 渠道已受理，结果以回调为准
+		c.JSON(http.StatusAccepted, gin.H{"message": "退款已提交，等待渠道确认", "refund": refund})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "退款成功", "refund": refund})
+}
+
+// SetMockOutcome 设置模拟支付订单的结果
+func (h *AdminHandle) SetMockOutcome(c *gin.Context) {
+	var req model.MockOutcomeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := h.orderService.SetMockOutcome(c.Param("id"), req.Outcome)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "模拟结果已更新", "data": order})
+}
+
+// SendMockWebhook 为模拟支付订单发送签名回调
+func (h *AdminHandle) SendMockWebhook(c *gin.Context) {
+	var req model.MockWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	event, err := h.orderService.SendMockWebhook(c.Param("id"), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "event": event})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "模拟回调已发送", "event": event})
+}
+
+// GetOrderRefunds 获取订单的退款记录
+func (h *AdminHandle) GetOrderRefunds(c *gin.Context) {
+	refunds, err := h.refundService.GetRefunds(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": refunds})
+}
+
+// GetPaymentEvents 分页查询支付回调事件
+func (h *AdminHandle) GetPaymentEvents(c *gin.Context) {
+	var req model.PaginateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req.Page = 1
+		req.Size = 10
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Size < 1 || req.Size > 100 {
+		req.Size = 10
+	}
+
+	response, err := h.eventService.QueryEvents(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ReplayPaymentEvent 重新处理支付回调事件
+func (h *AdminHandle) ReplayPaymentEvent(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	record, err := h.eventService.Replay(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "data": record})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "事件已重放", "data": record})
+}
+
+// GetJobs 获取定时任务及最近一次运行状态
+func (h *AdminHandle) GetJobs(c *gin.Context) {
+	status, err := h.jobService.GetStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// GetJobRuns 分页查询定时任务运行记录
+func (h *AdminHandle) GetJobRuns(c *gin.Context) {
+	var req model.PaginateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req.Page = 1
+		req.Size = 10
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Size < 1 || req.Size > 100 {
+		req.Size = 10
+	}
+
+	response, err := h.jobService.QueryRuns(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 func (h *AdminHandle) GetUsage(c *gin.Context) {
 	// 从url 中取 msgId
 	msgId := c.Query("msgId")
@@ -1,8 +1,11 @@
 package handle
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
+	"llm-member/internal/consts"
 	"llm-member/internal/model"
 	"llm-member/internal/service"
 
@@ -10,9 +13,12 @@ import (
 )
 
 type BasicHandle struct {
-	userService  *service.UserService
-	orderService *service.OrderService
-	setupService *service.SetupService
+	userService   *service.UserService
+	orderService  *service.OrderService
+	setupService  *service.SetupService
+	walletService *service.WalletService
+
+	subscriptionService *service.SubscriptionService
 }
 
 func NewBasicHandle() *BasicHandle {
@@ -23,6 +29,10 @@ func NewBasicHandle() *BasicHandle {
 		userService:  userService,
 		orderService: orderService,
 		setupService: setupService,
+
+		walletService: service.NewWalletService(),
+
+		subscriptionService: service.NewSubscriptionService(),
 	}
 }
 
@@ -114,6 +124,56 @@ func (h *BasicHandle) GetUserOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"orders": data})
 }
 
+// GetUserWallet 用户钱包余额
+func (h *BasicHandle) GetUserWallet(c *gin.Context) {
+	balance, err := h.walletService.GetBalance(c.GetUint64("UserID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"balance": balance})
+}
+
+// GetUserLedger 用户钱包流水
+func (h *BasicHandle) GetUserLedger(c *gin.Context) {
+	var req model.PaginateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req.Page, req.Size = 1, 10
+	}
+	req.Query = map[string]any{"user_id": c.GetUint64("UserID")}
+
+	response, err := h.walletService.QueryLedger(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetUserSubscriptions 用户订阅列表
+func (h *BasicHandle) GetUserSubscriptions(c *gin.Context) {
+	subs, err := h.subscriptionService.GetUserSubscriptions(c.GetUint64("UserID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": subs})
+}
+
+// CancelSubscription 取消自动续费，当前周期结束后套餐失效
+func (h *BasicHandle) CancelSubscription(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	sub, err := h.subscriptionService.Cancel(c.GetUint64("UserID"), id)
+	if errors.Is(err, consts.ErrSubscriptionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
 // RegenerateKey 重新生成用户API密钥
 func (h *BasicHandle) RegenerateKey(c *gin.Context) {
 	user, err := h.userService.RegenerateKey(c.GetUint64("UserID"))
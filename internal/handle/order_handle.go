@@ -2,10 +2,12 @@ package handle
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
-	"llm-member/internal/config"
+	"llm-member/internal/consts"
 	"llm-member/internal/model"
 	"llm-member/internal/service"
 
@@ -17,6 +19,7 @@ type OrderHandler struct {
 	userService  *service.UserService
 	setupService *service.SetupService
 	orderService *service.OrderService
+	planService  *service.PlanService
 }
 
 func NewOrderHandler() *OrderHandler {
@@ -24,47 +27,14 @@ func NewOrderHandler() *OrderHandler {
 		userService:  service.NewUserService(),
 		setupService: service.NewSetupService(),
 		orderService: service.NewOrderService(),
+		planService:  service.NewPlanService(),
 	}
 }
 
 // GetPaymentMethods 获取可用的支付方式
 func (h *OrderHandler) GetPaymentMethods(c *gin.Context) {
-	methods := []gin.H{}
-
-	// 检查各支付方式是否可用
-	if config.HasPayment("mock") {
-		methods = append(methods, gin.H{
-			"method": "mock", "name": "模拟支付",
-			"icon": "fab fa-debug", "color": "#E60012",
-		})
-	}
-	if config.HasPayment("alipay") {
-		methods = append(methods, gin.H{
-			"method": "alipay", "name": "支付宝",
-			"icon": "fab fa-alipay", "color": "#1677FF",
-		})
-	}
-
-	if config.HasPayment("wechat") {
-		methods = append(methods, gin.H{
-			"method": "wechat", "name": "微信支付",
-			"icon": "fab fa-weixin", "color": "#07C160",
-		})
-	}
-
-	if config.HasPayment("stripe") {
-		methods = append(methods, gin.H{
-			"method": "stripe", "name": "Stripe",
-			"icon": "fab fa-stripe", "color": "#635BFF",
-		})
-	}
-
-	if config.HasPayment("creem") {
-		methods = append(methods, gin.H{
-			"method": "creem", "name": "Creem",
-			"icon": "fas fa-credit-card", "color": "#6366F1",
-		})
-	}
+	// 已注册且完成配置的支付方式，包含显示信息和支持的能力
+	methods := h.orderService.GetPaymentMethods()
 	c.JSON(http.StatusOK, gin.H{
 		"methods": methods,
 	})
@@ -96,8 +66,6 @@ func (h *OrderHandler) ShowPaymentQrcode(c *gin.Context) {
 			this is a mock payment, nice to meet you!
 			click 'check button' to get success status!
 		`
-	} else if order.QRCode != "" {
-		qrContent = order.QRCode
 	}
 
 	// 生成二维码图片
@@ -147,19 +115,26 @@ func (h *OrderHandler) CreatePaymentOrder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
 		return
 	}
-	// if user.ExpireAt != nil && user.ExpireAt.After(time.Now()) {
-	// 	c.JSON(http.StatusOK, gin.H{"error": "您已订阅套餐，不能重复订阅",
-	// 		"plan": user.UserPlan, "expireAt": user.ExpireAt,
-	// 	})
-	// 	return
-	// }
+	// 钱包充值不关联套餐，金额由用户指定
+	if req.Kind == model.OrderTopup {
+		if req.Amount == nil || *req.Amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": consts.ErrInvalidTopupAmount.Error()})
+			return
+		}
+		req.PayPlan = ""
+		h.createOrder(c, &req, &model.PlanInfo{})
+		return
+	}
+	if req.Kind != model.OrderSubscribe {
+		req.Kind = model.OrderPlan
+	}
 
-	plan := model.PlanInfo{Plan: string(req.PayPlan)}
-	if err = h.setupService.GetAsTarget("plan."+plan.Plan, &plan); err != nil {
+	plan, err := h.setupService.GetPlanInfo(req.PayPlan)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取套餐价格失败"})
 		return
 	}
-	if plan.Enabled == false {
+	if plan.Enabled == false || plan.Archived {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "该套餐暂不可用"})
 		return
 	}
@@ -167,10 +142,71 @@ func (h *OrderHandler) CreatePaymentOrder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "该套餐暂不可用"})
 		return
 	}
+	// 套餐按价格收费，仅允许自定义金额的套餐由用户指定不低于价格的金额
+	if req.Amount == nil {
+		req.Amount = &plan.Price
+	} else if *req.Amount != plan.Price {
+		custom := plan.CustomAmount && req.Kind == model.OrderPlan
+		if !custom || *req.Amount < plan.Price {
+			c.JSON(http.StatusBadRequest, gin.H{"error": consts.ErrInvalidOrderAmount.Error()})
+			return
+		}
+	}
+
+	// 已有有效套餐时按报价升级或降级，金额以服务端报价为准
+	if req.Kind == model.OrderPlan {
+		quote, err := h.planService.Quote(user, req.PayPlan)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		switch quote.Action {
+		case model.PlanActionUpgrade:
+			req.Kind, req.Amount, req.Credit = model.OrderUpgrade, &quote.Amount, quote.Credit
+		case model.PlanActionDowngrade:
+			req.Kind, req.Amount = model.OrderDowngrade, &quote.Amount
+		}
+	}
+	h.createOrder(c, &req, plan)
+}
+
+// QuotePlan 购买套餐前的报价，展示升级抵扣或降级生效时间
+func (h *OrderHandler) QuotePlan(c *gin.Context) {
+	var req model.PlanQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	user, err := h.userService.GetUserByID(c.GetUint64("UserID"))
+	if err != nil || user == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
+		return
+	}
+	quote, err := h.planService.Quote(user, req.PayPlan)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, quote)
+}
+
+// createOrder 创建支付订单并返回支付信息
+func (h *OrderHandler) createOrder(c *gin.Context, req *model.OrderRequest, plan *model.PlanInfo) {
+	// 未指定支付场景时，手机浏览器跳转手机网站支付，其余跳转电脑网站支付
+	if req.Scene == "" {
+		req.Scene = model.ScenePage
+		if isMobile(c.Request.UserAgent()) {
+			req.Scene = model.SceneWap
+		}
+	}
 	// 创建支付订单（这里模拟支付接口）
-	if order, err := h.orderService.CreateOrder(&req, &plan); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败: " + err.Error()})
+	if order, err := h.orderService.CreateOrder(req, plan); err != nil {
+		status := http.StatusInternalServerError
+		if isCouponError(err) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": "创建订单失败: " + err.Error()})
 	} else if order == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败: 订单为空"})
 	} else {
@@ -178,11 +214,37 @@ func (h *OrderHandler) CreatePaymentOrder(c *gin.Context) {
 			Amount: order.Amount, QRCode: order.QRCode,
 			OrderID: order.OrderID, PayURL: order.PayURL,
 			Status: string(order.Status), Method: string(order.Method),
+			Currency: order.Currency, OrigAmount: order.OrigAmount,
+			Discount: order.Discount,
 		}
 		c.JSON(http.StatusOK, response)
 	}
 }
 
+// isMobile 是否为手机浏览器
+func isMobile(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, keyword := range []string{"mobile", "android", "iphone", "ipad", "micromessenger"} {
+		if strings.Contains(ua, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCouponError 优惠码不可用属于用户输入错误
+func isCouponError(err error) bool {
+	for _, target := range []error{
+		consts.ErrCouponNotFound, consts.ErrCouponExpired, consts.ErrCouponExhausted,
+		consts.ErrCouponUserLimit, consts.ErrCouponNotApplicable,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // QueryPaymentOrder 获取支付订单详情
 func (h *OrderHandler) QueryPaymentOrder(c *gin.Context) {
 	if orderID := c.Param("id"); orderID == "" {
@@ -203,15 +265,12 @@ func (h *OrderHandler) QueryPaymentOrder(c *gin.Context) {
 		return
 	}
 
-	currStatus := order.Status
-	err = h.orderService.QueryPayment(order)
-	if err == nil && currStatus != order.Status {
-		limit, _ := h.setupService.GetPlanLimit(order.PayPlan)
-		err := h.orderService.PaySuccess(c.Param("id"), limit)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	change := model.OrderChange{
+		Source: model.OrderSourceQuery, Actor: fmt.Sprintf("user:%d", order.UserID),
+	}
+	if err := h.orderService.QueryPayment(order, change); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 	c.JSON(http.StatusOK, order)
 }
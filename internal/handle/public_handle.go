@@ -6,6 +6,7 @@ import (
 	"llm-member/internal/config"
 	"llm-member/internal/model"
 	"llm-member/internal/service"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -17,12 +18,14 @@ import (
 type PublicHandle struct {
 	setupService *service.SetupService
 	orderService *service.OrderService
+	eventService *service.PaymentEventService
 }
 
 func NewPublicHandler() *PublicHandle {
 	return &PublicHandle{
 		setupService: service.NewSetupService(),
 		orderService: service.NewOrderService(),
+		eventService: service.NewPaymentEventService(),
 	}
 }
 
@@ -41,25 +44,64 @@ func (h *PublicHandle) DoPaymentCallback(c *gin.Context) {
 		return
 	}
 
-	// 验证支付回调签名
-	order, err := h.orderService.VerifyCallback(c.Param("name"), c.Request)
+	// 验证签名、记录事件并按状态处理，重复事件直接返回
+	record, err := h.eventService.Receive(c.Param("name"), c.Request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		if record != nil && !record.Verified {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
-	var limit *model.ApiLimit
-	if limit, err = h.setupService.GetPlanLimit(order.PayPlan); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if ack, ok := h.eventService.Ack(c.Param("name")); ok {
+		c.String(http.StatusOK, ack)
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "事件已处理", "result": record.Result})
+}
 
-	// 标记为支付成功
-	err = h.orderService.PaySuccess(order.OrderID, limit)
+// DoPaymentReturn 用户在渠道批准付款后返回，查询并完成扣款后跳转到个人中心
+func (h *PublicHandle) DoPaymentReturn(c *gin.Context) {
+	method := model.PaymentMethod(c.Param("name"))
+	if token := c.Query("token"); token != "" {
+		order, err := h.orderService.FindByThridID(method, token)
+		if err == nil {
+			change := model.OrderChange{
+				Source: model.OrderSourceQuery, Actor: string(method), Remark: "return",
+			}
+			if err := h.orderService.QueryPayment(order, change); err != nil {
+				log.Printf("[order][%s] query on return failed: %v", order.OrderID, err)
+			}
+		}
+	}
+	c.Redirect(http.StatusFound, "/profile")
+}
+
+// paymentForm 自动提交到支付渠道的表单页
+var paymentForm = template.Must(template.New("pay").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>正在跳转支付</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+{{range $key, $value := .Fields}}<input type="hidden" name="{{$key}}" value="{{$value}}">
+{{end}}<noscript><button type="submit">继续支付</button></noscript>
+</form></body></html>`))
+
+// DoPaymentForm 渲染跳转渠道的支付表单，用于需要浏览器提交签名表单的支付方式
+func (h *PublicHandle) DoPaymentForm(c *gin.Context) {
+	action, fields, err := h.orderService.PaymentForm(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "支付成功"})
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	data := gin.H{"Action": action, "Fields": fields}
+	if err := paymentForm.Execute(c.Writer, data); err != nil {
+		log.Printf("[order][%s] render payment form failed: %v", c.Param("id"), err)
+	}
 }
 
 // StaticRouteHandle 统一的路由和静态文件处理中间件
@@ -3,13 +3,18 @@ package handle
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"llm-member/internal/consts"
 	"llm-member/internal/model"
 	"llm-member/internal/service"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type RelayHandle struct {
@@ -18,7 +23,15 @@ type RelayHandle struct {
 	relayService *service.RelayService
 	setupService *service.SetupService
 	tokenService *service.TokenService
-	statsService *service.StatsService
+	usageService *service.UsageService
+	cacheService *service.CacheService
+	limitService *service.RateLimitService
+	quotaService *service.QuotaService
+	planService  *service.PlanService
+	priceService *service.PriceService
+
+	accessService *service.AccessService
+	walletService *service.WalletService
 }
 
 func NewRelayHandle() *RelayHandle {
@@ -28,8 +41,31 @@ func NewRelayHandle() *RelayHandle {
 		relayService: service.NewRelayService(),
 		setupService: service.NewSetupService(),
 		tokenService: service.NewTokenService(),
-		statsService: service.NewStatsService(),
+		usageService: service.NewUsageService(),
+		cacheService: service.NewCacheService(),
+		limitService: service.NewRateLimitService(),
+		quotaService: service.NewQuotaService(),
+		planService:  service.NewPlanService(),
+		priceService: service.NewPriceService(),
+
+		accessService: service.NewAccessService(),
+		walletService: service.NewWalletService(),
+	}
+}
+
+// GetModels 获取当前 API Key 可调用的模型列表（OpenAI 兼容格式）
+func (h *RelayHandle) GetModels(c *gin.Context) {
+	var userInfo *model.UserModel
+	if user, exists := c.Get("user"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未找到用户信息"})
+		return
+	} else {
+		userInfo = user.(*model.UserModel)
 	}
+
+	plan, _ := h.setupService.GetPlanInfo(userInfo.UserPlan)
+	models := h.accessService.GetModels(plan, userInfo)
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": models})
 }
 
 // 定义callback函数类型
@@ -52,7 +88,108 @@ func (h *RelayHandle) ChatCompletions(c *gin.Context) {
 		userInfo = user.(*model.UserModel)
 	}
 
-	if err := h.tokenService.CheckUsage(userInfo); err != nil {
+	// 套餐过期（超过宽限期）时先回退到默认套餐
+	// 降级失败（如未配置默认套餐）时不拦截请求，过期套餐的额度不再可用，只能从钱包扣费
+	var usageErr error
+	if h.planService.IsExpired(userInfo) {
+		if err := h.planService.Downgrade(userInfo, "expired"); err != nil {
+			log.Printf("[RELAY] downgrade user %d failed, wallet only: %v", userInfo.ID, err)
+			usageErr = consts.ErrPlanExpired
+		}
+	}
+
+	// 钱包作为套餐额度的溢出支付：额度内的请求由套餐承担，不扣钱包；
+	// 额度用尽后，若钱包有余额且模型已定价，则改为按请求费用从钱包扣费
+	var walletMode bool
+	if userInfo.ApiLimit != nil {
+		userInfo.ApiUsage = h.usageService.Snapshot(userInfo)
+	}
+	if usageErr == nil {
+		usageErr = h.tokenService.CheckUsage(userInfo)
+	}
+	// 按费用计量的套餐在价格表不可用时无法累计费用，拒绝请求
+	if limit := userInfo.ApiLimit; usageErr == nil && limit != nil && (limit.DailyCost > 0 || limit.MonthlyCost > 0) {
+		usageErr = h.priceService.Available()
+	}
+	if err := usageErr; err != nil {
+		if userInfo.Balance <= 0 || h.priceService.FindPrice(req.Model) == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		walletMode = true
+	}
+
+	// 检查模型访问权限，自动选择模型时取第一个可用模型
+	plan, _ := h.setupService.GetPlanInfo(userInfo.UserPlan)
+	if req.Model == "" || req.Model == "auto-match" {
+		if models := h.accessService.GetModels(plan, userInfo); len(models) > 0 {
+			req.Model = models[0].ID
+		}
+	}
+	if !h.accessService.Allowed(plan, userInfo, req.Model) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("%v: %s", consts.ErrModelNotAllowed, req.Model),
+		})
+		return
+	}
+
+	// 按套餐权益检查请求大小
+	if plan != nil {
+		if err := h.tokenService.CheckEntitlements(plan.Entitlements, &req); err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, consts.ErrContextTooLong) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// 检查速率限制（RPM/TPM/并发）
+	rateLimit := h.limitService.Resolve(plan, userInfo)
+	limitResult, release, err := h.limitService.Acquire(userInfo.ID, rateLimit)
+	for key, value := range limitResult.Headers() {
+		c.Header(key, value)
+	}
+	if err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	defer release()
+
+	// 命中响应缓存时直接返回
+	var cacheKey string
+	var cachePolicy = h.getCachePolicy(plan, &req)
+	if cachePolicy != nil {
+		cacheKey = h.cacheService.BuildKey(&req)
+		if !strings.Contains(c.GetHeader("Cache-Control"), "no-cache") {
+			if resp, ok := h.cacheService.Get(cacheKey); ok {
+				h.handleCachedResponse(c, &req, resp, plan, userInfo, walletMode, startTime)
+				return
+			}
+		}
+		c.Header("X-Cache", "MISS")
+	}
+
+	// 预留预估用量，额度不足时直接拒绝；钱包扣费时按预估费用预扣
+	var walletHold float64
+	var requestID = uuid.NewString()
+	var releaseQuota = func() {}
+	estimate := h.quotaService.Estimate(&req)
+	if walletMode {
+		walletHold = h.priceService.Compute(plan, estimate, false, req.Model)
+		if walletHold > 0 {
+			if _, err := h.walletService.Debit(
+				userInfo.ID, walletHold, model.LedgerUsage,
+				requestID, "预扣费用", false,
+			); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	} else if releaseQuota, err = h.quotaService.Reserve(
+		userInfo, estimate.TotalTokens,
+	); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
@@ -66,6 +203,9 @@ func (h *RelayHandle) ChatCompletions(c *gin.Context) {
 
 	// 创建通用的日志记录
 	finishCallback := func(err error, resp *model.ChatResponse) {
+		// 实际用量入账后释放预留
+		defer releaseQuota()
+
 		duration := time.Since(startTime).Milliseconds()
 		provider := h.relayService.GetProvider(req.Model)
 		logEntry := &model.LlmLogModel{
@@ -85,9 +225,22 @@ func (h *RelayHandle) ChatCompletions(c *gin.Context) {
 			logEntry.Status = "success"
 			logEntry.ChatID = resp.ID
 			logEntry.AllUsage = resp.Usage
+			logEntry.Cost = h.priceService.Compute(
+				plan, resp.Usage, false, req.Model, resp.Model,
+			)
+			if rateLimit.TPM > 0 {
+				h.limitService.RecordTokens(userInfo.ID, resp.Usage.TotalTokens)
+			}
+			if cacheKey != "" {
+				ttl := time.Duration(cachePolicy.TTL) * time.Second
+				h.cacheService.Set(cacheKey, resp, ttl)
+			}
+		}
+		if walletMode {
+			h.settleWallet(userInfo.ID, requestID, walletHold, logEntry.Cost)
 		}
 		if err := h.logService.CreateLog(logEntry); err == nil {
-			h.statsService.UpdateUserStats(userInfo)
+			h.usageService.Record(userInfo, logEntry)
 		}
 	}
 
@@ -98,6 +251,115 @@ func (h *RelayHandle) ChatCompletions(c *gin.Context) {
 	h.handleNonStreamResponse(c, ctx, &req, finishCallback)
 }
 
+// settleWallet 按实际费用结算钱包预扣：多退少补，补扣不透支，余额不足时扣至零
+func (h *RelayHandle) settleWallet(userID uint64, requestID string, hold, cost float64) {
+	var err error
+	if diff := hold - cost; diff > 0 {
+		_, err = h.walletService.Credit(
+			userID, diff, model.LedgerUsage, requestID, "结算退回",
+		)
+	} else if diff < 0 {
+		_, err = h.walletService.DebitUpTo(
+			userID, -diff, model.LedgerUsage, requestID, "结算补扣",
+		)
+	}
+	if err != nil {
+		log.Printf("[RELAY] settle wallet for user %d failed: %v", userID, err)
+	}
+}
+
+// getCachePolicy 获取用户套餐的缓存设置，未启用或请求不可缓存时返回 nil
+func (h *RelayHandle) getCachePolicy(plan *model.PlanInfo, req *model.ChatRequest) *model.PlanCache {
+	if !h.cacheService.IsCacheable(req) {
+		return nil
+	}
+	if plan == nil || plan.Cache == nil || !plan.Entitlements.HasFlag(model.FlagCache) {
+		return nil
+	}
+	if !plan.Cache.Enabled || plan.Cache.TTL <= 0 {
+		return nil
+	}
+	return plan.Cache
+}
+
+// handleCachedResponse 返回缓存的响应，并按套餐的缓存计费比例记录日志
+func (h *RelayHandle) handleCachedResponse(
+	c *gin.Context, req *model.ChatRequest, resp *model.ChatResponse,
+	plan *model.PlanInfo, userInfo *model.UserModel, walletMode bool, startTime time.Time,
+) {
+	policy := plan.Cache
+	usage := model.Usage{
+		PromptTokens:     int(float64(resp.Usage.PromptTokens) * policy.Rate),
+		CompletionTokens: int(float64(resp.Usage.CompletionTokens) * policy.Rate),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	logEntry := &model.LlmLogModel{
+		UserID: userInfo.ID, Status: "cached",
+		Provider: h.relayService.GetProvider(req.Model),
+		TheModel: req.Model, ChatID: resp.ID,
+		Messages: req.Messages, Response: resp, AllUsage: usage,
+		Cost:    h.priceService.Compute(plan, resp.Usage, true, req.Model, resp.Model),
+		ReqTime: time.Now(), ClientIP: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		ProjID:    c.GetHeader("X-Project-Id"),
+		Duration:  time.Since(startTime).Milliseconds(),
+	}
+	// 缓存命中的费用已知，钱包扣费时按本次请求直接扣除，余额不足则拒绝
+	if walletMode && logEntry.Cost > 0 {
+		if _, err := h.walletService.Debit(
+			userInfo.ID, logEntry.Cost, model.LedgerUsage,
+			uuid.NewString(), "缓存命中费用", false,
+		); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	go func() {
+		if err := h.logService.CreateLog(logEntry); err == nil {
+			h.usageService.Record(userInfo, logEntry)
+		}
+	}()
+
+	c.Header("X-Cache", "HIT")
+	if !req.Stream {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	// 以 SSE 形式回放缓存内容
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("X-Accel-Buffering", "no")
+
+	finishReason := "stop"
+	for _, choice := range resp.Choices {
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+		chunks := []model.ChatStreamChoice{
+			{Index: choice.Index, Delta: model.ChatStreamDelta{
+				Role: choice.Message.Role, Content: choice.Message.Content,
+			}},
+			{Index: choice.Index, FinishReason: &finishReason},
+		}
+		for _, chunk := range chunks {
+			data, _ := json.Marshal(model.ChatStreamResponse{
+				ID: resp.ID, Object: "chat.completion.chunk",
+				Created: resp.Created, Model: resp.Model,
+				Choices: []model.ChatStreamChoice{chunk},
+			})
+			c.Writer.Write([]byte("data: "))
+			c.Writer.Write(data)
+			c.Writer.Write([]byte("\n\n"))
+		}
+	}
+	c.Writer.Write([]byte("data: [DONE]\n\n"))
+	c.Writer.Flush()
+}
+
 // handleNonStreamResponse 处理非流式响应
 func (h *RelayHandle) handleNonStreamResponse(c *gin.Context, ctx context.Context, req *model.ChatRequest, callback FinishCallback) {
 	response, err := h.relayService.ChatCompletions(ctx, req)
@@ -1,7 +1,6 @@
 package handle
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"llm-member/internal/model"
@@ -28,33 +27,34 @@ func (h *SetupHandler) GetPricingPlans(c *gin.Context) {
 	})
 }
 
+// SetPricingPlan 创建或更新付费方案（管理员）
 func (h *SetupHandler) SetPricingPlan(c *gin.Context) {
-	planKey := c.Param("plan")
-
 	var plan model.PlanInfo
 	if err := c.ShouldBindJSON(&plan); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if _, err := h.setupService.ParsePlanLimit(&plan); err != nil {
+	plan.Plan = c.Param("plan")
+	if err := h.setupService.SavePlan(&plan); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Plan config updated successfully"})
+}
 
-	// 将整个方案作为JSON对象存储
-	config := &model.ConfigModel{Kind: "plan", Key: "plan." + planKey}
-	if data, err := json.Marshal(plan); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+// SortPricingPlans 调整付费方案展示顺序（管理员）
+func (h *SetupHandler) SortPricingPlans(c *gin.Context) {
+	var req struct {
+		Plans []string `json:"plans" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
-	} else {
-		config.Data = string(data)
 	}
-
-	if err := h.setupService.SetConfig(config); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plan config"})
+	if err := h.setupService.SortPlans(req.Plans); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Plan config updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"plans": h.setupService.GetAllPlans()})
 }
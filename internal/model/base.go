@@ -1,5 +1,7 @@
 package model
 
+import "slices"
+
 // Role 角色
 type Role string
 
@@ -8,25 +10,39 @@ const (
 	RoleAdmin Role = "admin" // 管理员
 )
 
-// PayPlan 套餐类型
+// PayPlan 套餐标识，对应配置项 plan.{key}，由管理员创建
 type PayPlan string
 
-const (
-	PlanBasic PayPlan = "basic" // Basic
-	PlanExtra PayPlan = "extra" // Extra
-	PlanUltra PayPlan = "ultra" // Ultra
-	PlanSuper PayPlan = "super" // Super
-)
-
-// PaymentMethod 支付方式
+// PaymentMethod 支付方式标识，名称、图标和能力以 payment 包的注册信息为准
 type PaymentMethod string
 
+// 支付方式标识的类型化别名，仅供代码引用，payment 包启动时校验与注册信息一一对应
 const (
 	PaymentAlipay PaymentMethod = "alipay"
 	PaymentWechat PaymentMethod = "wechat"
 	PaymentUnion  PaymentMethod = "union"
 	PaymentMock   PaymentMethod = "mock"
 	PaymentStripe PaymentMethod = "stripe"
+	PaymentPaypal PaymentMethod = "paypal"
+	PaymentCreem  PaymentMethod = "creem"
+)
+
+// PaymentMethods 已声明的支付方式标识
+var PaymentMethods = []PaymentMethod{
+	PaymentAlipay, PaymentWechat, PaymentUnion, PaymentMock,
+	PaymentStripe, PaymentPaypal, PaymentCreem,
+}
+
+// OrderKind 订单类型
+type OrderKind string
+
+const (
+	OrderPlan  OrderKind = "plan"  // 购买套餐
+	OrderTopup OrderKind = "topup" // 钱包充值
+
+	OrderSubscribe OrderKind = "subscribe" // 订阅套餐（自动续费）
+	OrderUpgrade   OrderKind = "upgrade"   // 升级套餐，按剩余价值抵扣
+	OrderDowngrade OrderKind = "downgrade" // 降级套餐，到期后生效
 )
 
 type OrderStatus string
@@ -36,8 +52,26 @@ const (
 	PaymentSucceed  OrderStatus = "succeed"
 	PaymentRefunded OrderStatus = "refunded"
 	PaymentCanceled OrderStatus = "canceled"
+	PaymentExpired  OrderStatus = "expired"
+
+	PaymentPartialRefunded OrderStatus = "partially_refunded"
 )
 
+// orderTransitions 订单状态允许的流转
+// 已取消或过期的订单仍可能被用户支付，渠道确认支付后允许转为成功
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	PaymentPending:         {PaymentSucceed, PaymentCanceled, PaymentExpired},
+	PaymentCanceled:        {PaymentSucceed},
+	PaymentExpired:         {PaymentSucceed},
+	PaymentSucceed:         {PaymentRefunded, PaymentPartialRefunded},
+	PaymentPartialRefunded: {PaymentRefunded},
+}
+
+// CanTransit 是否允许从当前状态流转到目标状态
+func (s OrderStatus) CanTransit(to OrderStatus) bool {
+	return slices.Contains(orderTransitions[s], to)
+}
+
 // PaginateRequest 分页请求结构体
 type PaginateRequest struct {
 	Page uint `json:"page" binding:"min=1"`         // 页码，从1开始
@@ -20,6 +20,8 @@ type LlmLogModel struct {
 	Response any `json:"response" gorm:"type:text;serializer:json"`
 	AllUsage any `json:"allUsage" gorm:"column:all_usage;type:text;serializer:json"`
 
+	Cost float64 `json:"cost" gorm:"column:cost;type:double;not null;default:0"` // 按价格表计算的费用
+
 	Duration  int64  `json:"duration" gorm:"not null;default:0"`
 	Status    string `json:"status" gorm:"type:varchar(10);"`
 	ErrorMsg  string `json:"errorMsg" gorm:"column:error_msg;type:varchar(256);"`
@@ -114,3 +116,37 @@ type LLModelInfo struct {
 	Object   string `json:"object"`
 	Provider string `json:"provider"`
 }
+
+// PriceModel 模型价格表，价格单位为每 1M Token
+type PriceModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	ModelID string  `json:"modelId" gorm:"column:model_id;type:varchar(128);uniqueIndex;not null" binding:"required"`
+	Input   float64 `json:"input" gorm:"column:input;type:double;not null;default:0"`
+	Output  float64 `json:"output" gorm:"column:output;type:double;not null;default:0"`
+	Cached  float64 `json:"cached" gorm:"column:cached;type:double;not null;default:0"`
+
+	gorm.Model
+}
+
+func (m PriceModel) TableName() string {
+	return "llm_price"
+}
+
+// CatalogModel 模型目录（上游自动发现的模型）
+type CatalogModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	ModelID  string `json:"modelId" gorm:"column:model_id;type:varchar(128);uniqueIndex:idx_provider_model;not null"`
+	Provider string `json:"provider" gorm:"column:provider;type:varchar(64);uniqueIndex:idx_provider_model;not null"`
+	OwnedBy  string `json:"ownedBy" gorm:"column:owned_by;type:varchar(128)"`
+	Enabled  bool   `json:"enabled" gorm:"column:enabled;default:true"`
+
+	SyncedAt time.Time `json:"syncedAt" gorm:"column:synced_at"`
+
+	gorm.Model
+}
+
+func (m CatalogModel) TableName() string {
+	return "llm_model"
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CouponKind 优惠券类型
+type CouponKind string
+
+const (
+	CouponPercent CouponKind = "percent" // 按百分比折扣
+	CouponFixed   CouponKind = "fixed"   // 固定金额减免
+)
+
+// CouponModel 优惠券/推广码
+type CouponModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	Code  string     `json:"code" gorm:"column:code;type:varchar(64);uniqueIndex;not null"`
+	Kind  CouponKind `json:"kind" gorm:"column:kind;type:varchar(10);not null"`
+	Value float64    `json:"value" gorm:"column:value;type:double;not null"`      // 百分比（0-100）或减免金额
+	Plans []string   `json:"plans" gorm:"column:plans;type:text;serializer:json"` // 可用套餐，为空表示全部
+
+	ExpireAt  *time.Time `json:"expireAt" gorm:"column:expire_at"`
+	MaxRedeem int        `json:"maxRedeem" gorm:"column:max_redeem;default:0"` // 总兑换次数上限，0 表示不限
+	PerUser   int        `json:"perUser" gorm:"column:per_user;default:0"`     // 每个用户可用次数，0 表示不限
+	Redeemed  int        `json:"redeemed" gorm:"column:redeemed;default:0"`    // 已兑换次数
+	Enabled   bool       `json:"enabled" gorm:"column:enabled"`
+	Remark    string     `json:"remark" gorm:"column:remark;type:varchar(256)"`
+
+	gorm.Model
+}
+
+func (m CouponModel) TableName() string {
+	return "llm_coupon"
+}
+
+// CouponRedemptionModel 优惠券使用记录，订单取消时删除
+type CouponRedemptionModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	CouponID uint64  `json:"couponId" gorm:"column:coupon_id;index:idx_coupon_user;not null"`
+	UserID   uint64  `json:"userId" gorm:"column:user_id;index:idx_coupon_user;not null"`
+	OrderID  string  `json:"orderId" gorm:"column:order_id;type:varchar(256);uniqueIndex;not null"`
+	Discount float64 `json:"discount" gorm:"column:discount;type:double;not null"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (m CouponRedemptionModel) TableName() string {
+	return "llm_coupon_redemption"
+}
+
+// CouponRequest 管理员新增或更新优惠券
+type CouponRequest struct {
+	Code      string     `json:"code" binding:"required"`
+	Kind      CouponKind `json:"kind" binding:"required,oneof=percent fixed"`
+	Value     float64    `json:"value" binding:"required,gt=0"`
+	Plans     []string   `json:"plans"`
+	ExpireAt  *time.Time `json:"expireAt"`
+	MaxRedeem int        `json:"maxRedeem" binding:"min=0"`
+	PerUser   int        `json:"perUser" binding:"min=0"`
+	Enabled   bool       `json:"enabled"`
+	Remark    string     `json:"remark"`
+}
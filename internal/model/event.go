@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventResult 支付回调事件的处理结果
+type EventResult string
+
+const (
+	EventPending   EventResult = "pending"   // 已接收，处理中
+	EventProcessed EventResult = "processed" // 已处理
+	EventIgnored   EventResult = "ignored"   // 无需处理
+	EventFailed    EventResult = "failed"    // 处理失败，渠道重试或管理员重放时重新处理
+	EventRejected  EventResult = "rejected"  // 签名校验失败
+)
+
+// PaymentEventModel 支付回调事件，按渠道和事件ID去重
+type PaymentEventModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	Method  method `json:"method" gorm:"column:method;type:varchar(20);uniqueIndex:idx_method_event"`
+	EventID string `json:"eventId" gorm:"column:event_id;type:varchar(128);uniqueIndex:idx_method_event"`
+	Type    string `json:"type" gorm:"column:type;type:varchar(64)"`
+	OrderID string `json:"orderId" gorm:"column:order_id;type:varchar(256);index"`
+	Status  string `json:"status" gorm:"column:status;type:varchar(20)"` // 归一后的事件状态
+
+	Payload  string `json:"payload" gorm:"column:payload;type:text"` // 原始请求体
+	Event    string `json:"event" gorm:"column:event;type:text"`     // 解析后的事件，用于重放
+	Verified bool   `json:"verified" gorm:"column:verified"`         // 签名是否校验通过
+
+	Result      EventResult `json:"result" gorm:"column:result;type:varchar(10);index"`
+	Error       string      `json:"error" gorm:"column:error;type:text"`
+	Attempts    int         `json:"attempts" gorm:"column:attempts;default:0"`
+	ProcessedAt *time.Time  `json:"processedAt" gorm:"column:processed_at"`
+
+	gorm.Model
+}
+
+func (m PaymentEventModel) TableName() string {
+	return "llm_payment_event"
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JobStatus 定时任务单次运行的状态
+type JobStatus string
+
+const (
+	JobRunning JobStatus = "running" // 运行中
+	JobSucceed JobStatus = "succeed" // 运行完成
+	JobFailed  JobStatus = "failed"  // 运行出错，部分数据可能已处理
+)
+
+// JobRunModel 定时任务的运行记录
+type JobRunModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	Name     string    `json:"name" gorm:"column:name;type:varchar(64);index;not null"`
+	Instance string    `json:"instance" gorm:"column:instance;type:varchar(128)"` // 执行任务的实例
+	Status   JobStatus `json:"status" gorm:"column:status;type:varchar(10);index"`
+
+	Processed int    `json:"processed" gorm:"column:processed;default:0"` // 处理成功的数量
+	Failed    int    `json:"failed" gorm:"column:failed;default:0"`       // 处理失败的数量
+	Message   string `json:"message" gorm:"column:message;type:text"`     // 失败原因等说明
+
+	StartedAt  time.Time  `json:"startedAt" gorm:"column:started_at"`
+	FinishedAt *time.Time `json:"finishedAt" gorm:"column:finished_at"`
+	Duration   int64      `json:"duration" gorm:"column:duration;default:0"` // 耗时（毫秒）
+
+	gorm.Model
+}
+
+func (m JobRunModel) TableName() string {
+	return "llm_job_run"
+}
+
+// JobInfo 已注册的定时任务及其最近一次运行
+type JobInfo struct {
+	Name     string       `json:"name"`
+	Interval string       `json:"interval"`
+	LastRun  *JobRunModel `json:"lastRun,omitempty"`
+}
+
+// JobStatusResponse 定时任务状态
+type JobStatusResponse struct {
+	Instance string    `json:"instance"` // 当前实例
+	Leader   bool      `json:"leader"`   // 当前实例是否负责执行任务
+	Jobs     []JobInfo `json:"jobs"`
+}
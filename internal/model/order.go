@@ -14,21 +14,112 @@ type PlanInfo struct {
 	Name     string   `json:"name" binding:"required"`
 	Brief    string   `json:"brief" binding:"required"`
 	Price    float64  `json:"price" binding:"required"`
-	Usage    string   `json:"usage" binding:"required"`  // 用量
+	Currency string   `json:"currency,omitempty"`        // 结算币种，为空时使用默认币种
+	Usage    string   `json:"usage"`                     // 用量说明，未设置权益时按此解析
 	Period   string   `json:"period" binding:"required"` // 周期
 	Enabled  bool     `json:"enabled" binding:"required"`
 	Features []string `json:"features" binding:"required"`
+
+	Sort     int  `json:"sort"`     // 展示顺序，从小到大
+	Archived bool `json:"archived"` // 已下架：不再售卖，已购用户不受影响
+
+	Products map[PaymentMethod]PlanProduct `json:"products,omitempty"` // 各支付渠道的产品
+
+	Entitlements *PlanEntitlements `json:"entitlements,omitempty"` // 套餐权益
+
+	Cache *PlanCache `json:"cache,omitempty"` // 响应缓存
+
+	Multiplier float64 `json:"multiplier,omitempty"` // 费用倍率，0 视为 1
+
+	CustomAmount bool `json:"customAmount,omitempty"` // 允许用户自定义金额，不低于套餐价格
+}
+
+// PlanProduct 套餐在支付渠道中对应的产品或价格ID
+type PlanProduct struct {
+	ProductID      string `json:"productId,omitempty"`      // 一次性购买
+	SubscriptionID string `json:"subscriptionId,omitempty"` // 自动续费
+}
+
+// PlanEntitlements 套餐权益，数值为 0 表示不限制
+type PlanEntitlements struct {
+	DailyTokens   uint64 `json:"dailyTokens,omitempty"`
+	MonthlyTokens uint64 `json:"monthlyTokens,omitempty"`
+
+	DailyRequests   uint64 `json:"dailyRequests,omitempty"`
+	MonthlyRequests uint64 `json:"monthlyRequests,omitempty"`
+
+	DailyProjects   uint64 `json:"dailyProjects,omitempty"`
+	MonthlyProjects uint64 `json:"monthlyProjects,omitempty"`
+
+	DailyCost   float64 `json:"dailyCost,omitempty"`
+	MonthlyCost float64 `json:"monthlyCost,omitempty"`
+
+	RPM         int `json:"rpm,omitempty"`
+	TPM         int `json:"tpm,omitempty"`
+	Concurrency int `json:"concurrency,omitempty"`
+
+	Models     []string `json:"models,omitempty"`     // 可用模型，支持 * 通配，为空表示全部
+	DenyModels []string `json:"denyModels,omitempty"` // 禁用模型，优先于可用模型
+	MaxContext int      `json:"maxContext,omitempty"` // 单次请求提示词的最大 Token 数
+	MaxTokens  int      `json:"maxTokens,omitempty"`  // max_tokens 上限
+
+	Flags map[string]bool `json:"flags,omitempty"` // 功能开关，未配置的功能默认开启
+}
+
+// 套餐功能开关
+const (
+	FlagStream = "stream" // 流式响应
+	FlagCache  = "cache"  // 响应缓存
+)
+
+// RateLimit 套餐权益中的速率限制
+func (e *PlanEntitlements) RateLimit() *RateLimit {
+	if e == nil {
+		return nil
+	}
+	return &RateLimit{RPM: e.RPM, TPM: e.TPM, Concurrency: e.Concurrency}
+}
+
+// HasFlag 是否开启了指定功能，只有显式设置为 false 时才关闭
+func (e *PlanEntitlements) HasFlag(name string) bool {
+	if e == nil {
+		return true
+	}
+	enabled, ok := e.Flags[name]
+	return !ok || enabled
+}
+
+// PlanCache 套餐的响应缓存设置
+type PlanCache struct {
+	Enabled bool    `json:"enabled"`
+	TTL     int     `json:"ttl"`  // 缓存有效期（秒）
+	Rate    float64 `json:"rate"` // 命中缓存的计费比例，0 表示不计费
 }
 
 // OrderRequest 支付请求
 type OrderRequest struct {
-	PayPlan PayPlan `json:"payPlan" binding:"required"`
-	Method  method  `json:"method" binding:"required"`
+	Kind    OrderKind `json:"kind,omitempty"` // 默认为 plan
+	PayPlan PayPlan   `json:"payPlan" binding:"required_unless=Kind topup"`
+	Method  method    `json:"method" binding:"required"`
 
 	Amount *float64 `json:"amount,omitempty"` // 基础版可自定义金额
 	UserId *uint64  `json:"-,omitempty"`
+	Credit float64  `json:"-"` // 升级抵扣金额，由报价计算
+
+	CouponCode string `json:"couponCode,omitempty"` // 优惠码
+
+	Scene PayScene `json:"scene,omitempty" binding:"omitempty,oneof=qrcode page wap"` // 为空时按 User-Agent 判断
 }
 
+// PayScene 支付场景，决定渠道的下单方式
+type PayScene string
+
+const (
+	SceneQRCode PayScene = "qrcode" // 扫码支付
+	ScenePage   PayScene = "page"   // 电脑网站跳转支付
+	SceneWap    PayScene = "wap"    // 手机网站跳转支付
+)
+
 // OrderResponse 支付响应
 type OrderResponse struct {
 	OrderID string  `json:"orderId"`
@@ -37,25 +128,41 @@ type OrderResponse struct {
 	QRCode  string  `json:"qrcode"`
 	Status  string  `json:"status"`
 	Method  string  `json:"method"`
+
+	Currency   string  `json:"currency"`
+	OrigAmount float64 `json:"origAmount,omitempty"` // 优惠前金额
+	Discount   float64 `json:"discount,omitempty"`   // 优惠金额
 }
 
 // OrderModel 支付订单
 type OrderModel struct {
 	ID uint64 `json:"id" gorm:"primarykey"`
 
-	UserID  uint64  `json:"userId" gorm:"column:user_id;index;not null"`
-	OrderID string  `json:"orderId" gorm:"column:order_id;type:varchar(256);uniqueIndex;not null"`
-	ThridID string  `json:"thridId" gorm:"column:thrid_id;type:varchar(256);index"`
-	PayPlan PayPlan `json:"payPlan" gorm:"column:pay_plan;type:varchar(20)"`
-	Amount  float64 `json:"amount" gorm:"column:amount;type:double;not null"`
-	Method  method  `json:"method" gorm:"column:method;type:varchar(20)"`
-	PayURL  string  `json:"payurl" gorm:"column:pay_url;type:text"`
-	QRCode  string  `json:"qrcode" gorm:"column:qrcode;type:text"`
+	UserID  uint64    `json:"userId" gorm:"column:user_id;index;not null"`
+	OrderID string    `json:"orderId" gorm:"column:order_id;type:varchar(256);uniqueIndex;not null"`
+	ThridID string    `json:"thridId" gorm:"column:thrid_id;type:varchar(256);index"`
+	PayPlan PayPlan   `json:"payPlan" gorm:"column:pay_plan;type:varchar(20)"`
+	Kind    OrderKind `json:"kind" gorm:"column:kind;type:varchar(10);default:plan"`
+	Amount  float64   `json:"amount" gorm:"column:amount;type:double;not null"`
+	Credit  float64   `json:"credit" gorm:"column:credit;type:double;default:0"` // 升级抵扣金额
+
+	Currency   string  `json:"currency" gorm:"column:currency;type:varchar(3)"`            // 结算币种（ISO 4217）
+	OrigAmount float64 `json:"origAmount" gorm:"column:orig_amount;type:double;default:0"` // 优惠前金额
+	Discount   float64 `json:"discount" gorm:"column:discount;type:double;default:0"`      // 优惠金额
+	Coupon     string  `json:"coupon" gorm:"column:coupon;type:varchar(64)"`               // 使用的优惠码
+	Refunded   float64 `json:"refunded" gorm:"column:refunded;type:double;default:0"`      // 已退款金额
+
+	Method  method   `json:"method" gorm:"column:method;type:varchar(20)"`
+	Scene   PayScene `json:"scene" gorm:"column:scene;type:varchar(10)"`
+	Product string   `json:"product" gorm:"column:product;type:varchar(128)"` // 支付渠道的产品或价格ID
+	PayURL  string   `json:"payurl" gorm:"column:pay_url;type:text"`
+	QRCode  string   `json:"qrcode" gorm:"column:qrcode;type:text"`
 
 	SucceedAt *time.Time `json:"succeedAt" gorm:"column:succeed_at"`
 	ExpiredAt time.Time  `json:"expiredAt" gorm:"column:expired_at"`
 
-	Status OrderStatus `json:"status" gorm:"column:status;type:varchar(10)"` // pending, success, failed, canceled
+	Status OrderStatus `json:"status" gorm:"column:status;type:varchar(20)"` // 状态流转见 OrderStatus.CanTransit
+	Period *ApiLimit   `json:"-" gorm:"-"`                                   // 自动续费订单的套餐周期，下单时设置，不入库
 
 	User UserModel `json:"user" gorm:"column:user_id;foreignKey:UserID"`
 
@@ -66,6 +173,100 @@ func (m OrderModel) TableName() string {
 	return "llm_order"
 }
 
+// OrderSource 订单状态变更的来源
+type OrderSource string
+
+const (
+	OrderSourceUser    OrderSource = "user"    // 用户下单、查询
+	OrderSourceWebhook OrderSource = "webhook" // 支付回调
+	OrderSourceQuery   OrderSource = "query"   // 主动查询支付渠道
+	OrderSourceAdmin   OrderSource = "admin"   // 管理员操作
+	OrderSourceJob     OrderSource = "job"     // 定时任务
+)
+
+// OrderChange 描述一次订单状态变更的操作者和原因
+type OrderChange struct {
+	Source OrderSource
+	Actor  string // 用户、管理员或支付渠道标识
+	Remark string
+}
+
+// OrderHistoryModel 订单状态变更记录
+type OrderHistoryModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	OrderID string      `json:"orderId" gorm:"column:order_id;type:varchar(256);index;not null"`
+	From    OrderStatus `json:"from" gorm:"column:from_status;type:varchar(20)"`
+	To      OrderStatus `json:"to" gorm:"column:to_status;type:varchar(20);not null"`
+	Source  OrderSource `json:"source" gorm:"column:source;type:varchar(10);not null"`
+	Actor   string      `json:"actor" gorm:"column:actor;type:varchar(64)"`
+	Remark  string      `json:"remark" gorm:"column:remark;type:varchar(256)"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (m OrderHistoryModel) TableName() string {
+	return "llm_order_history"
+}
+
+// RefundStatus 退款状态
+type RefundStatus string
+
+const (
+	RefundPending RefundStatus = "pending" // 已提交渠道
+	RefundSucceed RefundStatus = "succeed" // 退款完成
+	RefundFailed  RefundStatus = "failed"  // 渠道退款失败
+)
+
+// RefundModel 订单退款记录，每次退款一条
+type RefundModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	RefundID string       `json:"refundId" gorm:"column:refund_id;type:varchar(64);uniqueIndex;not null"` // 提交渠道的退款单号
+	OrderID  string       `json:"orderId" gorm:"column:order_id;type:varchar(256);index;not null"`
+	Amount   float64      `json:"amount" gorm:"column:amount;type:double;not null"`
+	Currency string       `json:"currency" gorm:"column:currency;type:varchar(3)"`
+	Reason   string       `json:"reason" gorm:"column:reason;type:varchar(256)"`
+	Status   RefundStatus `json:"status" gorm:"column:status;type:varchar(10);index"`
+	Reversal string       `json:"reversal" gorm:"column:reversal;type:varchar(256)"` // 套餐或余额的回滚结果
+	Actor    string       `json:"actor" gorm:"column:actor;type:varchar(64)"`
+	Source   OrderSource  `json:"source" gorm:"column:source;type:varchar(10);default:admin"` // 发起方：管理员或渠道回调
+	Error    string       `json:"error" gorm:"column:error;type:text"`
+
+	gorm.Model
+}
+
+func (m RefundModel) TableName() string {
+	return "llm_order_refund"
+}
+
+// RefundRequest 管理员退款请求，金额为空时退还剩余全部金额
+type RefundRequest struct {
+	Amount float64 `json:"amount" binding:"min=0"`
+	Reason string  `json:"reason" binding:"required"`
+}
+
+// MockOutcome 模拟支付订单的结果
+type MockOutcome string
+
+const (
+	MockSuccess MockOutcome = "success" // 查询即支付成功
+	MockFailure MockOutcome = "failure" // 支付失败，订单取消
+	MockDelay   MockOutcome = "delay"   // 下单一段时间后支付成功
+	MockExpiry  MockOutcome = "expiry"  // 始终未支付，由超时关单任务关闭
+)
+
+// MockOutcomeRequest 设置模拟支付订单的结果
+type MockOutcomeRequest struct {
+	Outcome MockOutcome `json:"outcome" binding:"required,oneof=success failure delay expiry"`
+}
+
+// MockWebhookRequest 为订单发送模拟支付回调，金额为空时使用订单金额
+type MockWebhookRequest struct {
+	Status string   `json:"status" binding:"required,oneof=success failed cancelled refunded"`
+	Amount *float64 `json:"amount,omitempty" binding:"omitempty,min=0"`
+}
+
 type VerifyModel struct {
 	ID uint64 `json:"id" gorm:"primarykey"`
 
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PlanChangeModel 用户套餐变更记录
+type PlanChangeModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	UserID  uint64 `json:"userId" gorm:"column:user_id;index;not null"`
+	Reason  string `json:"reason" gorm:"column:reason;type:varchar(32);index"` // expired, upgrade, downgrade
+	OrderID string `json:"orderId" gorm:"column:order_id;type:varchar(256);index"`
+
+	FromPlan   PayPlan    `json:"fromPlan" gorm:"column:from_plan;type:varchar(20)"`
+	FromLimit  *ApiLimit  `json:"fromLimit" gorm:"column:from_limit;serializer:json"`
+	FromExpire *time.Time `json:"fromExpire" gorm:"column:from_expire"`
+
+	ToPlan   PayPlan    `json:"toPlan" gorm:"column:to_plan;type:varchar(20)"`
+	ToLimit  *ApiLimit  `json:"toLimit" gorm:"column:to_limit;serializer:json"`
+	ToExpire *time.Time `json:"toExpire" gorm:"column:to_expire"`
+
+	// 预约变更（降级）在当前周期结束时生效，立即生效的变更 Status 为空
+	Status      PlanChangeStatus `json:"status" gorm:"column:status;type:varchar(10);index"`
+	EffectiveAt *time.Time       `json:"effectiveAt" gorm:"column:effective_at"`
+
+	gorm.Model
+}
+
+// PlanChangeStatus 预约变更状态
+type PlanChangeStatus string
+
+const (
+	PlanChangePending  PlanChangeStatus = "pending"
+	PlanChangeApplied  PlanChangeStatus = "applied"
+	PlanChangeCanceled PlanChangeStatus = "canceled"
+)
+
+// PlanAction 购买套餐的变更类型
+type PlanAction string
+
+const (
+	PlanActionNew       PlanAction = "new"       // 新购或已过期重新购买
+	PlanActionRenew     PlanAction = "renew"     // 续费当前套餐，顺延有效期
+	PlanActionUpgrade   PlanAction = "upgrade"   // 升级，立即生效并抵扣剩余价值
+	PlanActionDowngrade PlanAction = "downgrade" // 降级，当前周期结束后生效
+)
+
+// PlanQuoteRequest 套餐报价请求
+type PlanQuoteRequest struct {
+	PayPlan PayPlan `json:"payPlan" binding:"required"`
+}
+
+// PlanQuote 套餐变更报价
+type PlanQuote struct {
+	Action   PlanAction `json:"action"`
+	FromPlan PayPlan    `json:"fromPlan"`
+	ToPlan   PayPlan    `json:"toPlan"`
+
+	Price  float64 `json:"price"`  // 目标套餐价格
+	Credit float64 `json:"credit"` // 当前套餐剩余价值抵扣
+	Amount float64 `json:"amount"` // 实际应付金额
+
+	EffectiveAt time.Time `json:"effectiveAt"` // 生效时间
+	ExpireAt    time.Time `json:"expireAt"`    // 生效后的到期时间
+}
+
+func (m PlanChangeModel) TableName() string {
+	return "llm_plan_change"
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SubscriptionStatus 订阅状态
+type SubscriptionStatus string
+
+const (
+	SubscriptionActive   SubscriptionStatus = "active"   // 正常续费中
+	SubscriptionPastDue  SubscriptionStatus = "past_due" // 续费失败，等待重试
+	SubscriptionCanceled SubscriptionStatus = "canceled" // 已终止
+)
+
+// SubscriptionModel 自动续费订阅，由支付平台回调驱动状态变化
+type SubscriptionModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	UserID   uint64  `json:"userId" gorm:"column:user_id;index;not null"`
+	OrderID  string  `json:"orderId" gorm:"column:order_id;type:varchar(256);index"` // 首次订阅的订单
+	ThridID  string  `json:"thridId" gorm:"column:thrid_id;type:varchar(256);uniqueIndex"`
+	Customer string  `json:"customer" gorm:"column:customer;type:varchar(256)"`
+	PayPlan  PayPlan `json:"payPlan" gorm:"column:pay_plan;type:varchar(20)"`
+	Method   method  `json:"method" gorm:"column:method;type:varchar(20)"`
+
+	Status SubscriptionStatus `json:"status" gorm:"column:status;type:varchar(10);index"`
+
+	CurrentPeriodStart *time.Time `json:"currentPeriodStart" gorm:"column:current_period_start"`
+	CurrentPeriodEnd   *time.Time `json:"currentPeriodEnd" gorm:"column:current_period_end"`
+	CancelAtPeriodEnd  bool       `json:"cancelAtPeriodEnd" gorm:"column:cancel_at_period_end"`
+	CanceledAt         *time.Time `json:"canceledAt" gorm:"column:canceled_at"`
+
+	gorm.Model
+}
+
+func (m SubscriptionModel) TableName() string {
+	return "llm_subscription"
+}
@@ -27,6 +27,18 @@ type UserModel struct {
 	ApiUsage *ApiUsage  `json:"apiUsage" gorm:"column:api_usage;serializer:json"`
 	ApiLimit *ApiLimit  `json:"apiLimit" gorm:"column:api_limit;serializer:json"`
 
+	// 计费周期锚点：套餐购买或生效时间，用量按此时间起每月滚动
+	CycleAnchor *time.Time `json:"cycleAnchor" gorm:"column:cycle_anchor;default:null"`
+
+	// 钱包余额
+	Balance float64 `json:"balance" gorm:"column:balance;type:double;not null;default:0"`
+
+	// 用户级速率限制，非零字段覆盖套餐设置
+	RateLimit *RateLimit `json:"rateLimit" gorm:"column:rate_limit;serializer:json"`
+
+	// 用户级模型访问控制，优先于套餐设置
+	ModelAccess *ModelAccess `json:"modelAccess" gorm:"column:model_access;serializer:json"`
+
 	gorm.Model
 }
 
@@ -79,6 +91,10 @@ type UpdateUserRequest struct {
 
 	DailyLimit   *int64 `json:"dailyLimit,omitempty"`
 	MonthlyLimit *int64 `json:"monthlyLimit,omitempty"`
+
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+
+	ModelAccess *ModelAccess `json:"modelAccess,omitempty"`
 }
 
 // UserResponse 用户信息响应
@@ -96,6 +112,11 @@ type UserResponse struct {
 	ApiUsage *ApiUsage  `json:"apiUsage"`
 	ApiLimit *ApiLimit  `json:"apiLimit"`
 
+	RateLimit *RateLimit `json:"rateLimit"`
+	Balance   float64    `json:"balance"`
+
+	ModelAccess *ModelAccess `json:"modelAccess"`
+
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
@@ -112,8 +133,12 @@ func (u *UserModel) ToUserResponse() *UserResponse {
 		UserRole:  u.UserRole,
 		UserPlan:  u.UserPlan,
 		ExpireAt:  u.ExpireAt,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		RateLimit: u.RateLimit,
+		Balance:   u.Balance,
+
+		ModelAccess: u.ModelAccess,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
 	}
 }
 
@@ -156,11 +181,27 @@ type ApiUsage struct {
 	TodayTokens   uint64 `json:"todayTokens"`
 	TodayRequests uint64 `json:"todayRequests"`
 	TodayProjects uint64 `json:"todayProjects"`
+
+	TotalCost float64 `json:"totalCost"`
+	TodayCost float64 `json:"todayCost"`
+
+	// 统计时所在的窗口，窗口滚动后旧的用量不再计入限制
+	DayStart   *time.Time `json:"dayStart,omitempty"`
+	CycleStart *time.Time `json:"cycleStart,omitempty"`
+	CycleEnd   *time.Time `json:"cycleEnd,omitempty"`
+}
+
+// UsageWindow 用量窗口：当日与当前计费周期
+type UsageWindow struct {
+	DayStart   time.Time `json:"dayStart"`
+	CycleStart time.Time `json:"cycleStart"`
+	CycleEnd   time.Time `json:"cycleEnd"`
 }
 type ApiLimit struct {
-	// 过期天数
-	ExpireDays int `json:"expireDays,omitempty"`
-	// 限制方法：tokens, requests, projects
+	// 套餐周期：月数 + 天数
+	ExpireDays   int `json:"expireDays,omitempty"`
+	ExpireMonths int `json:"expireMonths,omitempty"`
+	// 主要限制方法：tokens, requests, projects, cost，各项上限独立生效
 	LimitMethod string `json:"limitMethod,omitempty"`
 
 	DailyTokens   uint64 `json:"dailyTokens,omitempty"`
@@ -171,6 +212,32 @@ type ApiLimit struct {
 
 	DailyProjects   uint64 `json:"dailyProjects,omitempty"`
 	MonthlyProjects uint64 `json:"monthlyProjects,omitempty"`
+
+	DailyCost   float64 `json:"dailyCost,omitempty"`
+	MonthlyCost float64 `json:"monthlyCost,omitempty"`
+}
+
+// RateLimit 速率限制：每分钟请求数、每分钟 Token 数、最大并发数，0 表示不限制
+type RateLimit struct {
+	RPM         int `json:"rpm,omitempty"`
+	TPM         int `json:"tpm,omitempty"`
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// IsZero 是否未设置任何限制
+func (r *RateLimit) IsZero() bool {
+	return r == nil || (r.RPM == 0 && r.TPM == 0 && r.Concurrency == 0)
+}
+
+// ModelAccess 模型访问控制：允许和禁用的模型，支持 * 通配
+type ModelAccess struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// IsZero 是否未设置任何规则
+func (m *ModelAccess) IsZero() bool {
+	return m == nil || (len(m.Allow) == 0 && len(m.Deny) == 0)
 }
 
 // Value implements driver.Valuer interface for ApiUsage
@@ -214,3 +281,24 @@ func (a *ApiLimit) Scan(value interface{}) error {
 		return nil
 	}
 }
+
+// Value implements driver.Valuer interface for RateLimit
+func (r RateLimit) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// Scan implements sql.Scanner interface for RateLimit
+func (r *RateLimit) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return nil
+	}
+}
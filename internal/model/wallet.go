@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// LedgerKind 钱包流水类型
+type LedgerKind string
+
+const (
+	LedgerTopup  LedgerKind = "topup"  // 充值
+	LedgerUsage  LedgerKind = "usage"  // 用量扣费
+	LedgerRefund LedgerKind = "refund" // 退款
+	LedgerAdjust LedgerKind = "adjust" // 管理员调整
+)
+
+// WalletLedgerModel 钱包流水，只追加不修改
+type WalletLedgerModel struct {
+	ID uint64 `json:"id" gorm:"primarykey"`
+
+	UserID  uint64     `json:"userId" gorm:"column:user_id;index;not null"`
+	Kind    LedgerKind `json:"kind" gorm:"column:kind;type:varchar(10);index;not null"`
+	Amount  float64    `json:"amount" gorm:"column:amount;type:double;not null"`   // 变动金额，正数入账、负数扣减
+	Balance float64    `json:"balance" gorm:"column:balance;type:double;not null"` // 变动后余额
+	RefID   string     `json:"refId" gorm:"column:ref_id;type:varchar(256);index"` // 关联订单号或请求号
+	Remark  string     `json:"remark" gorm:"column:remark;type:varchar(256)"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (m WalletLedgerModel) TableName() string {
+	return "llm_wallet_ledger"
+}
+
+// WalletAdjustRequest 管理员调整余额请求
+type WalletAdjustRequest struct {
+	Amount float64 `json:"amount" binding:"required"`
+	Remark string  `json:"remark"`
+}
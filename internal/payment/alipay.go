@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -22,6 +23,15 @@ type AlipayPayment struct {
 	config *config.Alipay
 }
 
+func init() {
+	Register(Provider{
+		Method: model.PaymentAlipay, Name: "支付宝", Icon: "fab fa-alipay", Color: "#1677FF",
+		Refund: true, QRCode: true,
+		Enabled: configured(config.GetAlipayConfig),
+		New:     func() IPayment { return NewAlipayPayment() },
+	})
+}
+
 // NewAlipayPayment 创建支付宝支付实例
 func NewAlipayPayment() *AlipayPayment {
 	return &AlipayPayment{}
@@ -38,53 +48,89 @@ func (p *AlipayPayment) ensureClientReady() error {
 	if provider == nil {
 		return consts.ErrPaymentProviderNotConfigured
 	}
+	if provider.PublicKey == "" && provider.PublicCert == "" {
+		return fmt.Errorf("%w: alipay public key or cert required", consts.ErrPaymentConfigIncomplete)
+	}
 
 	// 创建支付宝客户端
-	client, err := alipay.NewClient(provider.AppID, provider.Token, false) // false表示沙箱环境
+	client, err := alipay.NewClient(provider.AppID, provider.Token, provider.Live)
 	if err != nil {
 		return fmt.Errorf("%w: %v", consts.ErrPaymentClientCreationFailed, err)
 	}
+	client.SetCharset(alipay.UTF8).SetSignType(alipay.RSA2).
+		SetNotifyUrl(provider.NotifyURL).SetReturnUrl(provider.ReturnURL)
 
-	// 设置支付宝公钥证书和根证书（如果有的话）
-	// client.SetCertSnFromPath("appCertPublicKey.crt", "alipayRootCert.crt", "alipayCertPublicKey_RSA2.crt")
+	// 证书模式设置证书序列号，并校验同步响应的签名
+	if provider.PublicCert != "" {
+		err := client.SetCertSnByPath(provider.AppCert, provider.RootCert, provider.PublicCert)
+		if err != nil {
+			return fmt.Errorf("%w: %v", consts.ErrPaymentClientCreationFailed, err)
+		}
+		cert, err := os.ReadFile(provider.PublicCert)
+		if err != nil {
+			return fmt.Errorf("%w: %v", consts.ErrPaymentClientCreationFailed, err)
+		}
+		client.AutoVerifySign(cert)
+	}
 
 	p.client = client
 	p.config = provider
 	return nil
 }
 
-// Create 创建支付订单
+// Create 创建支付订单，按支付场景选择当面付扫码、电脑网站或手机网站支付
 func (p *AlipayPayment) Create(order *model.OrderModel) error {
 	// 检查配置和初始化客户端
 	if err := p.ensureClientReady(); err != nil {
 		return err
 	}
 
-	// 生成订单ID
-	orderID := fmt.Sprintf("alipay_%d", time.Now().UnixNano())
+	// 支付宝按人民币结算
+	if err := requireCurrency(order, "CNY"); err != nil {
+		return err
+	}
 
-	// 创建支付请求参数
+	// 创建支付请求参数，以订单号作为商户订单号，查询、关单和退款共用
 	bodyMap := make(gopay.BodyMap)
 	bodyMap.Set("subject", fmt.Sprintf("%s套餐", order.PayPlan))
-	bodyMap.Set("out_trade_no", orderID)
-	bodyMap.Set("product_code", "QUICK_WAP_WAY")
-	bodyMap.Set("total_amount", fmt.Sprintf("%.2f", order.Amount))
-	bodyMap.Set("return_url", "http://localhost:8080/payment?status=success")
-	bodyMap.Set("notify_url", "http://localhost:8080/api/payment/alipay/notify")
-
-	// 生成支付URL
-	payURL, err := p.client.TradeWapPay(context.Background(), bodyMap)
-	if err != nil {
-		log.Printf("[alipay][%s] failed to create payment: %v", order.OrderID, err)
-		return fmt.Errorf("%w: %v", consts.ErrPaymentCreationFailed, err)
+	bodyMap.Set("out_trade_no", order.OrderID)
+	bodyMap.Set("total_amount", formatAmount(order.Amount, "CNY"))
+	bodyMap.Set("time_expire", order.ExpiredAt.Format(time.DateTime))
+
+	ctx := context.Background()
+	switch order.Scene {
+	case model.SceneQRCode:
+		result, err := p.client.TradePrecreate(ctx, bodyMap)
+		if err != nil {
+			log.Printf("[alipay][%s] failed to create payment: %v", order.OrderID, err)
+			return fmt.Errorf("%w: %v", consts.ErrPaymentCreationFailed, err)
+		}
+		// 二维码内容存入支付链接，由二维码接口生成图片
+		order.PayURL = result.Response.QrCode
+		order.QRCode = "/api/order/qrcode/" + order.OrderID
+	case model.SceneWap:
+		bodyMap.Set("product_code", "QUICK_WAP_WAY")
+		bodyMap.Set("quit_url", p.config.ReturnURL)
+		payURL, err := p.client.TradeWapPay(ctx, bodyMap)
+		if err != nil {
+			log.Printf("[alipay][%s] failed to create payment: %v", order.OrderID, err)
+			return fmt.Errorf("%w: %v", consts.ErrPaymentCreationFailed, err)
+		}
+		order.PayURL = payURL
+	default:
+		bodyMap.Set("product_code", "FAST_INSTANT_TRADE_PAY")
+		payURL, err := p.client.TradePagePay(ctx, bodyMap)
+		if err != nil {
+			log.Printf("[alipay][%s] failed to create payment: %v", order.OrderID, err)
+			return fmt.Errorf("%w: %v", consts.ErrPaymentCreationFailed, err)
+		}
+		order.PayURL = payURL
 	}
 
-	log.Printf("[alipay][%s] payment created successfully", order.OrderID)
+	log.Printf("[alipay][%s] payment created successfully, scene: %s", order.OrderID, order.Scene)
 
-	order.PayURL = payURL
 	order.Method = model.PaymentAlipay
 	order.Status = model.PaymentPending
-	order.ExpiredAt = time.Now().Add(30 * time.Minute)
 	return nil
 }
 
@@ -100,6 +146,10 @@ func (p *AlipayPayment) Query(order *model.OrderModel) error {
 	bodyMap.Set("out_trade_no", order.OrderID)
 
 	result, err := p.client.TradeQuery(context.Background(), bodyMap)
+	if tradeNotExist(err) { // 扫码前交易尚未创建
+		order.Status = model.PaymentPending
+		return nil
+	}
 	if err != nil {
 		log.Printf("[alipay][%s] payment query failed: %v", order.OrderID, err)
 		return fmt.Errorf("%w: %v", consts.ErrPaymentQueryFailed, err)
@@ -109,6 +159,12 @@ func (p *AlipayPayment) Query(order *model.OrderModel) error {
 	if result.Response != nil {
 		switch result.Response.TradeStatus {
 		case "TRADE_SUCCESS", "TRADE_FINISHED":
+			// 以订单金额为准，渠道实收金额不一致时不入账
+			amount, _ := strconv.ParseFloat(result.Response.TotalAmount, 64)
+			if err := MatchAmount(order, amount, ""); err != nil {
+				log.Printf("[alipay][%s] %v", order.OrderID, err)
+				return err
+			}
 			order.Status = model.PaymentSucceed
 			log.Printf("[alipay][%s] payment successful", order.OrderID)
 			if order.SucceedAt == nil {
@@ -142,7 +198,7 @@ func (p *AlipayPayment) Close(order *model.OrderModel) error {
 	bodyMap.Set("out_trade_no", order.OrderID)
 
 	_, err := p.client.TradeClose(context.Background(), bodyMap)
-	if err != nil {
+	if err != nil && !tradeNotExist(err) { // 未扫码的交易无需关闭
 		log.Printf("[alipay][%s] payment close failed: %v", order.OrderID, err)
 		return fmt.Errorf("%w: %v", consts.ErrPaymentCloseFailed, err)
 	}
@@ -153,7 +209,7 @@ func (p *AlipayPayment) Close(order *model.OrderModel) error {
 }
 
 // Refund 退款
-func (p *AlipayPayment) Refund(order *model.OrderModel) error {
+func (p *AlipayPayment) Refund(order *model.OrderModel, refund *model.RefundModel) error {
 	// 检查配置和初始化客户端
 	if err := p.ensureClientReady(); err != nil {
 		return err
@@ -162,8 +218,9 @@ func (p *AlipayPayment) Refund(order *model.OrderModel) error {
 	// 创建退款请求参数
 	bodyMap := make(gopay.BodyMap)
 	bodyMap.Set("out_trade_no", order.OrderID)
-	bodyMap.Set("refund_amount", strconv.FormatFloat(order.Amount, 'f', 2, 64))
-	bodyMap.Set("refund_reason", "用户申请退款")
+	bodyMap.Set("refund_amount", formatAmount(refund.Amount, "CNY"))
+	bodyMap.Set("refund_reason", refund.Reason)
+	bodyMap.Set("out_request_no", refund.RefundID) // 部分退款需要唯一的退款请求号
 
 	_, err := p.client.TradeRefund(context.Background(), bodyMap)
 	if err != nil {
@@ -172,13 +229,76 @@ func (p *AlipayPayment) Refund(order *model.OrderModel) error {
 	}
 
 	log.Printf("[alipay][%s] refund processed successfully", order.OrderID)
-	order.Status = model.PaymentRefunded
 	return nil
 }
 
-// Webhook 支付宝支付回调验证
+// Webhook 支付宝异步通知，按公钥或公钥证书验签
 func (p *AlipayPayment) Webhook(req *http.Request) (*Event, error) {
-	// TODO: 实现支付宝webhook验证逻辑
-	log.Printf("[alipay] webhook verification not implemented")
-	return nil, consts.ErrPaymentWebhookNotImplemented
+	// 检查配置和初始化客户端
+	if err := p.ensureClientReady(); err != nil {
+		return nil, err
+	}
+
+	notify, err := alipay.ParseNotifyToBodyMap(req)
+	if err != nil {
+		log.Printf("[alipay] failed to parse notify: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookEventParseFailed, err)
+	}
+	if p.config.PublicCert != "" {
+		_, err = alipay.VerifySignWithCert(p.config.PublicCert, notify)
+	} else {
+		_, err = alipay.VerifySign(p.config.PublicKey, notify)
+	}
+	if err != nil {
+		log.Printf("[alipay] notify signature verification failed: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookSignatureVerificationFailed, err)
+	}
+	if appID := notify.GetString("app_id"); appID != p.config.AppID {
+		return nil, fmt.Errorf("%w: app_id %s", consts.ErrWebhookSignatureVerificationFailed, appID)
+	}
+
+	tradeStatus := notify.GetString("trade_status")
+	log.Printf("[alipay] received notify: %s, trade_status: %s", notify.GetString("notify_id"), tradeStatus)
+
+	// 退款会以原交易状态再次通知，全额退款时交易关闭
+	refunded := notify.GetString("gmt_refund") != ""
+	var status string
+	switch {
+	case refunded && tradeStatus == "TRADE_CLOSED":
+		status = EventStatusRefunded
+	case refunded:
+		return nil, nil // 部分退款
+	case tradeStatus == "TRADE_SUCCESS" || tradeStatus == "TRADE_FINISHED":
+		status = EventStatusSuccess
+	case tradeStatus == "TRADE_CLOSED":
+		status = EventStatusCancelled
+	default: // WAIT_BUYER_PAY
+		return nil, nil
+	}
+
+	event := &Event{
+		ID: notify.GetString("notify_id"), Type: tradeStatus,
+		OrderID: notify.GetString("out_trade_no"), Status: status,
+		Time: time.Now().Unix(),
+		Data: object{"trade_no": notify.GetString("trade_no")},
+	}
+	if t, err := time.ParseInLocation(time.DateTime, notify.GetString("notify_time"), cnTimezone); err == nil {
+		event.Time = t.Unix()
+	}
+	if status == EventStatusSuccess {
+		event.Amount, _ = strconv.ParseFloat(notify.GetString("total_amount"), 64)
+		event.Currency = "CNY"
+	}
+	return event, nil
+}
+
+// WebhookAck 支付宝要求处理成功后应答纯文本 success，否则会重复通知
+func (p *AlipayPayment) WebhookAck() string {
+	return "success"
+}
+
+// tradeNotExist 交易不存在，扫码支付在用户扫码前不会创建交易
+func tradeNotExist(err error) bool {
+	bizErr, ok := alipay.IsBizError(err)
+	return ok && bizErr.SubCode == "ACQ.TRADE_NOT_EXIST"
 }
@@ -11,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"llm-member/internal/config"
@@ -127,6 +128,15 @@ type CreemCheckoutStatus struct {
 	Order *CreemOrder `json:"order,omitempty"`
 }
 
+func init() {
+	Register(Provider{
+		Method: model.PaymentCreem, Name: "Creem", Icon: "fas fa-credit-card", Color: "#6366F1",
+		Refund: true, Subscription: true,
+		Enabled: configured(config.GetCreemConfig),
+		New:     func() IPayment { return NewCreemPayment() },
+	})
+}
+
 // NewCreemPayment 创建Creem支付实例
 func NewCreemPayment() *CreemPayment {
 	baseURL := "https://api.creem.io/v1"
@@ -181,18 +191,17 @@ func (c *CreemPayment) Create(order *model.OrderModel) error {
 		// 	"localhost", order.OrderID,
 		// ),
 	}
-	switch order.PayPlan {
-	case model.PlanBasic:
-		request.ProductID = c.config.PlanBasicId
-	case model.PlanExtra:
-		request.ProductID = c.config.PlanExtraId
-	case model.PlanUltra:
-		request.ProductID = c.config.PlanUltraId
-	case model.PlanSuper:
-		request.ProductID = c.config.PlanSuperId
-	default:
+	// Creem 只能按产品定价，订阅需使用计费类型为 recurring 的产品
+	if request.ProductID = order.Product; request.ProductID == "" {
+		if order.Kind == model.OrderSubscribe {
+			return fmt.Errorf("%w: %v", consts.ErrSubscriptionNotSupported, order.PayPlan)
+		}
 		return fmt.Errorf("%w: %v", consts.ErrPaymentPlanNotSupported, order.PayPlan)
 	}
+	// 产品价格必须与订单金额一致，升级补差价、优惠后的订单无法按产品收费
+	if err := c.verifyProduct(order); err != nil {
+		return err
+	}
 
 	// 发送HTTP请求到Creem API
 	resp, err := c.makeAPIRequest("POST", "/checkouts", request)
@@ -218,6 +227,25 @@ func (c *CreemPayment) Create(order *model.OrderModel) error {
 	return nil
 }
 
+// verifyProduct 校验套餐配置的 Creem 产品价格、币种与订单一致
+func (c *CreemPayment) verifyProduct(order *model.OrderModel) error {
+	var product CreemProduct
+	url := fmt.Sprintf("/products?product_id=%s", order.Product)
+	if resp, err := c.makeAPIRequest("GET", url, nil); err != nil {
+		log.Printf("[creem][%s] product %s query failed: %v", order.OrderID, order.Product, err)
+		return fmt.Errorf("%w: %v", consts.ErrPaymentCreationFailed, err)
+	} else if err := json.Unmarshal(resp, &product); err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrResponseParseFailed, err)
+	}
+
+	amount := fromMinor(float64(product.Price), product.Currency)
+	if err := MatchAmount(order, amount, product.Currency); err != nil {
+		log.Printf("[creem][%s] product %s mismatch: %v", order.OrderID, order.Product, err)
+		return err
+	}
+	return nil
+}
+
 // Webhook Creem支付回调验证
 func (c *CreemPayment) Webhook(req *http.Request) (*Event, error) {
 	if err := c.ensureClientReady(); err != nil {
@@ -235,14 +263,23 @@ func (c *CreemPayment) Webhook(req *http.Request) (*Event, error) {
 
 	log.Printf("[creem] received webhook event type: %s, id: %s", event.EventType, event.ID)
 
-	orderID, amount, status := "", 0, "unknown"
+	// 订阅生命周期事件单独处理
+	if strings.HasPrefix(event.EventType, "subscription.") {
+		result := c.handleSubscription(event)
+		result.ID = event.ID
+		return result, nil
+	}
+
+	var amount float64
+	orderID, currency, status := "", "", "unknown"
 	switch event.EventType {
 	case "checkout.completed", "payment.succeeded", "order.completed":
-		status = "success"
-		// 从事件数据中提取订单ID和金额
+		status = EventStatusSuccess
+		// 从事件数据中提取订单ID和金额，Creem金额以最小货币单位表示
 		if data, ok := event.Object["order"].(object); ok {
+			currency, _ = data["currency"].(string)
 			if amt, exists := data["amount"].(float64); exists {
-				amount = int(amt)
+				amount = fromMinor(amt, currency)
 			}
 		}
 		// 尝试从metadata中获取订单ID
@@ -259,7 +296,7 @@ func (c *CreemPayment) Webhook(req *http.Request) (*Event, error) {
 		}
 
 	case "checkout.failed", "payment.failed", "order.failed":
-		status = "failed"
+		status = EventStatusFailed
 		// 同样提取订单信息
 		if metadata, ok := event.Object["metadata"].(object); ok {
 			if oid, exists := metadata["order_id"].(string); exists {
@@ -273,7 +310,7 @@ func (c *CreemPayment) Webhook(req *http.Request) (*Event, error) {
 		}
 
 	case "checkout.cancelled", "payment.cancelled", "order.cancelled":
-		status = "cancelled"
+		status = EventStatusCancelled
 		if metadata, ok := event.Object["metadata"].(object); ok {
 			if oid, exists := metadata["order_id"].(string); exists {
 				orderID = oid
@@ -285,6 +322,23 @@ func (c *CreemPayment) Webhook(req *http.Request) (*Event, error) {
 			}
 		}
 
+	case "refund.created":
+		status = EventStatusRefunded
+		// 退款金额以最小货币单位表示
+		currency, _ = event.Object["refund_currency"].(string)
+		if amt, exists := event.Object["refund_amount"].(float64); exists {
+			amount = fromMinor(amt, currency)
+		}
+		// 退款对象的订单信息在关联的 checkout 中
+		if checkout, ok := event.Object["checkout"].(object); ok {
+			if metadata, ok := checkout["metadata"].(object); ok {
+				orderID, _ = metadata["order_id"].(string)
+			}
+			if orderID == "" {
+				orderID, _ = checkout["request_id"].(string)
+			}
+		}
+
 	default:
 		log.Printf("[creem] unknown webhook event type: %s", event.EventType)
 		status = "unknown"
@@ -302,13 +356,98 @@ func (c *CreemPayment) Webhook(req *http.Request) (*Event, error) {
 		orderID = event.ID
 	}
 
-	log.Printf("[creem] processed webhook: order_id=%s, status=%s, amount=%d", orderID, status, amount)
+	log.Printf("[creem] processed webhook: order_id=%s, status=%s, amount=%.2f %s", orderID, status, amount, currency)
 
-	return &Event{
-		Type: event.EventType, Data: event.Object,
-		OrderID: orderID, Amount: float64(amount),
+	result := &Event{
+		ID: event.ID, Type: event.EventType, Data: event.Object,
+		OrderID: orderID, Amount: amount, Currency: strings.ToUpper(currency),
 		Status: status, Time: event.CreatedAt / 1000,
-	}, nil
+	}
+	// 订阅产品的结账完成事件携带订阅对象
+	if data, ok := event.Object["subscription"].(object); ok && status == EventStatusSuccess {
+		result.Subscription = c.parseSubscription(data)
+	}
+	return result, nil
+}
+
+// handleSubscription 处理Creem订阅事件
+func (c *CreemPayment) handleSubscription(event *CreemWebhookEvent) *Event {
+	sub := c.parseSubscription(event.Object)
+
+	var eventType string
+	switch event.EventType {
+	case "subscription.paid":
+		eventType = EventSubscriptionRenewed
+	case "subscription.canceled", "subscription.expired":
+		eventType = EventSubscriptionCanceled
+		sub.Status = "canceled"
+	default: // subscription.active, subscription.update, subscription.trialing ...
+		eventType = EventSubscriptionUpdated
+	}
+
+	var orderID string
+	if metadata, ok := event.Object["metadata"].(object); ok {
+		orderID, _ = metadata["order_id"].(string)
+	}
+
+	log.Printf("[creem] processed subscription webhook: subscription=%s, type=%s, status=%s",
+		sub.ID, event.EventType, sub.Status)
+	return &Event{
+		Type: eventType, Data: event.Object,
+		OrderID: orderID, Status: sub.Status,
+		Time: event.CreatedAt / 1000, Subscription: sub,
+	}
+}
+
+// parseSubscription 解析Creem订阅对象
+func (c *CreemPayment) parseSubscription(data object) *Subscription {
+	sub := &Subscription{}
+	sub.ID, _ = data["id"].(string)
+	switch customer := data["customer"].(type) {
+	case string:
+		sub.Customer = customer
+	case object:
+		sub.Customer, _ = customer["id"].(string)
+	}
+
+	// Creem订阅状态：active, trialing, scheduled_cancel, unpaid, paused, canceled
+	switch status, _ := data["status"].(string); status {
+	case "active", "trialing":
+		sub.Status = "active"
+	case "scheduled_cancel":
+		sub.Status, sub.CancelAtPeriodEnd = "active", true
+	case "canceled", "expired":
+		sub.Status = "canceled"
+	default:
+		sub.Status = "past_due"
+	}
+
+	if value, ok := data["current_period_start_date"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			sub.PeriodStart = t.Unix()
+		}
+	}
+	if value, ok := data["current_period_end_date"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			sub.PeriodEnd = t.Unix()
+		}
+	}
+	return sub
+}
+
+// CancelSubscription 取消Creem订阅
+func (c *CreemPayment) CancelSubscription(sub *model.SubscriptionModel) error {
+	if err := c.ensureClientReady(); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("/subscriptions/%s/cancel", sub.ThridID)
+	if _, err := c.makeAPIRequest("POST", url, nil); err != nil {
+		log.Printf("[creem][%s] cancel subscription failed: %v", sub.ThridID, err)
+		return fmt.Errorf("%w: %v", consts.ErrSubscriptionCancelFailed, err)
+	}
+	log.Printf("[creem][%s] subscription canceled", sub.ThridID)
+	return nil
 }
 
 // Query 查询Creem支付状态
@@ -340,6 +479,14 @@ func (c *CreemPayment) Query(order *model.OrderModel) error {
 
 	switch paymentStatus {
 	case "completed", "paid":
+		// 以订单金额为准，渠道实收金额不一致时不入账
+		if paid := statusResp.Order; paid != nil && paid.Amount > 0 {
+			amount := fromMinor(float64(paid.Amount), paid.Currency)
+			if err := MatchAmount(order, amount, paid.Currency); err != nil {
+				log.Printf("[creem][%s] %v", order.OrderID, err)
+				return err
+			}
+		}
 		order.Status = model.PaymentSucceed
 		log.Printf("[creem][%s] payment successful", order.OrderID)
 		if order.SucceedAt == nil {
@@ -349,9 +496,12 @@ func (c *CreemPayment) Query(order *model.OrderModel) error {
 	case "pending":
 		order.Status = model.PaymentPending
 		log.Printf("[creem][%s] payment pending", order.OrderID)
-	case "cancelled", "expired", "canceled":
+	case "cancelled", "canceled":
 		order.Status = model.PaymentCanceled
-		log.Printf("[creem][%s] payment cancelled/expired", order.OrderID)
+		log.Printf("[creem][%s] payment cancelled", order.OrderID)
+	case "expired":
+		order.Status = model.PaymentExpired
+		log.Printf("[creem][%s] payment expired", order.OrderID)
 	case "failed":
 		order.Status = model.PaymentCanceled
 		log.Printf("[creem][%s] payment failed", order.OrderID)
@@ -386,7 +536,7 @@ func (c *CreemPayment) Close(order *model.OrderModel) error {
 }
 
 // Refund 处理Creem退款
-func (c *CreemPayment) Refund(order *model.OrderModel) error {
+func (c *CreemPayment) Refund(order *model.OrderModel, refund *model.RefundModel) error {
 	// 检查配置和初始化客户端
 	if err := c.ensureClientReady(); err != nil {
 		return err
@@ -395,15 +545,15 @@ func (c *CreemPayment) Refund(order *model.OrderModel) error {
 	log.Printf("[creem][%s] processing refund", order.OrderID)
 
 	// 检查订单状态是否可以退款
-	if order.Status != model.PaymentSucceed {
+	if !order.Status.CanTransit(model.PaymentRefunded) {
 		return fmt.Errorf("%w, current status: %s", consts.ErrOrderCannotBeRefunded, order.Status)
 	}
 
 	// 构建退款请求 - 根据Creem API文档调整
 	refundReq := object{
 		"order_id": order.OrderID, // 或者使用实际的Creem order ID
-		"amount":   order.Amount,
-		"reason":   "User requested refund",
+		"amount":   toMinor(refund.Amount, Currency(order)),
+		"reason":   refund.Reason,
 	}
 
 	// 发送退款请求 - 使用正确的API端点
@@ -421,9 +571,7 @@ func (c *CreemPayment) Refund(order *model.OrderModel) error {
 	}
 
 	// 检查退款状态
-	if status, ok := refundResp["status"].(string); ok && status == "success" {
-		// 更新订单状态为已退款
-		order.Status = model.PaymentRefunded
+	if status, ok := refundResp["status"].(string); ok && status == EventStatusSuccess {
 		log.Printf("[creem][%s] refund processed successfully", order.OrderID)
 	} else {
 		log.Printf("[creem][%s] refund response: %v", order.OrderID, refundResp)
@@ -1,9 +1,15 @@
 package payment
 
 import (
+	"fmt"
+	"llm-member/internal/config"
 	"llm-member/internal/consts"
 	"llm-member/internal/model"
+	"math"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
 // 定义一个通用的map类型别名
@@ -11,23 +17,71 @@ type object = map[string]any
 
 // Event 支付回调事件
 type Event struct {
-	Type    string  `json:"type"`      // 事件类型
-	OrderID string  `json:"order_id"`  // 订单ID
-	Status  string  `json:"status"`    // 支付状态
-	Amount  float64 `json:"amount"`    // 金额
-	Time    int64   `json:"timestamp"` // 时间戳
+	ID       string  `json:"id"`        // 渠道事件ID，用于去重
+	Type     string  `json:"type"`      // 事件类型
+	OrderID  string  `json:"order_id"`  // 订单ID
+	RefundID string  `json:"refund_id"` // 退款单号，渠道异步通知后台发起的退款结果时提供
+	Status   string  `json:"status"`    // 支付状态
+	Amount   float64 `json:"amount"`    // 金额
+	Currency string  `json:"currency"`  // 币种，为空表示渠道未提供
+	Time     int64   `json:"timestamp"` // 时间戳
 
 	Data object `json:"data"` // 原始数据
+
+	Subscription *Subscription `json:"subscription,omitempty"` // 订阅信息
+}
+
+// 支付事件状态，各渠道回调统一归一为以下取值
+const (
+	EventStatusSuccess   = "success"   // 支付成功
+	EventStatusFailed    = "failed"    // 支付失败
+	EventStatusCancelled = "cancelled" // 取消或过期
+	EventStatusRefunded  = "refunded"  // 已退款
+)
+
+// 订阅生命周期事件类型
+const (
+	EventSubscriptionRenewed  = "subscription.renewed"  // 续费成功
+	EventSubscriptionUpdated  = "subscription.updated"  // 状态或取消设置变更
+	EventSubscriptionCanceled = "subscription.canceled" // 订阅终止
+)
+
+// Subscription 回调中携带的订阅信息
+type Subscription struct {
+	ID       string `json:"id"`       // 第三方订阅ID
+	Customer string `json:"customer"` // 第三方客户ID
+	Status   string `json:"status"`   // active, past_due, canceled
+
+	PeriodStart int64 `json:"period_start"` // 当前周期开始（Unix秒）
+	PeriodEnd   int64 `json:"period_end"`   // 当前周期结束（Unix秒）
+
+	CancelAtPeriodEnd bool `json:"cancel_at_period_end"`
 }
 
 type IPayment interface {
 	Create(order *model.OrderModel) error
 	Close(order *model.OrderModel) error
 	Query(order *model.OrderModel) error
-	Refund(order *model.OrderModel) error
+	// Refund 提交渠道退款，渠道只受理、结果异步通知时返回 consts.ErrRefundProcessing
+	Refund(order *model.OrderModel, refund *model.RefundModel) error
 	Webhook(req *http.Request) (*Event, error)
 }
 
+// ISubscription 支持自动续费的支付方式
+type ISubscription interface {
+	CancelSubscription(sub *model.SubscriptionModel) error
+}
+
+// IWebhookAck 回调处理成功后需按约定内容应答的支付方式
+type IWebhookAck interface {
+	WebhookAck() string
+}
+
+// IPaymentForm 需由浏览器提交表单跳转支付的支付方式
+type IPaymentForm interface {
+	Form(order *model.OrderModel) (action string, fields map[string]string, err error)
+}
+
 // UnsupportedPayment 不支持的支付方式实现
 type UnsupportedPayment struct {
 	method model.PaymentMethod
@@ -45,7 +99,7 @@ func (u *UnsupportedPayment) Query(order *model.OrderModel) error {
 	return consts.ErrPaymentMethodNotSupported
 }
 
-func (u *UnsupportedPayment) Refund(order *model.OrderModel) error {
+func (u *UnsupportedPayment) Refund(order *model.OrderModel, refund *model.RefundModel) error {
 	return consts.ErrPaymentMethodNotSupported
 }
 
@@ -53,22 +107,75 @@ func (u *UnsupportedPayment) Webhook(req *http.Request) (*Event, error) {
 	return nil, consts.ErrPaymentMethodNotSupported
 }
 
+// NewPayment 按注册信息创建支付实例
 func NewPayment(method model.PaymentMethod) IPayment {
-	switch method {
-	case "paypal":
-		return NewPaypalPayment()
-	case "alipay":
-		return NewAlipayPayment()
-	case "wechat":
-		return NewWechatPayment()
-	case "creem":
-		return NewCreemPayment()
-	case "stripe":
-		return NewStripePayment()
-	case "mock":
-		return &MockPayment{}
-	default:
-		// 返回一个错误实现，在调用接口时返回不支持的支付方式错误
-		return &UnsupportedPayment{method: method}
+	if provider, ok := Lookup(method); ok {
+		return provider.New()
+	}
+	// 返回一个错误实现，在调用接口时返回不支持的支付方式错误
+	return &UnsupportedPayment{method: method}
+}
+
+// cnTimezone 支付宝、银联等国内渠道的时间均为北京时间，与服务器时区无关
+var cnTimezone = time.FixedZone("CST", 8*3600)
+
+// 无小数位的币种，最小货币单位即为主单位
+var zeroDecimal = []string{"JPY", "KRW", "VND", "CLP", "ISK", "UGX", "XAF", "XOF"}
+
+// Currency 订单结算币种，早期订单未记录币种时使用默认币种
+func Currency(order *model.OrderModel) string {
+	if order.Currency != "" {
+		return strings.ToUpper(order.Currency)
+	}
+	return config.GetCurrency()
+}
+
+// MatchAmount 校验渠道返回的金额和币种与订单一致，currency 为空时只比较金额
+func MatchAmount(order *model.OrderModel, amount float64, currency string) error {
+	expect := Currency(order)
+	if currency != "" && !strings.EqualFold(currency, expect) {
+		return fmt.Errorf(
+			"%w: currency %s, expected %s", consts.ErrPaymentAmountMismatch,
+			strings.ToUpper(currency), expect,
+		)
+	}
+	if toMinor(amount, expect) != toMinor(order.Amount, expect) {
+		return fmt.Errorf(
+			"%w: amount %.2f, expected %.2f", consts.ErrPaymentAmountMismatch,
+			amount, order.Amount,
+		)
+	}
+	return nil
+}
+
+// requireCurrency 渠道只支持固定币种时校验订单币种
+func requireCurrency(order *model.OrderModel, supported ...string) error {
+	if currency := Currency(order); !slices.Contains(supported, currency) {
+		return fmt.Errorf("%w: %s", consts.ErrPaymentCurrencyNotSupported, currency)
+	}
+	return nil
+}
+
+// toMinor 将金额转换为最小货币单位（如分），四舍五入避免浮点误差
+func toMinor(amount float64, currency string) int64 {
+	if slices.Contains(zeroDecimal, strings.ToUpper(currency)) {
+		return int64(math.Round(amount))
+	}
+	return int64(math.Round(amount * 100))
+}
+
+// fromMinor 将最小货币单位转换为金额
+func fromMinor(minor float64, currency string) float64 {
+	if slices.Contains(zeroDecimal, strings.ToUpper(currency)) {
+		return minor
+	}
+	return minor / 100
+}
+
+// formatAmount 按币种精度格式化金额，用于以字符串传递金额的渠道
+func formatAmount(amount float64, currency string) string {
+	if slices.Contains(zeroDecimal, strings.ToUpper(currency)) {
+		return fmt.Sprintf("%d", toMinor(amount, currency))
 	}
+	return fmt.Sprintf("%.2f", float64(toMinor(amount, currency))/100)
 }
@@ -1,70 +1,210 @@
 package payment
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
 	"llm-member/internal/model"
 )
 
+const (
+	mockURLPrefix       = "mock://payment/"  // 模拟支付链接，记录订单的模拟结果
+	mockSignatureHeader = "X-Mock-Signature" // 模拟回调签名，请求体的 HMAC-SHA256
+)
+
+func init() {
+	Register(Provider{
+		Method: model.PaymentMock, Name: "模拟支付", Icon: "fas fa-bug", Color: "#6B7280",
+		Refund: true, QRCode: true,
+		Enabled: configured(config.GetMockConfig),
+		New:     func() IPayment { return NewMockPayment() },
+	})
+}
+
+// MockPayment 模拟支付，用于开发环境端到端测试下单、查询和回调流程
 type MockPayment struct {
+	client *http.Client
+	config *config.Mock
+}
+
+// NewMockPayment 创建模拟支付实例
+func NewMockPayment() *MockPayment {
+	return &MockPayment{}
 }
 
-// Create 创建模拟支付订单，直接标记为成功
+// ensureClientReady 确保已启用模拟支付
+func (m *MockPayment) ensureClientReady() error {
+	if m.config != nil {
+		return nil
+	}
+
+	provider := config.GetMockConfig()
+	if provider == nil {
+		return consts.ErrPaymentProviderNotConfigured
+	}
+	m.client = &http.Client{Timeout: 30 * time.Second}
+	m.config = provider
+	return nil
+}
+
+// MockURL 记录模拟结果的支付链接
+func MockURL(outcome model.MockOutcome) string {
+	return mockURLPrefix + string(outcome)
+}
+
+// mockOutcome 订单的模拟结果，无法识别时按支付成功处理
+func mockOutcome(order *model.OrderModel) model.MockOutcome {
+	switch outcome := model.MockOutcome(strings.TrimPrefix(order.PayURL, mockURLPrefix)); outcome {
+	case model.MockFailure, model.MockDelay, model.MockExpiry:
+		return outcome
+	default:
+		return model.MockSuccess
+	}
+}
+
+// Create 创建模拟支付订单，使用配置的默认结果
 func (m *MockPayment) Create(order *model.OrderModel) error {
-	// 模拟显示支付二维码
-	log.Printf("[mock][%s] payment created successfully", order.OrderID)
+	// 检查配置和初始化客户端
+	if err := m.ensureClientReady(); err != nil {
+		return err
+	}
+
 	order.Status = model.PaymentPending
-	order.PayURL = "mock://payment/success"
+	order.PayURL = MockURL(model.MockOutcome(m.config.Outcome))
 	order.QRCode = "/api/order/qrcode/" + order.OrderID
+	log.Printf("[mock][%s] payment created successfully, outcome: %s", order.OrderID, mockOutcome(order))
 	return nil
 }
 
-// Query 查询模拟支付状态，始终返回成功
+// Query 查询模拟支付状态，按订单的模拟结果返回
 func (m *MockPayment) Query(order *model.OrderModel) error {
-	// 模拟查询成功, 手机扫码之后
-	log.Printf("[mock][%s] querying payment status", order.OrderID)
-	if order.Status == model.PaymentPending {
+	// 检查配置和初始化客户端
+	if err := m.ensureClientReady(); err != nil {
+		return err
+	}
+
+	outcome := mockOutcome(order)
+	log.Printf("[mock][%s] querying payment status, outcome: %s", order.OrderID, outcome)
+	switch {
+	case outcome == model.MockSuccess,
+		outcome == model.MockDelay && time.Since(order.CreatedAt) >= m.config.Delay:
+		order.ThridID = "mock_" + order.OrderID
 		order.Status = model.PaymentSucceed
-		now := time.Now()
-		order.SucceedAt = &now
 		log.Printf("[mock][%s] payment successful", order.OrderID)
+	case outcome == model.MockFailure:
+		order.Status = model.PaymentCanceled
+		log.Printf("[mock][%s] payment failed", order.OrderID)
+	default:
+		order.Status = model.PaymentPending
 	}
 	return nil
 }
 
 // Close 关闭模拟支付订单
 func (m *MockPayment) Close(order *model.OrderModel) error {
-	// 模拟关闭成功
+	// 检查配置和初始化客户端
+	if err := m.ensureClientReady(); err != nil {
+		return err
+	}
+
 	log.Printf("[mock][%s] payment closed successfully", order.OrderID)
-	order.Status = model.PaymentCanceled
 	return nil
 }
 
 // Refund 模拟退款，直接标记为成功
-func (m *MockPayment) Refund(order *model.OrderModel) error {
-	// 模拟退款成功
-	log.Printf("[mock][%s] refund successful", order.OrderID)
-	order.Status = model.PaymentRefunded
+func (m *MockPayment) Refund(order *model.OrderModel, refund *model.RefundModel) error {
+	// 检查配置和初始化客户端
+	if err := m.ensureClientReady(); err != nil {
+		return err
+	}
+
+	log.Printf("[mock][%s] refund %s successful, amount: %.2f", order.OrderID, refund.RefundID, refund.Amount)
 	return nil
 }
 
-// Webhook 模拟支付回调验证
+// Webhook 验证模拟回调签名并解析事件
 func (m *MockPayment) Webhook(req *http.Request) (*Event, error) {
-	// 模拟验证成功
-	log.Printf("[mock] webhook verification successful")
+	// 检查配置和初始化客户端
+	if err := m.ensureClientReady(); err != nil {
+		return nil, err
+	}
 
-	// 返回模拟的webhook事件
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookBodyReadFailed, err)
+	}
+	signature, err := hex.DecodeString(req.Header.Get(mockSignatureHeader))
+	if err != nil || !hmac.Equal(signature, m.sign(body)) {
+		log.Printf("[mock] webhook signature verification failed")
+		return nil, consts.ErrWebhookSignatureVerificationFailed
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookEventParseFailed, err)
+	}
+	if event.ID == "" || event.OrderID == "" {
+		return nil, consts.ErrPaymentWebhookMissingParams
+	}
+	log.Printf("[mock] received webhook: %s, order %s, status %s", event.ID, event.OrderID, event.Status)
+	return &event, nil
+}
+
+// Notify 以模拟渠道身份向回调地址发送签名的支付回调
+func (m *MockPayment) Notify(order *model.OrderModel, status string, amount float64) (*Event, error) {
+	// 检查配置和初始化客户端
+	if err := m.ensureClientReady(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
 	event := &Event{
-		Type:    "payment.success",
-		OrderID: "mock_order_id",
-		Status:  "success",
-		Amount:  99.99,
+		ID:      fmt.Sprintf("mock_%s_%s_%d", order.OrderID, status, now.UnixNano()),
+		Type:    "mock." + status,
+		OrderID: order.OrderID, Status: status,
+		Amount: amount, Currency: Currency(order), Time: now.Unix(),
+		Data: object{"outcome": mockOutcome(order)},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
 
-		Data: make(object),
-		Time: time.Now().Unix(),
+	req, err := http.NewRequest(http.MethodPost, m.config.NotifyURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrRequestCreationFailed, err)
 	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(mockSignatureHeader, hex.EncodeToString(m.sign(body)))
 
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrRequestSendFailed, err)
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return event, fmt.Errorf("%w: status %d, %s", consts.ErrAPIRequestFailed, resp.StatusCode, reply)
+	}
+
+	log.Printf("[mock][%s] webhook %s delivered", order.OrderID, event.ID)
 	return event, nil
 }
+
+// sign 计算模拟回调签名
+func (m *MockPayment) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(m.config.Secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -2,9 +2,23 @@ package payment
 
 import (
 	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"llm-member/internal/config"
@@ -15,12 +29,38 @@ import (
 	"github.com/go-pay/gopay/paypal"
 )
 
+// paypalClients 按应用缓存客户端，客户端创建时获取令牌并在后台定时刷新
+var paypalClients sync.Map
+
+// paypalCerts 缓存回调签名证书，按证书地址索引
+var paypalCerts sync.Map
+
 // PaypalPayment PayPal支付实现
 type PaypalPayment struct {
 	client *paypal.Client
 	config *config.PayPal
 }
 
+// PaypalWebhookResource 回调资源中用到的字段，支付和退款共用
+type PaypalWebhookResource struct {
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	CustomID   string         `json:"custom_id"`
+	InvoiceID  string         `json:"invoice_id"`
+	Amount     *paypal.Amount `json:"amount"`
+	CreateTime string         `json:"create_time"`
+	Links      []*paypal.Link `json:"links"`
+}
+
+func init() {
+	Register(Provider{
+		Method: model.PaymentPaypal, Name: "PayPal", Icon: "fab fa-paypal", Color: "#003087",
+		Refund:  true,
+		Enabled: configured(config.GetPayPalConfig),
+		New:     func() IPayment { return NewPaypalPayment() },
+	})
+}
+
 // NewPaypalPayment 创建PayPal支付实例
 func NewPaypalPayment() *PaypalPayment {
 	return &PaypalPayment{}
@@ -38,54 +78,53 @@ func (p *PaypalPayment) ensureClientReady() error {
 		return consts.ErrPaymentProviderNotConfigured
 	}
 
+	key := fmt.Sprintf("%s:%t", provider.AppID, provider.Live)
+	if client, ok := paypalClients.Load(key); ok {
+		p.client, p.config = client.(*paypal.Client), provider
+		return nil
+	}
+
 	// 创建PayPal客户端
-	client, err := paypal.NewClient(provider.AppID, provider.Token, false) // false表示沙箱环境
+	client, err := paypal.NewClient(provider.AppID, provider.Token, provider.Live)
 	if err != nil {
 		return fmt.Errorf("%w: %v", consts.ErrPaymentClientCreationFailed, err)
 	}
+	actual, _ := paypalClients.LoadOrStore(key, client)
 
-	p.client = client
+	p.client = actual.(*paypal.Client)
 	p.config = provider
 	return nil
 }
 
-// Create 创建PayPal支付订单
+// Create 创建PayPal支付订单，用户批准后在返回地址或查询时完成扣款
 func (p *PaypalPayment) Create(order *model.OrderModel) error {
 	// 检查配置和初始化客户端
 	if err := p.ensureClientReady(); err != nil {
 		return err
 	}
 
-	// 根据套餐类型设置价格
-	var amount float64
-	switch order.PayPlan {
-	case model.PlanBasic:
-		amount = 1.99 // PayPal使用美元
-	case model.PlanExtra:
-		amount = 2.99
-	case model.PlanUltra:
-		amount = 5.99
-	case model.PlanSuper:
-		amount = 14.99
-	default:
-		amount = 1.99
-	}
+	// 按订单币种和金额收款
+	currency := Currency(order)
 
-	// 创建支付请求参数
+	// 创建支付请求参数，custom_id 会带到扣款和退款的回调中
 	bodyMap := make(gopay.BodyMap)
 	bodyMap.Set("intent", "CAPTURE")
 	bodyMap.Set("purchase_units", []object{
 		{
 			"reference_id": order.OrderID,
+			"custom_id":    order.OrderID,
+			"invoice_id":   order.OrderID,
 			"amount": object{
-				"currency_code": "USD", "value": fmt.Sprintf("%.2f", amount),
+				"currency_code": currency, "value": formatAmount(order.Amount, currency),
 			},
 			"description": fmt.Sprintf("%s Plan", order.PayPlan),
 		},
 	})
 	bodyMap.Set("application_context", object{
-		"return_url": "http://localhost:8080/payment/return",
-		"cancel_url": "http://localhost:8080/payment/cancel",
+		"return_url":          p.config.ReturnURL,
+		"cancel_url":          p.config.CancelURL,
+		"user_action":         "PAY_NOW",
+		"shipping_preference": "NO_SHIPPING",
 	})
 
 	// 发起支付请求
@@ -94,73 +133,399 @@ func (p *PaypalPayment) Create(order *model.OrderModel) error {
 		log.Printf("[paypal][%s] failed to create order: %v", order.OrderID, err)
 		return fmt.Errorf("%w: %v", consts.ErrPaymentCreationFailed, err)
 	}
+	if result.Code != paypal.Success {
+		log.Printf("[paypal][%s] create order error: %s", order.OrderID, result.Error)
+		return fmt.Errorf("%w: %s", consts.ErrPaymentCreationFailed, result.Error)
+	}
 
 	// 获取支付链接
 	var paymentURL string
-	if result.Response != nil && result.Response.Links != nil {
-		for _, link := range result.Response.Links {
-			if link.Rel == "approve" {
-				paymentURL = link.Href
-				break
-			}
+	for _, link := range result.Response.Links {
+		if link.Rel == "approve" || link.Rel == "payer-action" {
+			paymentURL = link.Href
+			break
 		}
 	}
+	if paymentURL == "" {
+		return fmt.Errorf("%w: missing approve link", consts.ErrPaymentCreationFailed)
+	}
 
 	// 更新订单状态
+	order.ThridID = result.Response.Id
 	order.PayURL = paymentURL
-	order.Amount = amount
 	order.Status = model.PaymentPending
 	order.CreatedAt = time.Now()
 
+	log.Printf("[paypal][%s][%s] order created", order.OrderID, order.ThridID)
 	return nil
 }
 
-// Query 查询PayPal支付状态
+// Query 查询PayPal订单状态，用户已批准但未扣款时完成扣款
 func (p *PaypalPayment) Query(order *model.OrderModel) error {
 	// 检查配置和初始化客户端
 	if err := p.ensureClientReady(); err != nil {
 		return err
 	}
 
-	// PayPal通常通过webhook或redirect处理状态更新
-	// 这里提供基本的查询实现
-	if order.Status == model.PaymentPending {
-		// 实际应用中需要调用PayPal API查询订单状态
-		log.Printf("[paypal][%s] querying order status", order.OrderID)
+	detail, err := p.detail(order)
+	if err != nil {
+		return err
+	}
+	if detail.Status == "APPROVED" {
+		if detail, err = p.capture(order); err != nil {
+			return err
+		}
+	}
+
+	switch detail.Status {
+	case "COMPLETED":
+		capture := paypalCapture(detail)
+		if capture == nil {
+			log.Printf("[paypal][%s] completed order without capture", order.OrderID)
+			return nil
+		}
+		switch capture.Status {
+		case "COMPLETED", "PARTIALLY_REFUNDED":
+			// 以订单金额为准，渠道实收金额不一致时不入账
+			if err := p.matchAmount(order, capture.Amount); err != nil {
+				log.Printf("[paypal][%s] %v", order.OrderID, err)
+				return err
+			}
+			order.Status = model.PaymentSucceed
+			log.Printf("[paypal][%s] payment successful", order.OrderID)
+		case "REFUNDED":
+			order.Status = model.PaymentRefunded
+			log.Printf("[paypal][%s] payment refunded", order.OrderID)
+		case "DECLINED", "FAILED":
+			order.Status = model.PaymentCanceled
+			log.Printf("[paypal][%s] payment %s", order.OrderID, strings.ToLower(capture.Status))
+		default: // PENDING 等待渠道审核
+			order.Status = model.PaymentPending
+			log.Printf("[paypal][%s] capture status %s", order.OrderID, capture.Status)
+		}
+	case "VOIDED":
+		order.Status = model.PaymentCanceled
+		log.Printf("[paypal][%s] payment voided", order.OrderID)
+	case "CREATED", "SAVED", "PAYER_ACTION_REQUIRED":
+		order.Status = model.PaymentPending
+	default:
+		log.Printf("[paypal][%s] unknown order status: %s", order.OrderID, detail.Status)
 	}
 	return nil
 }
 
-// Close 关闭PayPal支付订单
+// Close 关闭PayPal支付订单，未扣款的订单到期后由PayPal自动失效，已扣款时拒绝关闭
 func (p *PaypalPayment) Close(order *model.OrderModel) error {
 	// 检查配置和初始化客户端
 	if err := p.ensureClientReady(); err != nil {
 		return err
 	}
 
-	// PayPal订单关闭逻辑
-	order.Status = model.PaymentCanceled
+	detail, err := p.detail(order)
+	if err != nil {
+		return err
+	}
+	if detail.Status == "COMPLETED" {
+		return fmt.Errorf("%w: order already captured", consts.ErrPaymentCloseError)
+	}
+
+	log.Printf("[paypal][%s] order closed locally, status %s", order.OrderID, detail.Status)
 	return nil
 }
 
-// Refund PayPal退款
-func (p *PaypalPayment) Refund(order *model.OrderModel) error {
+// Refund 通过扣款退款接口退款
+func (p *PaypalPayment) Refund(order *model.OrderModel, refund *model.RefundModel) error {
 	// 检查配置和初始化客户端
 	if err := p.ensureClientReady(); err != nil {
 		return err
 	}
 
-	// PayPal退款需要通过PayPal后台或API实现
-	// 这里提供基本的状态更新
-	log.Printf("[paypal][%s] processing refund, amount: %.2f USD", order.OrderID, order.Amount)
+	detail, err := p.detail(order)
+	if err != nil {
+		return err
+	}
+	capture := paypalCapture(detail)
+	if capture == nil {
+		return fmt.Errorf("%w: capture not found", consts.ErrOrderCannotBeRefunded)
+	}
 
-	order.Status = "refunded"
+	currency := Currency(order)
+	bodyMap := make(gopay.BodyMap)
+	bodyMap.Set("amount", object{
+		"currency_code": currency, "value": formatAmount(refund.Amount, currency),
+	})
+	bodyMap.Set("invoice_id", refund.RefundID)
+	bodyMap.Set("custom_id", order.OrderID) // 退款回调据此关联订单
+	bodyMap.Set("note_to_payer", refund.Reason)
+
+	result, err := p.client.PaymentCaptureRefund(context.Background(), capture.Id, bodyMap)
+	if err != nil {
+		log.Printf("[paypal][%s] refund failed: %v", order.OrderID, err)
+		return fmt.Errorf("%w: %v", consts.ErrPaymentRefundFailed, err)
+	}
+	if result.Code != paypal.Success {
+		log.Printf("[paypal][%s] refund error: %s", order.OrderID, result.Error)
+		return fmt.Errorf("%w: %s", consts.ErrPaymentRefundFailed, result.Error)
+	}
+	if status := result.Response.Status; status != "COMPLETED" && status != "PENDING" {
+		return fmt.Errorf("%w: status %s", consts.ErrRefundNotSuccessful, status)
+	}
+
+	log.Printf("[paypal][%s] refund processed successfully, refund_id: %s", order.OrderID, result.Response.Id)
 	return nil
 }
 
-// Webhook PayPal支付回调验证
+// Webhook PayPal支付回调，按传输签名和证书校验
 func (p *PaypalPayment) Webhook(req *http.Request) (*Event, error) {
-	// TODO: 实现PayPal webhook验证逻辑
-	log.Printf("[paypal] webhook verification not implemented")
-	return nil, consts.ErrPaymentWebhookNotImplemented
+	// 检查配置和初始化客户端
+	if err := p.ensureClientReady(); err != nil {
+		return nil, err
+	}
+	if p.config.WebhookID == "" {
+		return nil, consts.ErrWebhookSecretNotConfigured
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		log.Printf("[paypal] failed to read webhook body: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookBodyReadFailed, err)
+	}
+	if err := p.verifyWebhookSignature(req.Header, body); err != nil {
+		log.Printf("[paypal] webhook signature verification failed: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookSignatureVerificationFailed, err)
+	}
+
+	var webhookEvent paypal.WebhookEvent
+	if err := json.Unmarshal(body, &webhookEvent); err != nil {
+		log.Printf("[paypal] failed to parse webhook event: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookEventParseFailed, err)
+	}
+	log.Printf("[paypal] received webhook event: %s, id: %s", webhookEvent.EventType, webhookEvent.Id)
+
+	var status string
+	switch webhookEvent.EventType {
+	case "PAYMENT.CAPTURE.COMPLETED":
+		status = EventStatusSuccess
+	case "PAYMENT.CAPTURE.DENIED", "PAYMENT.CAPTURE.DECLINED":
+		status = EventStatusFailed
+	case "PAYMENT.CAPTURE.REFUNDED", "PAYMENT.CAPTURE.REVERSED":
+		status = EventStatusRefunded
+	default:
+		// CHECKOUT.ORDER.APPROVED 由返回地址或对账任务完成扣款
+		log.Printf("[paypal] unhandled webhook event type: %s", webhookEvent.EventType)
+		return nil, nil
+	}
+
+	var resource PaypalWebhookResource
+	if err := json.Unmarshal(webhookEvent.Resource, &resource); err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookEventParseFailed, err)
+	}
+	// 渠道发起的退款或冲正不带 custom_id，通过原扣款查找订单
+	if resource.CustomID == "" && status == EventStatusRefunded {
+		resource.CustomID = p.captureCustomID(&resource)
+	}
+	if resource.CustomID == "" {
+		log.Printf("[paypal] webhook %s missing custom_id", webhookEvent.Id)
+		return nil, nil
+	}
+
+	event := &Event{
+		ID: webhookEvent.Id, Type: webhookEvent.EventType,
+		OrderID: resource.CustomID, Status: status, Time: time.Now().Unix(),
+		Data: object{"resource_id": resource.ID, "status": resource.Status},
+	}
+	if t, err := time.Parse(time.RFC3339, webhookEvent.CreateTime); err == nil {
+		event.Time = t.Unix()
+	}
+	// 扣款事件的金额用于校验订单金额，退款事件的金额为本次退款金额
+	if (status == EventStatusSuccess || status == EventStatusRefunded) && resource.Amount != nil {
+		event.Amount, _ = strconv.ParseFloat(resource.Amount.Value, 64)
+		event.Currency = resource.Amount.CurrencyCode
+	}
+	return event, nil
+}
+
+// detail 查询PayPal订单详情
+func (p *PaypalPayment) detail(order *model.OrderModel) (*paypal.OrderDetail, error) {
+	if order.ThridID == "" {
+		return nil, fmt.Errorf("%w: missing paypal order id", consts.ErrPaymentQueryFailed)
+	}
+	result, err := p.client.OrderDetail(context.Background(), order.ThridID, nil)
+	if err != nil {
+		log.Printf("[paypal][%s] payment query failed: %v", order.OrderID, err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrPaymentQueryFailed, err)
+	}
+	if result.Code != paypal.Success {
+		log.Printf("[paypal][%s] payment query error: %s", order.OrderID, result.Error)
+		return nil, fmt.Errorf("%w: %s", consts.ErrPaymentQueryFailed, result.Error)
+	}
+	return result.Response, nil
+}
+
+// capture 扣款已批准的订单，并发扣款失败时重新查询订单
+func (p *PaypalPayment) capture(order *model.OrderModel) (*paypal.OrderDetail, error) {
+	result, err := p.client.OrderCapture(context.Background(), order.ThridID, make(gopay.BodyMap))
+	if err != nil {
+		log.Printf("[paypal][%s] capture failed: %v", order.OrderID, err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrPaymentQueryFailed, err)
+	}
+	if result.Code != paypal.Success {
+		log.Printf("[paypal][%s] capture error: %s", order.OrderID, result.Error)
+		if result.ErrorResponse != nil && paypalIssue(result.ErrorResponse, "ORDER_ALREADY_CAPTURED") {
+			return p.detail(order)
+		}
+		return nil, fmt.Errorf("%w: %s", consts.ErrPaymentQueryFailed, result.Error)
+	}
+	log.Printf("[paypal][%s] order captured", order.OrderID)
+	return result.Response, nil
+}
+
+// matchAmount 校验扣款金额与订单一致
+func (p *PaypalPayment) matchAmount(order *model.OrderModel, amount *paypal.Amount) error {
+	if amount == nil {
+		return nil
+	}
+	value, err := strconv.ParseFloat(amount.Value, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid amount %q", consts.ErrPaymentAmountMismatch, amount.Value)
+	}
+	return MatchAmount(order, value, amount.CurrencyCode)
+}
+
+// verifyWebhookSignature 校验证书链和签名，签名内容为 传输ID|传输时间|WebhookID|请求体CRC32
+func (p *PaypalPayment) verifyWebhookSignature(header http.Header, body []byte) error {
+	transmissionID := header.Get("Paypal-Transmission-Id")
+	transmissionTime := header.Get("Paypal-Transmission-Time")
+	signature := header.Get("Paypal-Transmission-Sig")
+	certURL := header.Get("Paypal-Cert-Url")
+	if transmissionID == "" || transmissionTime == "" || signature == "" || certURL == "" {
+		return consts.ErrMissingWebhookSignatureHeader
+	}
+	if algo := header.Get("Paypal-Auth-Algo"); algo != "" && algo != "SHA256withRSA" {
+		return fmt.Errorf("unsupported auth algo %s", algo)
+	}
+
+	cert, err := paypalCert(certURL)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported certificate key type")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrSignatureMismatch, err)
+	}
+
+	message := fmt.Sprintf(
+		"%s|%s|%s|%d", transmissionID, transmissionTime,
+		p.config.WebhookID, crc32.ChecksumIEEE(body),
+	)
+	digest := sha256.Sum256([]byte(message))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig); err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrSignatureMismatch, err)
+	}
+	return nil
+}
+
+// paypalCert 下载并校验签名证书，只接受PayPal域名下签发给PayPal的有效证书
+func paypalCert(certURL string) (*x509.Certificate, error) {
+	if cached, ok := paypalCerts.Load(certURL); ok {
+		if cert := cached.(*x509.Certificate); time.Now().Before(cert.NotAfter) {
+			return cert, nil
+		}
+	}
+
+	u, err := url.Parse(certURL)
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Hostname(), ".paypal.com") {
+		return nil, fmt.Errorf("untrusted cert url %s", certURL)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrRequestSendFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: cert status %d", consts.ErrAPIRequestFailed, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrResponseReadFailed, err)
+	}
+
+	// 证书文件依次为签名证书和中间证书
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+
+	leaf, intermediates := certs[0], x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates}); err != nil {
+		return nil, fmt.Errorf("verify certificate: %v", err)
+	}
+	if !paypalSubject(leaf) {
+		return nil, fmt.Errorf("certificate not issued to paypal: %s", leaf.Subject.CommonName)
+	}
+
+	paypalCerts.Store(certURL, leaf)
+	return leaf, nil
+}
+
+// paypalSubject 证书是否签发给PayPal域名
+func paypalSubject(cert *x509.Certificate) bool {
+	for _, name := range append(cert.DNSNames, cert.Subject.CommonName) {
+		if strings.HasSuffix(name, ".paypal.com") {
+			return true
+		}
+	}
+	return false
+}
+
+// paypalCapture 获取订单的扣款记录
+func paypalCapture(detail *paypal.OrderDetail) *paypal.Capture {
+	for _, unit := range detail.PurchaseUnits {
+		if unit.Payments != nil && len(unit.Payments.Captures) > 0 {
+			return unit.Payments.Captures[0]
+		}
+	}
+	return nil
+}
+
+// paypalIssue 错误响应是否包含指定问题
+func paypalIssue(resp *paypal.ErrorResponse, issue string) bool {
+	for _, detail := range resp.Details {
+		if detail.Issue == issue {
+			return true
+		}
+	}
+	return false
+}
+
+// captureCustomID 通过退款资源的 up 链接查询原扣款，返回扣款的 custom_id
+func (p *PaypalPayment) captureCustomID(resource *PaypalWebhookResource) string {
+	for _, link := range resource.Links {
+		if link.Rel != "up" || !strings.Contains(link.Href, "/captures/") {
+			continue
+		}
+		captureID := path.Base(link.Href)
+		result, err := p.client.PaymentCaptureDetail(context.Background(), captureID)
+		if err != nil || result.Code != paypal.Success || result.Response == nil {
+			log.Printf("[paypal] query capture %s of refund %s failed: %v", captureID, resource.ID, err)
+			return ""
+		}
+		return result.Response.CustomId
+	}
+	return ""
 }
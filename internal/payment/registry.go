@@ -0,0 +1,107 @@
+package payment
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+)
+
+// Provider 支付方式的注册信息，新增支付方式时在 model 中声明标识，并在实现文件中调用 Register
+type Provider struct {
+	Method model.PaymentMethod `json:"method"` // 支付方式标识
+	Name   string              `json:"name"`   // 显示名称
+	Icon   string              `json:"icon"`   // Font Awesome 图标
+	Color  string              `json:"color"`  // 品牌色
+
+	Refund       bool `json:"refund"`       // 支持原路退款
+	Subscription bool `json:"subscription"` // 支持自动续费，需实现 ISubscription
+	QRCode       bool `json:"qrcode"`       // 支持扫码支付
+
+	Enabled func() bool     `json:"-"` // 配置是否完整可用
+	New     func() IPayment `json:"-"` // 创建支付实例
+}
+
+// registry 已注册的支付方式
+var registry struct {
+	mu        sync.RWMutex
+	providers map[model.PaymentMethod]*Provider
+}
+
+// Register 注册支付方式，标识须已在 model 中声明，重复注册或缺少必要信息时 panic
+func Register(provider Provider) {
+	if !slices.Contains(model.PaymentMethods, provider.Method) {
+		panic(fmt.Sprintf("payment: method %q is not declared in model.PaymentMethods", provider.Method))
+	}
+	if provider.Name == "" || provider.Enabled == nil || provider.New == nil {
+		panic(fmt.Sprintf("payment: method %q requires name, enabled and new", provider.Method))
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if registry.providers == nil {
+		registry.providers = make(map[model.PaymentMethod]*Provider)
+	}
+	if _, ok := registry.providers[provider.Method]; ok {
+		panic(fmt.Sprintf("payment: method %q registered twice", provider.Method))
+	}
+	registry.providers[provider.Method] = &provider
+}
+
+// Validate 校验已声明的支付方式标识均已注册，启动时调用
+func Validate() error {
+	for _, method := range model.PaymentMethods {
+		if _, ok := Lookup(method); !ok {
+			return fmt.Errorf("%w: %s", consts.ErrPaymentMethodNotRegistered, method)
+		}
+	}
+	return nil
+}
+
+// Lookup 获取已注册的支付方式
+func Lookup(method model.PaymentMethod) (*Provider, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	provider, ok := registry.providers[method]
+	return provider, ok
+}
+
+// Providers 获取所有已注册的支付方式，按标识排序
+func Providers() []*Provider {
+	registry.mu.RLock()
+	providers := make([]*Provider, 0, len(registry.providers))
+	for _, provider := range registry.providers {
+		providers = append(providers, provider)
+	}
+	registry.mu.RUnlock()
+
+	slices.SortFunc(providers, func(a, b *Provider) int {
+		return strings.Compare(string(a.Method), string(b.Method))
+	})
+	return providers
+}
+
+// EnabledProviders 获取已完成配置的支付方式
+func EnabledProviders() []*Provider {
+	enabled := []*Provider{}
+	for _, provider := range Providers() {
+		if provider.Enabled() {
+			enabled = append(enabled, provider)
+		}
+	}
+	return enabled
+}
+
+// HasPayment 检查支付方式是否已注册并完成配置
+func HasPayment(method model.PaymentMethod) bool {
+	provider, ok := Lookup(method)
+	return ok && provider.Enabled()
+}
+
+// configured 以配置加载函数作为可用检查，未配置时加载函数返回 nil
+func configured[C any](load func() *C) func() bool {
+	return func() bool { return load() != nil }
+}
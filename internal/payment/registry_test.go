@@ -0,0 +1,39 @@
+package payment
+
+import (
+	"testing"
+
+	"llm-member/internal/model"
+)
+
+func TestRegistryMatchesDeclaredMethods(t *testing.T) {
+	if err := Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(Providers()), len(model.PaymentMethods); got != want {
+		t.Fatalf("registered %d providers, declared %d methods", got, want)
+	}
+}
+
+func TestRegisterRejectsUndeclaredMethod(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for undeclared method")
+		}
+	}()
+	Register(Provider{
+		Method: "unknown", Name: "Unknown",
+		Enabled: func() bool { return false },
+		New:     func() IPayment { return nil },
+	})
+}
+
+func TestRegisterRejectsDuplicate(t *testing.T) {
+	provider, _ := Lookup(model.PaymentMock)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for duplicate registration")
+		}
+	}()
+	Register(*provider)
+}
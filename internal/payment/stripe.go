@@ -102,6 +102,18 @@ type StripeCreateSessionRequest struct {
 	ExpiresAt int64 `json:"expires_at,omitempty"`
 	// 客户端引用ID
 	ClientReferenceID string `json:"client_reference_id,omitempty"`
+	// 订阅设置（mode=subscription）
+	SubscriptionData *StripeSubscriptionData `json:"subscription_data,omitempty"`
+}
+
+// StripeSubscriptionData 订阅创建设置
+type StripeSubscriptionData struct {
+	Metadata object `json:"metadata,omitempty"`
+}
+
+// StripeSubscriptionUpdate 更新订阅请求
+type StripeSubscriptionUpdate struct {
+	CancelAtPeriodEnd bool `json:"cancel_at_period_end"`
 }
 
 // StripeCreateLineItem 创建Line Item
@@ -119,6 +131,15 @@ type StripePriceData struct {
 	UnitAmount int64  `json:"unit_amount"`
 
 	ProductData StripeProductData `json:"product_data"`
+
+	Recurring *StripeRecurring `json:"recurring,omitempty"`
+}
+
+// StripeRecurring 周期性价格设置
+type StripeRecurring struct {
+	Interval string `json:"interval"` // day, week, month, year
+
+	IntervalCount int64 `json:"interval_count,omitempty"`
 }
 
 // StripeProductData 产品数据
@@ -190,6 +211,15 @@ type StripeEventData struct {
 	Object object `json:"object"`
 }
 
+func init() {
+	Register(Provider{
+		Method: model.PaymentStripe, Name: "Stripe", Icon: "fab fa-stripe", Color: "#635BFF",
+		Refund: true, Subscription: true,
+		Enabled: configured(config.GetStripeConfig),
+		New:     func() IPayment { return NewStripePayment() },
+	})
+}
+
 // NewStripePayment 创建Stripe支付实例
 func NewStripePayment() *StripePayment {
 	baseURL := "https://api.stripe.com/v1"
@@ -217,41 +247,55 @@ func (s *StripePayment) ensureClientReady() error {
 	return nil
 }
 
-func (s *StripePayment) getLineItems(order *model.OrderModel) []StripeCreateLineItem {
-
-	var plan_name string
-	var product_id string
-	switch order.PayPlan {
-	case model.PlanBasic:
-		plan_name = "Basic Plan"
-		product_id = s.config.PlanBasicId
-	case model.PlanExtra:
-		plan_name = "Extra Plan"
-		product_id = s.config.PlanExtraId
-	case model.PlanUltra:
-		plan_name = "Ultra Plan"
-		product_id = s.config.PlanUltraId
-	case model.PlanSuper:
-		plan_name = "Super Plan"
-		product_id = s.config.PlanSuperId
-	}
-	if product_id != "" {
+func (s *StripePayment) getLineItems(order *model.OrderModel) ([]StripeCreateLineItem, error) {
+	// 已在套餐中配置 Price ID 时直接使用
+	if order.Product != "" {
 		return []StripeCreateLineItem{{
-			Quantity: 1, Price: product_id,
-		}}
+			Quantity: 1, Price: order.Product,
+		}}, nil
 	}
 
+	plan_name := fmt.Sprintf("%s Plan", order.PayPlan)
+	if order.Kind == model.OrderTopup {
+		plan_name = "Wallet Top-up"
+	}
 	priceData := &StripePriceData{
-		Currency: "usd", UnitAmount: int64(order.Amount) * 100,
+		Currency:   strings.ToLower(Currency(order)),
+		UnitAmount: toMinor(order.Amount, Currency(order)),
 		ProductData: StripeProductData{
 			Name: plan_name, Description: fmt.Sprintf(
 				"LLM Member %s - Order %s", plan_name, order.OrderID,
 			),
 		},
 	}
+	if order.Kind == model.OrderSubscribe {
+		// 未配置订阅价格时按套餐周期续费
+		recurring, err := stripeRecurring(order.Period)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", err, order.PayPlan)
+		}
+		priceData.Recurring = recurring
+	}
 	return []StripeCreateLineItem{{
 		Quantity: 1, PriceData: priceData,
-	}}
+	}}, nil
+}
+
+// stripeRecurring 将套餐周期转换为 Stripe 续费间隔，Stripe 的间隔最长一年，且不能混合月和天
+func stripeRecurring(period *model.ApiLimit) (*StripeRecurring, error) {
+	switch {
+	case period == nil, period.ExpireMonths > 0 && period.ExpireDays > 0:
+		return nil, consts.ErrSubscriptionNotSupported
+	case period.ExpireMonths == 12:
+		return &StripeRecurring{Interval: "year", IntervalCount: 1}, nil
+	case period.ExpireMonths > 0 && period.ExpireMonths < 12:
+		return &StripeRecurring{Interval: "month", IntervalCount: int64(period.ExpireMonths)}, nil
+	case period.ExpireDays > 0 && period.ExpireDays%7 == 0 && period.ExpireDays <= 52*7:
+		return &StripeRecurring{Interval: "week", IntervalCount: int64(period.ExpireDays / 7)}, nil
+	case period.ExpireDays > 0 && period.ExpireDays <= 365:
+		return &StripeRecurring{Interval: "day", IntervalCount: int64(period.ExpireDays)}, nil
+	}
+	return nil, consts.ErrSubscriptionNotSupported
 }
 
 // Create 创建Stripe支付订单
@@ -261,18 +305,21 @@ func (s *StripePayment) Create(order *model.OrderModel) error {
 		return err
 	}
 
-	// priceData := &StripePriceData{
-	// 	Currency: "usd", UnitAmount: int64(order.Amount) * 100,
-	// 	ProductData: StripeProductData{
-	// 		Name: planName, Description: fmt.Sprintf(
-	// 			"LLM Member %s - Order %s", planName, order.OrderID,
-	// 		),
-	// 	},
-	// }
+	// 套餐配置的 Price 必须与订单金额一致，避免按渠道价格多收或少收
+	if order.Product != "" {
+		if err := s.verifyPrice(order); err != nil {
+			return err
+		}
+	}
+
+	lineItems, err := s.getLineItems(order)
+	if err != nil {
+		return err
+	}
 
 	// 构建Checkout Session请求
 	request := StripeCreateSessionRequest{
-		Mode: "payment", LineItems: s.getLineItems(order),
+		Mode: "payment", LineItems: lineItems,
 		ExpiresAt: time.Now().Add(time.Hour).Unix(),
 		// 设置支付方式类型
 		PaymentMethodTypes: []string{"card", "alipay"},
@@ -291,6 +338,14 @@ func (s *StripePayment) Create(order *model.OrderModel) error {
 		// 账单收集
 		// BillingAddressCollection: "auto",
 	}
+	if order.Kind == model.OrderSubscribe {
+		// 订阅模式仅支持可重复扣款的卡支付，订阅对象也带上订单信息用于续费回调
+		request.Mode = "subscription"
+		request.PaymentMethodTypes = []string{"card"}
+		request.SubscriptionData = &StripeSubscriptionData{
+			Metadata: request.Metadata,
+		}
+	}
 
 	// 发送HTTP请求到Stripe API
 	resp, err := s.makeAPIRequest("POST", "/checkout/sessions", request)
@@ -316,6 +371,25 @@ func (s *StripePayment) Create(order *model.OrderModel) error {
 	return nil
 }
 
+// verifyPrice 校验套餐配置的 Stripe Price 与订单金额、币种一致
+func (s *StripePayment) verifyPrice(order *model.OrderModel) error {
+	var price StripePrice
+	url := fmt.Sprintf("/prices/%s", order.Product)
+	if resp, err := s.makeAPIRequest("GET", url, nil); err != nil {
+		log.Printf("[stripe][%s] price %s query failed: %v", order.OrderID, order.Product, err)
+		return fmt.Errorf("%w: %v", consts.ErrPaymentCreationFailed, err)
+	} else if err := json.Unmarshal(resp, &price); err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrResponseParseFailed, err)
+	}
+
+	amount := fromMinor(float64(price.UnitAmount), price.Currency)
+	if err := MatchAmount(order, amount, price.Currency); err != nil {
+		log.Printf("[stripe][%s] price %s mismatch: %v", order.OrderID, order.Product, err)
+		return err
+	}
+	return nil
+}
+
 // Query 查询Stripe支付状态
 func (s *StripePayment) Query(order *model.OrderModel) error {
 	// 检查配置和初始化客户端
@@ -361,7 +435,7 @@ func (s *StripePayment) Query(order *model.OrderModel) error {
 
 	case sessionStatus == "expired":
 		// 会话过期
-		order.Status = model.PaymentCanceled
+		order.Status = model.PaymentExpired
 		log.Printf("[stripe][%s] checkout session expired", order.OrderID)
 
 	case paymentStatus == "unpaid" || sessionStatus == "open":
@@ -385,9 +459,13 @@ func (s *StripePayment) Query(order *model.OrderModel) error {
 		return fmt.Errorf("unknown payment status: session=%s, payment=%s", sessionStatus, paymentStatus)
 	}
 
-	// 更新订单的第三方ID和金额信息
-	if sessionResp.AmountTotal > 0 {
-		order.Amount = float64(sessionResp.AmountTotal) / 100 // Stripe使用分为单位
+	// 以订单金额为准，渠道实收金额不一致时不入账
+	if order.Status == model.PaymentSucceed && sessionResp.AmountTotal > 0 {
+		amount := fromMinor(float64(sessionResp.AmountTotal), sessionResp.Currency)
+		if err := MatchAmount(order, amount, sessionResp.Currency); err != nil {
+			log.Printf("[stripe][%s] %v", order.OrderID, err)
+			return err
+		}
 	}
 
 	// 如果支付成功，尝试获取line items详细信息
@@ -435,9 +513,9 @@ func (s *StripePayment) Close(order *model.OrderModel) error {
 		// 记录详细错误信息
 		log.Printf("[stripe][%s] failed to expire checkout session: %v", order.OrderID, err)
 
-		// 尝试查询当前状态，如果已经过期则直接标记为取消
+		// 尝试查询当前状态，会话已经过期时无需再关闭
 		if queryErr := s.Query(order); queryErr == nil {
-			if order.Status == model.PaymentCanceled {
+			if order.Status == model.PaymentExpired {
 				log.Printf("[stripe][%s] session already expired", order.OrderID)
 				return nil
 			}
@@ -462,29 +540,45 @@ func (s *StripePayment) Close(order *model.OrderModel) error {
 }
 
 // Refund 处理Stripe退款
-func (s *StripePayment) Refund(order *model.OrderModel) error {
+func (s *StripePayment) Refund(order *model.OrderModel, refund *model.RefundModel) error {
 	// 检查配置和初始化客户端
 	if err := s.ensureClientReady(); err != nil {
 		return err
 	}
 
 	// 检查订单是否可以退款
-	if order.Status != model.PaymentSucceed {
+	if !order.Status.CanTransit(model.PaymentRefunded) {
 		log.Printf("[stripe][%s] order cannot be refunded, current status: %s", order.OrderID, order.Status)
 		return fmt.Errorf("%w: order status is %s", consts.ErrOrderCannotBeRefunded, order.Status)
 	}
 
 	if order.ThridID == "" {
+		log.Printf("[stripe][%s] no checkout session ID found for refund", order.OrderID)
+		return fmt.Errorf("%w: missing checkout session ID", consts.ErrPaymentRefundFailed)
+	}
+
+	// 订单记录的是 Checkout Session，退款需要其关联的 PaymentIntent
+	var sessionResp StripeCheckoutSession
+	url := fmt.Sprintf("/checkout/sessions/%s", order.ThridID)
+	if resp, err := s.makeAPIRequest("GET", url, nil); err != nil {
+		log.Printf("[stripe][%s] session query failed: %v", order.OrderID, err)
+		return fmt.Errorf("%w: %v", consts.ErrPaymentRefundFailed, err)
+	} else if err := json.Unmarshal(resp, &sessionResp); err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrResponseParseFailed, err)
+	}
+	if sessionResp.PaymentIntent == "" {
 		log.Printf("[stripe][%s] no payment intent ID found for refund", order.OrderID)
 		return fmt.Errorf("%w: missing payment intent ID", consts.ErrPaymentRefundFailed)
 	}
 
 	// 构建退款请求
 	refundReq := StripeRefundRequest{
-		PaymentIntent: order.ThridID, Reason: "requested_by_customer",
-		Metadata: object{"order_id": order.OrderID},
-		Amount:   int64(order.Amount * 100), // 转换为分
-
+		PaymentIntent: sessionResp.PaymentIntent, Reason: "requested_by_customer",
+		Metadata: object{
+			"order_id": order.OrderID, "refund_id": refund.RefundID,
+			"reason": refund.Reason,
+		},
+		Amount: toMinor(refund.Amount, Currency(order)),
 	}
 
 	// 调用Stripe退款API
@@ -497,9 +591,8 @@ func (s *StripePayment) Refund(order *model.OrderModel) error {
 		return fmt.Errorf("%w: %v", consts.ErrResponseParseFailed, err)
 	}
 
-	// 检查退款状态
-	if refundResp.Status == "succeeded" {
-		order.Status = model.PaymentRefunded
+	// 检查退款状态，银行卡退款可能需要数日才到账
+	if refundResp.Status == "succeeded" || refundResp.Status == "pending" {
 		log.Printf("[stripe][%s] refund successful, refund_id: %s", order.OrderID, refundResp.ID)
 	} else {
 		log.Printf("[stripe][%s] refund failed, status: %s", order.OrderID, refundResp.Status)
@@ -543,21 +636,36 @@ func (s *StripePayment) Webhook(req *http.Request) (*Event, error) {
 	}
 
 	log.Printf("[stripe] received webhook event: %s, id: %s", webhookEvent.Type, webhookEvent.ID)
+	return s.parseEvent(&webhookEvent)
+}
 
-	// 处理不同类型的事件
+// parseEvent 按事件类型转换为统一的支付事件，未处理的类型返回 nil
+func (s *StripePayment) parseEvent(webhookEvent *StripeWebhookEvent) (*Event, error) {
+	var result *Event
+	var err error
 	switch webhookEvent.Type {
 	case "checkout.session.completed":
-		return s.handleCheckoutSessionCompleted(&webhookEvent)
+		result, err = s.handleCheckoutSessionCompleted(webhookEvent)
 	case "checkout.session.expired":
-		return s.handleCheckoutSessionExpired(&webhookEvent)
+		result, err = s.handleCheckoutSessionExpired(webhookEvent)
 	case "payment_intent.succeeded":
-		return s.handlePaymentIntentSucceeded(&webhookEvent)
+		result, err = s.handlePaymentIntentSucceeded(webhookEvent)
 	case "payment_intent.payment_failed":
-		return s.handlePaymentIntentFailed(&webhookEvent)
+		result, err = s.handlePaymentIntentFailed(webhookEvent)
+	case "invoice.paid":
+		result, err = s.handleInvoicePaid(webhookEvent)
+	case "customer.subscription.updated":
+		result, err = s.handleSubscriptionChanged(webhookEvent, EventSubscriptionUpdated)
+	case "customer.subscription.deleted":
+		result, err = s.handleSubscriptionChanged(webhookEvent, EventSubscriptionCanceled)
 	default:
 		log.Printf("[stripe] unhandled webhook event type: %s", webhookEvent.Type)
 		return nil, nil // 忽略未处理的事件类型
 	}
+	if result != nil {
+		result.ID = webhookEvent.ID
+	}
+	return result, err
 }
 
 // GetLineItems 获取Checkout Session的line items详细信息
@@ -657,23 +765,158 @@ func (s *StripePayment) handleCheckoutSessionCompleted(event *StripeWebhookEvent
 		return nil, fmt.Errorf("missing order_id in metadata")
 	}
 
-	// 获取支付金额
+	// 获取支付金额，Stripe金额以最小货币单位表示
 	amountTotal, _ := session["amount_total"].(float64)
+	currency, _ := session["currency"].(string)
+
+	result := &Event{
+		Type:     "payment.succeeded",
+		OrderID:  orderID,
+		Status:   EventStatusSuccess,
+		Amount:   fromMinor(amountTotal, currency),
+		Currency: strings.ToUpper(currency),
+		Time:     time.Now().Unix(),
+		Data: object{
+			"provider":   "stripe",
+			"session_id": session["id"],
+			"event_id":   event.ID,
+		},
+	}
+	if mode, _ := session["mode"].(string); mode == "subscription" {
+		subID, _ := session["subscription"].(string)
+		customer, _ := session["customer"].(string)
+		result.Subscription = &Subscription{
+			ID: subID, Customer: customer, Status: "active",
+		}
+	}
+	return result, nil
+}
+
+// handleInvoicePaid 处理订阅续费账单支付成功事件
+func (s *StripePayment) handleInvoicePaid(event *StripeWebhookEvent) (*Event, error) {
+	invoice := event.Data.Object
+	if invoice == nil {
+		return nil, fmt.Errorf("invalid invoice data")
+	}
+
+	subID, _ := invoice["subscription"].(string)
+	if subID == "" {
+		return nil, nil // 非订阅账单
+	}
+	// 首期账单与 checkout.session.completed 同时到达且顺序不定，首期权益只由结账完成事件发放
+	if reason, _ := invoice["billing_reason"].(string); reason == "subscription_create" {
+		log.Printf("[stripe] ignore first invoice %v of subscription %s", invoice["id"], subID)
+		return nil, nil
+	}
+	customer, _ := invoice["customer"].(string)
+	amountPaid, _ := invoice["amount_paid"].(float64)
+	currency, _ := invoice["currency"].(string)
+
+	// 订阅元数据中带有首次订阅的订单号
+	var orderID string
+	if details, ok := invoice["subscription_details"].(object); ok {
+		if metadata, ok := details["metadata"].(object); ok {
+			orderID, _ = metadata["order_id"].(string)
+		}
+	}
+
+	// 账单行的周期即本次续费覆盖的周期
+	sub := &Subscription{ID: subID, Customer: customer, Status: "active"}
+	if lines, ok := invoice["lines"].(object); ok {
+		if data, ok := lines["data"].([]any); ok && len(data) > 0 {
+			if line, ok := data[0].(object); ok {
+				if period, ok := line["period"].(object); ok {
+					start, _ := period["start"].(float64)
+					end, _ := period["end"].(float64)
+					sub.PeriodStart, sub.PeriodEnd = int64(start), int64(end)
+				}
+			}
+		}
+	}
+
+	return &Event{
+		Type:     EventSubscriptionRenewed,
+		OrderID:  orderID,
+		Status:   EventStatusSuccess,
+		Amount:   fromMinor(amountPaid, currency),
+		Currency: strings.ToUpper(currency),
+		Time:     time.Now().Unix(),
+		Data: object{
+			"provider":       "stripe",
+			"invoice_id":     invoice["id"],
+			"billing_reason": invoice["billing_reason"],
+			"event_id":       event.ID,
+		},
+		Subscription: sub,
+	}, nil
+}
+
+// handleSubscriptionChanged 处理订阅更新和删除事件
+func (s *StripePayment) handleSubscriptionChanged(event *StripeWebhookEvent, eventType string) (*Event, error) {
+	subscription := event.Data.Object
+	if subscription == nil {
+		return nil, fmt.Errorf("invalid subscription data")
+	}
+
+	subID, _ := subscription["id"].(string)
+	customer, _ := subscription["customer"].(string)
+	status, _ := subscription["status"].(string)
+	start, _ := subscription["current_period_start"].(float64)
+	end, _ := subscription["current_period_end"].(float64)
+	cancelAtPeriodEnd, _ := subscription["cancel_at_period_end"].(bool)
+
+	var orderID string
+	if metadata, ok := subscription["metadata"].(object); ok {
+		orderID, _ = metadata["order_id"].(string)
+	}
 
 	return &Event{
-		Type:    "payment.succeeded",
+		Type:    eventType,
 		OrderID: orderID,
-		Status:  "succeeded",
-		Amount:  amountTotal / 100, // Stripe金额以分为单位，转换为元
+		Status:  status,
 		Time:    time.Now().Unix(),
 		Data: object{
-			"provider":   "stripe",
-			"session_id": session["id"],
-			"event_id":   event.ID,
+			"provider": "stripe",
+			"event_id": event.ID,
+		},
+		Subscription: &Subscription{
+			ID: subID, Customer: customer,
+			Status:      s.subscriptionStatus(status),
+			PeriodStart: int64(start), PeriodEnd: int64(end),
+
+			CancelAtPeriodEnd: cancelAtPeriodEnd,
 		},
 	}, nil
 }
 
+// subscriptionStatus 将Stripe订阅状态归一为 active, past_due, canceled
+func (s *StripePayment) subscriptionStatus(status string) string {
+	switch status {
+	case "active", "trialing":
+		return "active"
+	case "past_due", "unpaid", "incomplete", "paused":
+		return "past_due"
+	default: // canceled, incomplete_expired
+		return "canceled"
+	}
+}
+
+// CancelSubscription 在当前周期结束时取消Stripe订阅
+func (s *StripePayment) CancelSubscription(sub *model.SubscriptionModel) error {
+	if err := s.ensureClientReady(); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("/subscriptions/%s", sub.ThridID)
+	request := StripeSubscriptionUpdate{CancelAtPeriodEnd: true}
+	if _, err := s.makeAPIRequest("POST", url, request); err != nil {
+		log.Printf("[stripe][%s] cancel subscription failed: %v", sub.ThridID, err)
+		return fmt.Errorf("%w: %v", consts.ErrSubscriptionCancelFailed, err)
+	}
+	log.Printf("[stripe][%s] subscription will cancel at period end", sub.ThridID)
+	return nil
+}
+
 // handleCheckoutSessionExpired 处理checkout session过期事件
 func (s *StripePayment) handleCheckoutSessionExpired(event *StripeWebhookEvent) (*Event, error) {
 	session := event.Data.Object
@@ -694,7 +937,7 @@ func (s *StripePayment) handleCheckoutSessionExpired(event *StripeWebhookEvent)
 	return &Event{
 		Type:    "payment.expired",
 		OrderID: orderID,
-		Status:  "expired",
+		Status:  EventStatusCancelled,
 		Amount:  0,
 		Time:    time.Now().Unix(),
 		Data: object{
@@ -723,13 +966,15 @@ func (s *StripePayment) handlePaymentIntentSucceeded(event *StripeWebhookEvent)
 	}
 
 	amount, _ := paymentIntent["amount"].(float64)
+	currency, _ := paymentIntent["currency"].(string)
 
 	return &Event{
-		Type:    "payment.succeeded",
-		OrderID: orderID,
-		Status:  "succeeded",
-		Amount:  amount / 100, // Stripe金额以分为单位，转换为元
-		Time:    time.Now().Unix(),
+		Type:     "payment.succeeded",
+		OrderID:  orderID,
+		Status:   EventStatusSuccess,
+		Amount:   fromMinor(amount, currency),
+		Currency: strings.ToUpper(currency),
+		Time:     time.Now().Unix(),
 		Data: object{
 			"provider":          "stripe",
 			"payment_intent_id": paymentIntent["id"],
@@ -756,13 +1001,15 @@ func (s *StripePayment) handlePaymentIntentFailed(event *StripeWebhookEvent) (*E
 	}
 
 	amount, _ := paymentIntent["amount"].(float64)
+	currency, _ := paymentIntent["currency"].(string)
 
 	return &Event{
-		Type:    "payment.failed",
-		OrderID: orderID,
-		Status:  "failed",
-		Amount:  amount / 100, // Stripe金额以分为单位，转换为元
-		Time:    time.Now().Unix(),
+		Type:     "payment.failed",
+		OrderID:  orderID,
+		Status:   EventStatusFailed,
+		Amount:   fromMinor(amount, currency),
+		Currency: strings.ToUpper(currency),
+		Time:     time.Now().Unix(),
 		Data: object{
 			"provider":          "stripe",
 			"payment_intent_id": paymentIntent["id"],
@@ -0,0 +1,107 @@
+package payment
+
+import (
+	"errors"
+	"testing"
+
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+)
+
+func TestStripeFirstSubscriptionPaymentGrantsOnce(t *testing.T) {
+	checkout := &StripeWebhookEvent{
+		ID: "evt_checkout", Type: "checkout.session.completed",
+		Data: StripeEventData{Object: object{
+			"id": "cs_1", "mode": "subscription", "subscription": "sub_1",
+			"customer": "cus_1", "amount_total": float64(1000), "currency": "usd",
+			"metadata": object{"order_id": "ORDER1"},
+		}},
+	}
+	invoice := func(reason string) *StripeWebhookEvent {
+		return &StripeWebhookEvent{
+			ID: "evt_invoice_" + reason, Type: "invoice.paid",
+			Data: StripeEventData{Object: object{
+				"id": "in_1", "subscription": "sub_1", "customer": "cus_1",
+				"amount_paid": float64(1000), "currency": "usd", "billing_reason": reason,
+				"subscription_details": object{"metadata": object{"order_id": "ORDER1"}},
+				"lines": object{"data": []any{object{
+					"period": object{"start": float64(1767225600), "end": float64(1769904000)},
+				}}},
+			}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		events []*StripeWebhookEvent
+	}{
+		{"invoice before checkout", []*StripeWebhookEvent{invoice("subscription_create"), checkout}},
+		{"checkout before invoice", []*StripeWebhookEvent{checkout, invoice("subscription_create")}},
+	}
+	s := NewStripePayment()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grants := 0
+			for _, webhookEvent := range tt.events {
+				event, err := s.parseEvent(webhookEvent)
+				if err != nil {
+					t.Fatalf("parseEvent(%s) error: %v", webhookEvent.Type, err)
+				}
+				if event == nil {
+					continue
+				}
+				if event.Status == EventStatusSuccess {
+					grants++
+				}
+				if event.Type == EventSubscriptionRenewed {
+					t.Errorf("first invoice produced a renewal event")
+				}
+			}
+			if grants != 1 {
+				t.Errorf("first payment granted %d times, want 1", grants)
+			}
+		})
+	}
+
+	t.Run("renewal invoice", func(t *testing.T) {
+		event, err := s.parseEvent(invoice("subscription_cycle"))
+		if err != nil || event == nil {
+			t.Fatalf("parseEvent() = %v, %v", event, err)
+		}
+		if event.Type != EventSubscriptionRenewed || event.Subscription.PeriodEnd != 1769904000 {
+			t.Errorf("renewal event = %+v", event)
+		}
+	})
+}
+
+func TestStripeRecurring(t *testing.T) {
+	tests := []struct {
+		name     string
+		period   *model.ApiLimit
+		interval string
+		count    int64
+	}{
+		{"monthly", &model.ApiLimit{ExpireMonths: 1}, "month", 1},
+		{"quarterly", &model.ApiLimit{ExpireMonths: 3}, "month", 3},
+		{"yearly", &model.ApiLimit{ExpireMonths: 12}, "year", 1},
+		{"weekly", &model.ApiLimit{ExpireDays: 14}, "week", 2},
+		{"days", &model.ApiLimit{ExpireDays: 10}, "day", 10},
+		{"longer than a year", &model.ApiLimit{ExpireMonths: 24}, "", 0},
+		{"months and days", &model.ApiLimit{ExpireMonths: 1, ExpireDays: 3}, "", 0},
+		{"missing period", nil, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripeRecurring(tt.period)
+			if tt.interval == "" {
+				if !errors.Is(err, consts.ErrSubscriptionNotSupported) {
+					t.Errorf("stripeRecurring() error = %v, want ErrSubscriptionNotSupported", err)
+				}
+				return
+			}
+			if err != nil || got.Interval != tt.interval || got.IntervalCount != tt.count {
+				t.Errorf("stripeRecurring() = %+v, %v, want %s x%d", got, err, tt.interval, tt.count)
+			}
+		})
+	}
+}
@@ -0,0 +1,559 @@
+package payment
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// 银联全渠道 5.1.0 网关
+const (
+	unionGatewayLive    = "https://gateway.95516.com/gateway/api"
+	unionGatewaySandbox = "https://gateway.test.95516.com/gateway/api"
+	unionVersion        = "5.1.0"
+	unionCNName         = "中国银联股份有限公司"    // 生产环境签名证书的所有者
+	unionTestCNName     = "00040000:SIGN" // 测试环境签名证书的所有者
+)
+
+// unionSigners 按证书路径缓存商户签名私钥
+var unionSigners sync.Map
+
+// unionCerts 缓存已校验的银联签名证书
+var unionCerts sync.Map
+
+type unionSigner struct {
+	key    *rsa.PrivateKey
+	certID string // 签名证书序列号
+}
+
+// UnionPayment 银联在线网关支付实现
+type UnionPayment struct {
+	client *http.Client
+	config *config.Union
+	signer *unionSigner
+}
+
+func init() {
+	Register(Provider{
+		Method: model.PaymentUnion, Name: "银联支付", Icon: "fas fa-credit-card", Color: "#E60012",
+		Refund:  true,
+		Enabled: configured(config.GetUnionConfig),
+		New:     func() IPayment { return NewUnionPayment() },
+	})
+}
+
+// NewUnionPayment 创建银联支付实例
+func NewUnionPayment() *UnionPayment {
+	return &UnionPayment{}
+}
+
+// ensureClientReady 确保客户端已准备就绪
+func (u *UnionPayment) ensureClientReady() error {
+	if u.config != nil && u.signer != nil {
+		return nil
+	}
+
+	// 获取配置
+	provider := config.GetUnionConfig()
+	if provider == nil {
+		return consts.ErrPaymentProviderNotConfigured
+	}
+	if provider.SignCert == "" || provider.MiddleCert == "" || provider.RootCert == "" {
+		return fmt.Errorf("%w: union sign, middle and root certs required", consts.ErrPaymentConfigIncomplete)
+	}
+
+	signer, err := loadUnionSigner(provider.SignCert, provider.SignPass)
+	if err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrPaymentClientCreationFailed, err)
+	}
+
+	u.client = &http.Client{Timeout: 30 * time.Second}
+	u.config = provider
+	u.signer = signer
+	return nil
+}
+
+// Create 创建银联支付订单，用户打开支付链接时提交签名表单跳转到银联
+func (u *UnionPayment) Create(order *model.OrderModel) error {
+	// 检查配置和初始化客户端
+	if err := u.ensureClientReady(); err != nil {
+		return err
+	}
+
+	// 银联网关按人民币结算
+	if err := requireCurrency(order, "CNY"); err != nil {
+		return err
+	}
+
+	// 交易时间取订单创建时间，查询需要原交易时间，截断到秒保证保存后一致
+	order.CreatedAt = order.CreatedAt.Truncate(time.Second)
+	order.PayURL = "/api/pay/" + order.OrderID
+	order.Status = model.PaymentPending
+
+	log.Printf("[union][%s] payment created successfully", order.OrderID)
+	return nil
+}
+
+// Form 生成跳转银联的消费表单
+func (u *UnionPayment) Form(order *model.OrderModel) (string, map[string]string, error) {
+	// 检查配置和初始化客户端
+	if err := u.ensureClientReady(); err != nil {
+		return "", nil, err
+	}
+
+	channelType := "07" // 电脑网站
+	if order.Scene == model.SceneWap {
+		channelType = "08" // 手机网站
+	}
+	fields := u.fields()
+	fields["txnType"], fields["txnSubType"], fields["bizType"] = "01", "01", "000201"
+	fields["channelType"] = channelType
+	fields["orderId"] = order.OrderID
+	fields["txnTime"] = unionTime(order.CreatedAt)
+	fields["txnAmt"] = strconv.FormatInt(toMinor(order.Amount, "CNY"), 10)
+	fields["currencyCode"] = "156"
+	fields["frontUrl"] = u.config.FrontURL
+	fields["backUrl"] = u.config.BackURL
+	fields["payTimeout"] = unionTime(order.ExpiredAt)
+
+	if err := u.sign(fields); err != nil {
+		return "", nil, fmt.Errorf("%w: %v", consts.ErrPaymentSignGenerationFailed, err)
+	}
+	return u.gateway() + "/frontTransReq.do", fields, nil
+}
+
+// Query 查询银联支付状态
+func (u *UnionPayment) Query(order *model.OrderModel) error {
+	// 检查配置和初始化客户端
+	if err := u.ensureClientReady(); err != nil {
+		return err
+	}
+
+	result, err := u.query(order)
+	if err != nil {
+		return err
+	}
+	if result == nil { // 用户尚未支付，银联无此交易
+		order.Status = model.PaymentPending
+		return nil
+	}
+
+	switch result["origRespCode"] {
+	case "00", "A6":
+		// 以订单金额为准，渠道实收金额不一致时不入账
+		amount, _ := strconv.ParseFloat(result["txnAmt"], 64)
+		if err := MatchAmount(order, fromMinor(amount, "CNY"), ""); err != nil {
+			log.Printf("[union][%s] %v", order.OrderID, err)
+			return err
+		}
+		order.ThridID = result["queryId"]
+		order.Status = model.PaymentSucceed
+		log.Printf("[union][%s] payment successful", order.OrderID)
+	case "03", "04", "05":
+		order.Status = model.PaymentPending
+		log.Printf("[union][%s] payment processing", order.OrderID)
+	default:
+		order.Status = model.PaymentCanceled
+		log.Printf("[union][%s] payment failed: %s %s", order.OrderID, result["origRespCode"], result["origRespMsg"])
+	}
+	return nil
+}
+
+// Close 关闭银联支付订单，未支付的交易超过支付时限后由银联自动失效，已支付时拒绝关闭
+func (u *UnionPayment) Close(order *model.OrderModel) error {
+	// 检查配置和初始化客户端
+	if err := u.ensureClientReady(); err != nil {
+		return err
+	}
+
+	result, err := u.query(order)
+	if err != nil {
+		return err
+	}
+	if result != nil && (result["origRespCode"] == "00" || result["origRespCode"] == "A6") {
+		return fmt.Errorf("%w: order already paid", consts.ErrPaymentCloseError)
+	}
+
+	log.Printf("[union][%s] order closed locally", order.OrderID)
+	return nil
+}
+
+// Refund 银联退货，同步应答只表示受理，退款结果以异步通知为准
+func (u *UnionPayment) Refund(order *model.OrderModel, refund *model.RefundModel) error {
+	// 检查配置和初始化客户端
+	if err := u.ensureClientReady(); err != nil {
+		return err
+	}
+
+	// 退货需要原消费交易的查询流水号
+	queryID := order.ThridID
+	if queryID == "" {
+		result, err := u.query(order)
+		if err != nil {
+			return err
+		}
+		if result == nil || result["queryId"] == "" {
+			return fmt.Errorf("%w: original transaction not found", consts.ErrOrderCannotBeRefunded)
+		}
+		queryID = result["queryId"]
+	}
+
+	fields := u.fields()
+	fields["txnType"], fields["txnSubType"], fields["bizType"] = "04", "00", "000201"
+	fields["channelType"] = "07"
+	fields["orderId"] = refund.RefundID
+	fields["origQryId"] = queryID
+	fields["txnTime"] = unionTime(time.Now())
+	fields["txnAmt"] = strconv.FormatInt(toMinor(refund.Amount, "CNY"), 10)
+	fields["backUrl"] = u.config.BackURL
+
+	result, err := u.post("/backTransReq.do", fields)
+	if err != nil {
+		log.Printf("[union][%s] refund failed: %v", order.OrderID, err)
+		return fmt.Errorf("%w: %v", consts.ErrPaymentRefundFailed, err)
+	}
+	switch result["respCode"] {
+	case "00", "03", "04", "05":
+		log.Printf("[union][%s] refund accepted, refund_id: %s", order.OrderID, refund.RefundID)
+		return consts.ErrRefundProcessing
+	default:
+		log.Printf("[union][%s] refund error: %s %s", order.OrderID, result["respCode"], result["respMsg"])
+		return fmt.Errorf("%w: %s %s", consts.ErrRefundNotSuccessful, result["respCode"], result["respMsg"])
+	}
+}
+
+// Webhook 银联异步通知，按通知中的签名证书验签并校验证书链
+func (u *UnionPayment) Webhook(req *http.Request) (*Event, error) {
+	// 检查配置和初始化客户端
+	if err := u.ensureClientReady(); err != nil {
+		return nil, err
+	}
+
+	if err := req.ParseForm(); err != nil {
+		log.Printf("[union] failed to parse notify: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookEventParseFailed, err)
+	}
+	fields := make(map[string]string, len(req.PostForm))
+	for key := range req.PostForm {
+		fields[key] = req.PostForm.Get(key)
+	}
+	if err := u.verify(fields); err != nil {
+		log.Printf("[union] notify signature verification failed: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookSignatureVerificationFailed, err)
+	}
+	if fields["merId"] != u.config.MerID {
+		return nil, fmt.Errorf("%w: merId %s", consts.ErrWebhookSignatureVerificationFailed, fields["merId"])
+	}
+
+	log.Printf("[union] received notify: txnType %s, orderId %s, respCode %s", fields["txnType"], fields["orderId"], fields["respCode"])
+	if fields["txnType"] == "04" { // 退货通知，orderId 为提交的退款单号
+		return u.refundEvent(fields), nil
+	}
+	if fields["txnType"] != "01" { // 撤销等其他通知无需处理
+		return nil, nil
+	}
+
+	status := EventStatusFailed
+	if fields["respCode"] == "00" || fields["respCode"] == "A6" {
+		status = EventStatusSuccess
+	}
+	event := &Event{
+		ID: fields["queryId"], Type: "consume", OrderID: fields["orderId"],
+		Status: status, Time: time.Now().Unix(),
+		Data: object{"query_id": fields["queryId"], "resp_code": fields["respCode"]},
+	}
+	if event.ID == "" {
+		event.ID = fields["orderId"] + fields["txnTime"]
+	}
+	if status == EventStatusSuccess {
+		amount, _ := strconv.ParseFloat(fields["txnAmt"], 64)
+		event.Amount = fromMinor(amount, "CNY")
+		if fields["currencyCode"] == "156" {
+			event.Currency = "CNY"
+		}
+	}
+	return event, nil
+}
+
+// refundEvent 将退货通知转换为退款事件，由退款流程按退款单号确认或释放
+func (u *UnionPayment) refundEvent(fields map[string]string) *Event {
+	status := EventStatusFailed
+	if fields["respCode"] == "00" || fields["respCode"] == "A6" {
+		status = EventStatusRefunded
+	}
+	event := &Event{
+		ID: fields["queryId"], Type: "refund", RefundID: fields["orderId"],
+		Status: status, Time: time.Now().Unix(),
+		Data: object{"query_id": fields["queryId"], "resp_code": fields["respCode"], "resp_msg": fields["respMsg"]},
+	}
+	if event.ID == "" {
+		event.ID = fields["orderId"] + fields["txnTime"]
+	}
+	amount, _ := strconv.ParseFloat(fields["txnAmt"], 64)
+	event.Amount = fromMinor(amount, "CNY")
+	if fields["currencyCode"] == "156" {
+		event.Currency = "CNY"
+	}
+	return event
+}
+
+// query 查询原消费交易，交易不存在时返回 nil
+func (u *UnionPayment) query(order *model.OrderModel) (map[string]string, error) {
+	fields := u.fields()
+	fields["txnType"], fields["txnSubType"], fields["bizType"] = "00", "00", "000000"
+	fields["orderId"] = order.OrderID
+	fields["txnTime"] = unionTime(order.CreatedAt)
+
+	result, err := u.post("/queryTrans.do", fields)
+	if err != nil {
+		log.Printf("[union][%s] payment query failed: %v", order.OrderID, err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrPaymentQueryFailed, err)
+	}
+	switch result["respCode"] {
+	case "00":
+		return result, nil
+	case "34": // 查无此交易
+		return nil, nil
+	default:
+		log.Printf("[union][%s] payment query error: %s %s", order.OrderID, result["respCode"], result["respMsg"])
+		return nil, fmt.Errorf("%w: %s %s", consts.ErrPaymentQueryFailed, result["respCode"], result["respMsg"])
+	}
+}
+
+// post 签名后调用后台接口，并校验应答签名
+func (u *UnionPayment) post(path string, fields map[string]string) (map[string]string, error) {
+	if err := u.sign(fields); err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrPaymentSignGenerationFailed, err)
+	}
+	form := make(url.Values, len(fields))
+	for key, value := range fields {
+		form.Set(key, value)
+	}
+
+	resp, err := u.client.PostForm(u.gateway()+path, form)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrRequestSendFailed, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrResponseReadFailed, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", consts.ErrAPIRequestFailed, resp.StatusCode)
+	}
+
+	result := parseUnionResponse(string(body))
+	if result["signature"] != "" {
+		if err := u.verify(result); err != nil {
+			return nil, fmt.Errorf("%w: %v", consts.ErrSignatureMismatch, err)
+		}
+	}
+	return result, nil
+}
+
+// fields 各接口的公共参数
+func (u *UnionPayment) fields() map[string]string {
+	return map[string]string{
+		"version": unionVersion, "encoding": "UTF-8", "signMethod": "01",
+		"accessType": "0", "merId": u.config.MerID,
+	}
+}
+
+func (u *UnionPayment) gateway() string {
+	if u.config.Live {
+		return unionGatewayLive
+	}
+	return unionGatewaySandbox
+}
+
+// sign 签名：待签名串的 SHA-256 十六进制摘要再做 SHA256withRSA
+func (u *UnionPayment) sign(fields map[string]string) error {
+	fields["certId"] = u.signer.certID
+	digest := unionDigest(fields)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, u.signer.key, crypto.SHA256, digest)
+	if err != nil {
+		return err
+	}
+	fields["signature"] = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// verify 使用报文携带的签名证书验签，证书须由银联中级和根证书签发
+func (u *UnionPayment) verify(fields map[string]string) error {
+	signature, err := base64.StdEncoding.DecodeString(fields["signature"])
+	if err != nil || len(signature) == 0 {
+		return fmt.Errorf("invalid signature")
+	}
+	cert, err := u.verifyCert(fields["signPubKeyCert"])
+	if err != nil {
+		return err
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported certificate key type")
+	}
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, unionDigest(fields), signature)
+}
+
+// verifyCert 校验签名证书的证书链、有效期和所有者
+func (u *UnionPayment) verifyCert(data string) (*x509.Certificate, error) {
+	if cached, ok := unionCerts.Load(data); ok {
+		if cert := cached.(*x509.Certificate); time.Now().Before(cert.NotAfter) {
+			return cert, nil
+		}
+	}
+
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("missing signPubKeyCert")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse signPubKeyCert: %v", err)
+	}
+
+	roots, err := loadCertPool(u.config.RootCert)
+	if err != nil {
+		return nil, err
+	}
+	intermediates, err := loadCertPool(u.config.MiddleCert)
+	if err != nil {
+		return nil, err
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots: roots, Intermediates: intermediates,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verify signPubKeyCert: %v", err)
+	}
+
+	// 证书所有者为 CN 中以 @ 分隔的第三段
+	parts := strings.Split(cert.Subject.CommonName, "@")
+	if len(parts) < 3 || (parts[2] != unionCNName && (u.config.Live || parts[2] != unionTestCNName)) {
+		return nil, fmt.Errorf("untrusted signPubKeyCert owner: %s", cert.Subject.CommonName)
+	}
+
+	unionCerts.Store(data, cert)
+	return cert, nil
+}
+
+// unionDigest 按参数名排序拼接待签名串，对其 SHA-256 十六进制摘要再取 SHA-256
+func unionDigest(fields map[string]string) []byte {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		if key != "signature" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+fields[key])
+	}
+	sum := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+	digest := sha256.Sum256([]byte(hex.EncodeToString(sum[:])))
+	return digest[:]
+}
+
+// parseUnionResponse 解析后台接口应答，值未做 URL 编码，按第一个等号切分
+func parseUnionResponse(body string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(strings.TrimSpace(body), "&") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// unionTime 格式化为银联交易时间
+func unionTime(t time.Time) string {
+	return t.In(cnTimezone).Format("20060102150405")
+}
+
+// loadUnionSigner 从 pfx 证书中读取签名私钥和证书序列号
+func loadUnionSigner(path, password string) (*unionSigner, error) {
+	if cached, ok := unionSigners.Load(path); ok {
+		return cached.(*unionSigner), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("decode sign cert: %v", err)
+	}
+
+	var key *rsa.PrivateKey
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case "PRIVATE KEY":
+			if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				return nil, fmt.Errorf("parse sign key: %v", err)
+			}
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse sign cert: %v", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("sign key not found")
+	}
+	for _, cert := range certs {
+		if pub, ok := cert.PublicKey.(*rsa.PublicKey); ok && pub.Equal(&key.PublicKey) {
+			signer := &unionSigner{key: key, certID: cert.SerialNumber.String()}
+			unionSigners.Store(path, signer)
+			return signer, nil
+		}
+	}
+	return nil, fmt.Errorf("sign cert not found")
+}
+
+// loadCertPool 读取证书文件，支持 PEM 和 DER 格式
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if pool.AppendCertsFromPEM(data) {
+		return pool, nil
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	pool.AddCert(cert)
+	return pool, nil
+}
@@ -21,6 +21,15 @@ type WechatPayment struct {
 	config *config.Wechat
 }
 
+func init() {
+	Register(Provider{
+		Method: model.PaymentWechat, Name: "微信支付", Icon: "fab fa-weixin", Color: "#07C160",
+		Refund: true, QRCode: true,
+		Enabled: configured(config.GetWechatConfig),
+		New:     func() IPayment { return NewWechatPayment() },
+	})
+}
+
 // NewWechatPayment 创建微信支付实例
 func NewWechatPayment() *WechatPayment {
 	return &WechatPayment{}
@@ -56,20 +65,12 @@ func (w *WechatPayment) Create(order *model.OrderModel) error {
 		return err
 	}
 
-	// 根据套餐类型设置价格（微信支付使用分为单位）
-	var amount int
-	switch order.PayPlan {
-	case model.PlanBasic:
-		amount = 990 // 9.9元 = 990分
-	case model.PlanExtra:
-		amount = 1990 // 19.9元 = 1990分
-	case model.PlanUltra:
-		amount = 3990 // 39.9元 = 3990分
-	case model.PlanSuper:
-		amount = 9990 // 99.9元 = 9990分
-	default:
-		amount = 990
+	// 境内商户号仅支持人民币
+	if err := requireCurrency(order, "CNY"); err != nil {
+		return err
 	}
+	// 按订单金额支付（微信支付使用分为单位）
+	amount := toMinor(order.Amount, "CNY")
 
 	// 设置订单过期时间（10分钟后）
 	expire := time.Now().Add(10 * time.Minute).Format(time.RFC3339)
@@ -112,7 +113,6 @@ func (w *WechatPayment) Create(order *model.OrderModel) error {
 	// 更新订单状态
 	order.PayURL = fmt.Sprintf("jsapi://%s", jsapi.Package) // 存储支付包信息
 	order.Status = model.PaymentPending
-	order.Amount = float64(amount) / 100 // 转换为元
 	order.CreatedAt = time.Now()
 
 	log.Printf("[wechat][%s] payment order created, amount: %.2f yuan", order.OrderID, order.Amount)
@@ -144,6 +144,14 @@ func (w *WechatPayment) Query(order *model.OrderModel) error {
 	// 根据微信返回的交易状态更新订单状态
 	switch wxRsp.Response.TradeState {
 	case "SUCCESS":
+		// 以订单金额为准，渠道实收金额不一致时不入账
+		if paid := wxRsp.Response.Amount; paid != nil {
+			amount := fromMinor(float64(paid.Total), paid.Currency)
+			if err := MatchAmount(order, amount, paid.Currency); err != nil {
+				log.Printf("[wechat][%s] %v", order.OrderID, err)
+				return err
+			}
+		}
 		order.Status = model.PaymentSucceed
 		log.Printf("[wechat][%s] payment successful", order.OrderID)
 	case "REFUND":
@@ -201,7 +209,7 @@ func (w *WechatPayment) Close(order *model.OrderModel) error {
 }
 
 // Refund 微信支付退款
-func (w *WechatPayment) Refund(order *model.OrderModel) error {
+func (w *WechatPayment) Refund(order *model.OrderModel, refund *model.RefundModel) error {
 	// 检查配置和初始化客户端
 	if err := w.ensureClientReady(); err != nil {
 		return err
@@ -210,12 +218,12 @@ func (w *WechatPayment) Refund(order *model.OrderModel) error {
 	// 创建退款请求参数
 	bodyMap := make(gopay.BodyMap)
 	bodyMap.Set("out_trade_no", order.OrderID).
-		Set("out_refund_no", "refund_"+order.OrderID).
-		Set("reason", "用户申请退款").
+		Set("out_refund_no", refund.RefundID).
+		Set("reason", refund.Reason).
 		SetBodyMap("amount", func(bm gopay.BodyMap) {
 			// 转换为分
-			bm.Set("refund", int(order.Amount*100)).
-				Set("total", int(order.Amount*100)).
+			bm.Set("refund", toMinor(refund.Amount, "CNY")).
+				Set("total", toMinor(order.Amount, "CNY")).
 				Set("currency", "CNY")
 		})
 
@@ -233,7 +241,6 @@ func (w *WechatPayment) Refund(order *model.OrderModel) error {
 	}
 
 	log.Printf("[wechat][%s] refund processed successfully, refund_id: %s", order.OrderID, wxRsp.Response.RefundId)
-	order.Status = "refunded"
 	return nil
 }
 
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"path"
+
+	"llm-member/internal/model"
+)
+
+type AccessService struct {
+	relayService *RelayService
+}
+
+func NewAccessService() *AccessService {
+	return &AccessService{relayService: NewRelayService()}
+}
+
+// Allowed 检查用户是否可以调用指定模型
+// 优先级：用户禁用 > 用户允许 > 套餐禁用 > 套餐允许（为空表示全部）
+func (s *AccessService) Allowed(plan *model.PlanInfo, user *model.UserModel, name string) bool {
+	if access := user.ModelAccess; access != nil {
+		if matchModel(access.Deny, name) {
+			return false
+		}
+		if matchModel(access.Allow, name) {
+			return true
+		}
+	}
+	if plan == nil || plan.Entitlements == nil {
+		return true
+	}
+	ent := plan.Entitlements
+	if matchModel(ent.DenyModels, name) {
+		return false
+	}
+	return len(ent.Models) == 0 || matchModel(ent.Models, name)
+}
+
+// GetModels 获取用户可以调用的模型列表
+func (s *AccessService) GetModels(plan *model.PlanInfo, user *model.UserModel) []model.LLModelInfo {
+	models := []model.LLModelInfo{}
+	for _, item := range s.relayService.GetModels() {
+		if s.Allowed(plan, user, item.ID) {
+			models = append(models, item)
+		}
+	}
+	return models
+}
+
+// matchModel 模型名是否匹配列表中的任一模式
+func matchModel(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
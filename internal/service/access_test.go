@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	"llm-member/internal/model"
+)
+
+func TestDefaultPlanModelAccess(t *testing.T) {
+	plans := map[string]*model.PlanInfo{}
+	for _, plan := range (&SetupService{}).GetDefaultPlan() {
+		plans[plan.Plan] = &plan
+	}
+	tests := []struct {
+		plan    string
+		model   string
+		allowed bool
+	}{
+		{"basic", "gpt-4o-mini", true},
+		{"basic", "gpt-3.5-turbo", true},
+		{"basic", "claude-3-5-haiku-20241022", true},
+		{"basic", "deepseek-chat", true},
+		{"basic", "gpt-4", false},
+		{"basic", "gpt-4o", false},
+		{"basic", "claude-3-opus-20240229", false},
+		{"basic", "qwen-max", false},
+		{"extra", "gpt-4", true},
+		{"extra", "claude-3-opus-20240229", true},
+	}
+	s := &AccessService{}
+	for _, tt := range tests {
+		t.Run(tt.plan+"/"+tt.model, func(t *testing.T) {
+			got := s.Allowed(plans[tt.plan], &model.UserModel{}, tt.model)
+			if got != tt.allowed {
+				t.Errorf("Allowed(%s, %s) = %v, want %v", tt.plan, tt.model, got, tt.allowed)
+			}
+		})
+	}
+}
@@ -134,7 +134,7 @@ func (s *AuthService) SignUp(req *model.SignUpRequest) (*model.UserModel, error)
 	user := &model.UserModel{
 		Email: req.Email, Username: req.Username,
 		APIKey: apiKey, Password: string(hashedPassword),
-		UserRole: model.RoleUser, UserPlan: model.PlanBasic,
+		UserRole: model.RoleUser, UserPlan: model.PayPlan(config.GetDefaultPlan()),
 	}
 	if err := s.userS.CreateUser(user); err != nil {
 		return nil, fmt.Errorf("%w: %v", consts.ErrUserCreationFailed, err)
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// memoryCache 无 Redis 时使用的进程内 LRU 缓存，首次使用时按配置容量创建
+var memoryCache struct {
+	once  sync.Once
+	cache *lruCache
+}
+
+func getMemoryCache() *lruCache {
+	memoryCache.once.Do(func() {
+		memoryCache.cache = newLRUCache(config.GetCacheSize())
+	})
+	return memoryCache.cache
+}
+
+type CacheService struct {
+	redis *redis.Client
+}
+
+func NewCacheService() *CacheService {
+	return &CacheService{redis: config.GetRedis()}
+}
+
+// cacheKeyData 参与缓存键计算的规范化请求
+type cacheKeyData struct {
+	Model       string              `json:"model"`
+	Messages    []model.ChatMessage `json:"messages"`
+	Temperature *float32            `json:"temperature"`
+	MaxTokens   *int                `json:"max_tokens"`
+	TopP        *float32            `json:"top_p"`
+}
+
+// IsCacheable 仅缓存确定性请求（temperature = 0）
+func (s *CacheService) IsCacheable(req *model.ChatRequest) bool {
+	return req.Temperature != nil && *req.Temperature == 0
+}
+
+// BuildKey 根据规范化后的请求计算缓存键
+func (s *CacheService) BuildKey(req *model.ChatRequest) string {
+	data := cacheKeyData{
+		Model:       strings.TrimSpace(req.Model),
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		TopP:        req.TopP,
+	}
+	for _, msg := range req.Messages {
+		data.Messages = append(data.Messages, model.ChatMessage{
+			Role:    strings.ToLower(strings.TrimSpace(msg.Role)),
+			Content: strings.TrimSpace(msg.Content),
+		})
+	}
+	raw, _ := json.Marshal(data)
+	sum := sha256.Sum256(raw)
+	return "cache:chat:" + hex.EncodeToString(sum[:])
+}
+
+// Get 读取缓存的响应
+func (s *CacheService) Get(key string) (*model.ChatResponse, bool) {
+	if s.redis == nil {
+		return getMemoryCache().Get(key)
+	}
+
+	data, err := s.redis.Get(context.Background(), key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("[CACHE] redis get failed: %v", err)
+		}
+		return nil, false
+	}
+	var resp model.ChatResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, false
+	}
+	return &resp, true
+}
+
+// Set 写入缓存
+func (s *CacheService) Set(key string, resp *model.ChatResponse, ttl time.Duration) {
+	if resp == nil || ttl <= 0 {
+		return
+	}
+	if s.redis == nil {
+		getMemoryCache().Set(key, resp, ttl)
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	if err := s.redis.Set(context.Background(), key, data, ttl).Err(); err != nil {
+		log.Printf("[CACHE] redis set failed: %v", err)
+	}
+}
+
+// lruCache 带过期时间的 LRU 缓存
+type lruCache struct {
+	mutex sync.Mutex
+	limit int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key    string
+	value  *model.ChatResponse
+	expire time.Time
+}
+
+func newLRUCache(limit int) *lruCache {
+	return &lruCache{
+		limit: limit, order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) Get(key string) (*model.ChatResponse, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expire) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *lruCache) Set(key string, value *model.ChatResponse, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expire := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		elem.Value = &lruEntry{key: key, value: value, expire: expire}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	entry := &lruEntry{key: key, value: value, expire: expire}
+	c.items[key] = c.order.PushFront(entry)
+	for c.limit > 0 && c.order.Len() > c.limit {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// catalogCacheTTL 模型目录缓存的有效期，发现任务只在主实例执行，其他实例据此刷新
+const catalogCacheTTL = time.Minute
+
+// catalogCache 模型目录的进程内缓存（包含已禁用的模型），写入目录或超过有效期后失效
+var catalogCache struct {
+	sync.RWMutex
+	loadedAt time.Time
+	models   []model.CatalogModel
+}
+
+type CatalogService struct {
+	db *gorm.DB
+}
+
+func NewCatalogService() *CatalogService {
+	return &CatalogService{db: config.GetDB()}
+}
+
+// upstreamModels OpenAI 兼容的 GET /models 响应
+type upstreamModels struct {
+	Data []struct {
+		ID      string `json:"id"`
+		OwnedBy string `json:"owned_by"`
+	} `json:"data"`
+}
+
+// DiscoverModels 调用上游 GET /models 并登记到模型目录
+func (s *CatalogService) DiscoverModels(ctx context.Context, name string) (int, error) {
+	provider := config.GetProvider(name)
+	if provider == nil {
+		return 0, fmt.Errorf("%w: %s", consts.ErrProviderNotConfigured, name)
+	}
+	if !provider.Discover {
+		return 0, fmt.Errorf("%w: %s", consts.ErrDiscoverNotSupported, name)
+	}
+
+	url := strings.TrimRight(provider.BaseURL, "/") + "/models"
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+provider.APIKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", consts.ErrDiscoverModelsFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("%w: %s", consts.ErrDiscoverModelsFailed, string(body))
+	}
+
+	var result upstreamModels
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("%w: %v", consts.ErrDiscoverModelsFailed, err)
+	}
+
+	// 新模型默认启用，已存在的模型保留管理员设置的启用状态
+	// 同步时间截断到秒，保证与写入数据库的值一致，用于清理本次未返回的模型
+	now := time.Now().Truncate(time.Second)
+	for _, item := range result.Data {
+		if item.ID == "" {
+			continue
+		}
+		entry := &model.CatalogModel{
+			ModelID: item.ID, Provider: name,
+			OwnedBy: item.OwnedBy, Enabled: true, SyncedAt: now,
+		}
+		err := s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "model_id"}, {Name: "provider"}},
+			DoUpdates: clause.AssignmentColumns([]string{"owned_by", "synced_at", "updated_at"}),
+		}).Create(entry).Error
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", consts.ErrDiscoverModelsFailed, err)
+		}
+	}
+	// 上游已下架的模型从目录中删除，上游返回空列表时视为异常不清理
+	if len(result.Data) > 0 {
+		removed := s.db.Unscoped().Where("provider = ? AND synced_at < ?", name, now).
+			Delete(&model.CatalogModel{})
+		if removed.Error != nil {
+			log.Printf("[CATALOG] remove stale models of %s failed: %v", name, removed.Error)
+		} else if removed.RowsAffected > 0 {
+			log.Printf("[CATALOG] removed %d stale models of %s", removed.RowsAffected, name)
+		}
+	}
+	s.invalidate()
+
+	log.Printf("[CATALOG] discovered %d models from %s", len(result.Data), name)
+	return len(result.Data), nil
+}
+
+// DiscoverAll 对所有支持自动发现的提供商执行发现
+func (s *CatalogService) DiscoverAll(ctx context.Context) map[string]any {
+	result := map[string]any{}
+	for _, provider := range config.GetProviders() {
+		if !provider.Discover {
+			continue
+		}
+		if count, err := s.DiscoverModels(ctx, provider.Name); err != nil {
+			log.Printf("[CATALOG] discover %s failed: %v", provider.Name, err)
+			result[provider.Name] = err.Error()
+		} else {
+			result[provider.Name] = count
+		}
+	}
+	return result
+}
+
+// StartDiscovery 注册模型发现任务，启动时由主实例立即执行一次
+func (s *CatalogService) StartDiscovery(interval time.Duration) {
+	jobs := NewJobService()
+	jobs.Register("catalog-discover", interval, s.discover)
+	go jobs.Run("catalog-discover")
+}
+
+// discover 定时发现任务，返回发现成功和失败的提供商数量
+func (s *CatalogService) discover() (int, int, error) {
+	var processed, failed int
+	for _, result := range s.DiscoverAll(context.Background()) {
+		if _, ok := result.(int); ok {
+			processed++
+		} else {
+			failed++
+		}
+	}
+	return processed, failed, nil
+}
+
+// GetCatalog 获取模型目录（包含已禁用的模型）
+func (s *CatalogService) GetCatalog() ([]model.CatalogModel, error) {
+	var models []model.CatalogModel
+	err := s.db.Order("provider, model_id").Find(&models).Error
+	return models, err
+}
+
+// ToggleModel 启用或禁用目录中的模型
+func (s *CatalogService) ToggleModel(id uint64, enabled bool) error {
+	result := s.db.Model(&model.CatalogModel{}).
+		Where("id = ?", id).Update("enabled", enabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return consts.ErrCatalogModelNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// GetEnabledModels 获取已启用的目录模型
+func (s *CatalogService) GetEnabledModels() []model.CatalogModel {
+	var enabled []model.CatalogModel
+	for _, item := range s.loadModels() {
+		if item.Enabled {
+			enabled = append(enabled, item)
+		}
+	}
+	return enabled
+}
+
+// FindProvider 根据模型 ID 查找其所属的提供商，disabled 表示模型仅存在于已禁用的条目
+func (s *CatalogService) FindProvider(modelID string) (provider string, disabled bool) {
+	for _, item := range s.loadModels() {
+		if item.ModelID != modelID {
+			continue
+		}
+		if item.Enabled {
+			return item.Provider, false
+		}
+		disabled = true
+	}
+	return "", disabled
+}
+
+// loadModels 加载模型目录，包含已禁用的模型
+func (s *CatalogService) loadModels() []model.CatalogModel {
+	catalogCache.RLock()
+	if time.Since(catalogCache.loadedAt) < catalogCacheTTL {
+		defer catalogCache.RUnlock()
+		return catalogCache.models
+	}
+	catalogCache.RUnlock()
+
+	catalogCache.Lock()
+	defer catalogCache.Unlock()
+	if time.Since(catalogCache.loadedAt) < catalogCacheTTL {
+		return catalogCache.models
+	}
+	var models []model.CatalogModel
+	if err := s.db.Order("provider, model_id").Find(&models).Error; err != nil {
+		log.Printf("[CATALOG] load models failed: %v", err)
+		return nil
+	}
+	catalogCache.models, catalogCache.loadedAt = models, time.Now()
+	return models
+}
+
+func (s *CatalogService) invalidate() {
+	catalogCache.Lock()
+	catalogCache.loadedAt = time.Time{}
+	catalogCache.models = nil
+	catalogCache.Unlock()
+}
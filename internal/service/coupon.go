@@ -0,0 +1,194 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CouponService struct {
+	db *gorm.DB
+}
+
+func NewCouponService() *CouponService {
+	return &CouponService{db: config.GetDB()}
+}
+
+// GetCoupons 获取全部优惠券
+func (s *CouponService) GetCoupons() ([]model.CouponModel, error) {
+	var coupons []model.CouponModel
+	err := s.db.Order("id DESC").Find(&coupons).Error
+	return coupons, err
+}
+
+// SaveCoupon 新增或按优惠码更新优惠券，不影响已兑换次数
+func (s *CouponService) SaveCoupon(req *model.CouponRequest) (*model.CouponModel, error) {
+	code := normalizeCoupon(req.Code)
+	if code == "" || len(code) > 64 {
+		return nil, fmt.Errorf("%w: invalid code", consts.ErrInvalidCoupon)
+	}
+	if req.Kind == model.CouponPercent && req.Value > 100 {
+		return nil, fmt.Errorf("%w: percent must not exceed 100", consts.ErrInvalidCoupon)
+	}
+
+	var plans []string
+	for _, plan := range req.Plans {
+		if plan = strings.TrimSpace(plan); plan != "" {
+			plans = append(plans, plan)
+		}
+	}
+	coupon := model.CouponModel{
+		Code: code, Kind: req.Kind, Value: req.Value, Plans: plans,
+		ExpireAt: req.ExpireAt, MaxRedeem: req.MaxRedeem, PerUser: req.PerUser,
+		Enabled: req.Enabled, Remark: req.Remark,
+	}
+
+	var exist model.CouponModel
+	err := s.db.Where("code = ?", code).First(&exist).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &coupon, s.db.Create(&coupon).Error
+	} else if err != nil {
+		return nil, err
+	}
+	err = s.db.Model(&exist).Select(
+		"kind", "value", "plans", "expire_at", "max_redeem",
+		"per_user", "enabled", "remark",
+	).Updates(&coupon).Error
+	if err != nil {
+		return nil, err
+	}
+	return &exist, s.db.First(&exist, exist.ID).Error
+}
+
+// ToggleCoupon 启用或停用优惠券
+func (s *CouponService) ToggleCoupon(id uint64, enabled bool) error {
+	result := s.db.Model(&model.CouponModel{}).
+		Where("id = ?", id).Update("enabled", enabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return consts.ErrCouponNotFound
+	}
+	return nil
+}
+
+// Redeem 在创建订单的事务中校验优惠码并计入兑换次数，同时写入订单的优惠金额
+func (s *CouponService) Redeem(tx *gorm.DB, order *model.OrderModel, code string) error {
+	var coupon model.CouponModel
+	err := tx.Where("code = ? AND enabled = ?", normalizeCoupon(code), true).
+		First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return consts.ErrCouponNotFound
+	} else if err != nil {
+		return err
+	}
+	if coupon.ExpireAt != nil && time.Now().After(*coupon.ExpireAt) {
+		return consts.ErrCouponExpired
+	}
+	if len(coupon.Plans) > 0 && !slices.Contains(coupon.Plans, string(order.PayPlan)) {
+		return consts.ErrCouponNotApplicable
+	}
+	discount := couponDiscount(&coupon, order.Amount)
+	if discount <= 0 {
+		return consts.ErrCouponNotApplicable
+	}
+
+	// 条件更新保证并发下不会超出总次数，同时锁定优惠券行
+	result := tx.Model(&model.CouponModel{}).
+		Where("id = ? AND (max_redeem = 0 OR redeemed < max_redeem)", coupon.ID).
+		UpdateColumn("redeemed", gorm.Expr("redeemed + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return consts.ErrCouponExhausted
+	}
+	if coupon.PerUser > 0 {
+		var used int64
+		err := tx.Model(&model.CouponRedemptionModel{}).
+			Where("coupon_id = ? AND user_id = ?", coupon.ID, order.UserID).
+			Count(&used).Error
+		if err != nil {
+			return err
+		}
+		if used >= int64(coupon.PerUser) {
+			return consts.ErrCouponUserLimit
+		}
+	}
+
+	redemption := model.CouponRedemptionModel{
+		CouponID: coupon.ID, UserID: order.UserID,
+		OrderID: order.OrderID, Discount: discount,
+	}
+	if err := tx.Create(&redemption).Error; err != nil {
+		return err
+	}
+	order.OrigAmount, order.Discount, order.Coupon = order.Amount, discount, coupon.Code
+	order.Amount = roundAmount(order.Amount - discount)
+	return nil
+}
+
+// Release 订单取消时归还优惠码的兑换次数
+func (s *CouponService) Release(orderID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var redemption model.CouponRedemptionModel
+		err := tx.Where("order_id = ?", orderID).First(&redemption).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := tx.Delete(&redemption).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.CouponModel{}).
+			Where("id = ? AND redeemed > 0", redemption.CouponID).
+			UpdateColumn("redeemed", gorm.Expr("redeemed - 1")).Error
+	})
+}
+
+// Restore 在支付成功的事务中恢复已归还的兑换记录，用于关单后才确认支付的订单
+// 用户已按优惠价付款，不再校验兑换次数上限
+func (s *CouponService) Restore(tx *gorm.DB, order *model.OrderModel) error {
+	var coupon model.CouponModel
+	if err := tx.Where("code = ?", order.Coupon).First(&coupon).Error; err != nil {
+		return err
+	}
+	redemption := model.CouponRedemptionModel{
+		CouponID: coupon.ID, UserID: order.UserID,
+		OrderID: order.OrderID, Discount: order.Discount,
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&redemption)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return tx.Model(&model.CouponModel{}).Where("id = ?", coupon.ID).
+		UpdateColumn("redeemed", gorm.Expr("redeemed + 1")).Error
+}
+
+// couponDiscount 计算优惠金额，不超过订单金额
+func couponDiscount(coupon *model.CouponModel, amount float64) float64 {
+	var discount float64
+	switch coupon.Kind {
+	case model.CouponPercent:
+		discount = amount * coupon.Value / 100
+	case model.CouponFixed:
+		discount = coupon.Value
+	}
+	return roundAmount(math.Min(discount, amount))
+}
+
+func normalizeCoupon(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
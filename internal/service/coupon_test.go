@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"llm-member/internal/model"
+)
+
+func TestCouponDiscount(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   model.CouponKind
+		value  float64
+		amount float64
+		want   float64
+	}{
+		{"percent", model.CouponPercent, 20, 50, 10},
+		{"percent rounded to cents", model.CouponPercent, 15, 33.33, 5},
+		{"full percent", model.CouponPercent, 100, 99.9, 99.9},
+		{"percent over 100 capped", model.CouponPercent, 120, 10, 10},
+		{"fixed", model.CouponFixed, 10, 30, 10},
+		{"fixed equals amount", model.CouponFixed, 30, 30, 30},
+		{"fixed larger than amount", model.CouponFixed, 50, 30, 30},
+		{"zero amount", model.CouponFixed, 5, 0, 0},
+		{"unknown kind", model.CouponKind("other"), 10, 30, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coupon := &model.CouponModel{Kind: tt.kind, Value: tt.value}
+			if got := couponDiscount(coupon, tt.amount); got != tt.want {
+				t.Errorf("couponDiscount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/model"
+)
+
+// cycleMonthDays 按天计的套餐短于此天数时，计费周期按套餐天数滚动
+const cycleMonthDays = 28
+
+// GetUsageWindow 计算用户当前的用量窗口
+// 日窗口从配置时区的零点开始；计费周期以套餐购买时间为锚点滚动，
+// 一个月及以上的套餐按月滚动，更短的套餐按套餐天数滚动
+func GetUsageWindow(user *model.UserModel, now time.Time) model.UsageWindow {
+	loc := config.GetTimezone()
+	now = now.In(loc)
+	anchor := cycleAnchor(user, now).In(loc)
+	window := model.UsageWindow{
+		DayStart: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc),
+	}
+
+	if days := cycleDays(user.ApiLimit); days > 0 {
+		periods := int(now.Sub(anchor).Hours()/24) / days
+		if periods < 0 || now.Before(anchor) { // 锚点在未来时从锚点开始计算
+			periods = 0
+		}
+		// 按日期偏移，修正夏令时切换导致的一小时偏差
+		if periods > 0 && anchor.AddDate(0, 0, periods*days).After(now) {
+			periods--
+		} else if !anchor.AddDate(0, 0, (periods+1)*days).After(now) {
+			periods++
+		}
+		window.CycleStart = anchor.AddDate(0, 0, periods*days)
+		window.CycleEnd = anchor.AddDate(0, 0, (periods+1)*days)
+		return window
+	}
+
+	months := (now.Year()-anchor.Year())*12 + int(now.Month()-anchor.Month())
+	start := addMonths(anchor, months)
+	if start.After(now) {
+		months--
+		start = addMonths(anchor, months)
+	}
+	if months < 0 { // 锚点在未来时从锚点开始计算
+		months, start = 0, anchor
+	}
+	window.CycleStart, window.CycleEnd = start, addMonths(anchor, months+1)
+	return window
+}
+
+// cycleDays 短周期套餐的计费周期天数，按月滚动时返回 0
+func cycleDays(limit *model.ApiLimit) int {
+	if limit == nil || limit.ExpireMonths > 0 || limit.ExpireDays >= cycleMonthDays {
+		return 0
+	}
+	return limit.ExpireDays
+}
+
+// CurrentUsage 按当前窗口返回用户已用量，统计之后窗口已滚动的部分视为 0
+func CurrentUsage(user *model.UserModel, now time.Time) model.ApiUsage {
+	if user.ApiUsage == nil {
+		return model.ApiUsage{}
+	}
+	usage, window := *user.ApiUsage, GetUsageWindow(user, now)
+	if usage.DayStart == nil || usage.DayStart.Before(window.DayStart) {
+		usage.TodayTokens, usage.TodayRequests = 0, 0
+		usage.TodayProjects, usage.TodayCost = 0, 0
+	}
+	if usage.CycleStart == nil || usage.CycleStart.Before(window.CycleStart) {
+		usage.TotalTokens, usage.TotalRequests = 0, 0
+		usage.TotalProjects, usage.TotalCost = 0, 0
+	}
+	return usage
+}
+
+// cycleAnchor 获取计费周期锚点，未记录时按套餐过期时间倒推，再退回注册时间
+func cycleAnchor(user *model.UserModel, now time.Time) time.Time {
+	if user.CycleAnchor != nil {
+		return *user.CycleAnchor
+	}
+	if user.ExpireAt != nil && user.ApiLimit != nil &&
+		(user.ApiLimit.ExpireDays > 0 || user.ApiLimit.ExpireMonths > 0) {
+		return periodStart(user.ApiLimit, *user.ExpireAt)
+	}
+	if !user.CreatedAt.IsZero() {
+		return user.CreatedAt
+	}
+	return now
+}
+
+// addMonths 按月偏移，目标月份没有对应日期时取该月最后一天（如 1 月 31 日 -> 2 月 28 日）
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1,
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := min(t.Day(), first.AddDate(0, 1, -1).Day())
+	return first.AddDate(0, 0, day-1)
+}
+
+// periodEnd 按套餐周期计算从 from 开始的到期时间
+func periodEnd(limit *model.ApiLimit, from time.Time) time.Time {
+	return addMonths(from, limit.ExpireMonths).AddDate(0, 0, limit.ExpireDays)
+}
+
+// periodStart 按套餐周期从到期时间倒推开始时间
+func periodStart(limit *model.ApiLimit, end time.Time) time.Time {
+	return addMonths(end, -limit.ExpireMonths).AddDate(0, 0, -limit.ExpireDays)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"llm-member/internal/model"
+)
+
+func TestMain(m *testing.M) {
+	// 用量窗口按配置时区计算，固定时区使测试结果与运行环境无关
+	os.Setenv("APP_TIMEZONE", "Asia/Shanghai")
+	os.Exit(m.Run())
+}
+
+func TestAddMonths(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 10, 30, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name   string
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{"31st to february", date(2026, 1, 31), 1, date(2026, 2, 28)},
+		{"31st to leap february", date(2028, 1, 31), 1, date(2028, 2, 29)},
+		{"31st to 30-day month", date(2026, 8, 31), 1, date(2026, 9, 30)},
+		{"31st over two months", date(2026, 12, 31), 2, date(2027, 2, 28)},
+		{"backwards to february", date(2026, 3, 31), -1, date(2026, 2, 28)},
+		{"across year", date(2026, 11, 15), 3, date(2027, 2, 15)},
+		{"zero months", date(2026, 5, 31), 0, date(2026, 5, 31)},
+		{"twelve months from leap day", date(2028, 2, 29), 12, date(2029, 2, 28)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addMonths(tt.from, tt.months); !got.Equal(tt.want) {
+				t.Errorf("addMonths(%v, %d) = %v, want %v", tt.from, tt.months, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetUsageWindow(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	date := func(y int, m time.Month, d, h int) time.Time {
+		return time.Date(y, m, d, h, 0, 0, 0, loc)
+	}
+	monthly := &model.ApiLimit{ExpireMonths: 1}
+	weekly := &model.ApiLimit{ExpireDays: 7}
+	longDays := &model.ApiLimit{ExpireDays: 30}
+
+	tests := []struct {
+		name      string
+		limit     *model.ApiLimit
+		anchor    time.Time
+		now       time.Time
+		dayStart  time.Time
+		cycleFrom time.Time
+		cycleTo   time.Time
+	}{
+		{
+			"monthly anchored on 31st in february", monthly,
+			date(2026, 1, 31, 10), date(2026, 2, 15, 12),
+			date(2026, 2, 15, 0), date(2026, 1, 31, 10), date(2026, 2, 28, 10),
+		},
+		{
+			"monthly rolls at month end", monthly,
+			date(2026, 1, 31, 10), date(2026, 2, 28, 10),
+			date(2026, 2, 28, 0), date(2026, 2, 28, 10), date(2026, 3, 31, 10),
+		},
+		{
+			"monthly before anchor time of day", monthly,
+			date(2026, 1, 31, 10), date(2026, 3, 31, 9),
+			date(2026, 3, 31, 0), date(2026, 2, 28, 10), date(2026, 3, 31, 10),
+		},
+		{
+			"day boundary in configured timezone", monthly,
+			date(2026, 1, 1, 0), time.Date(2026, 3, 14, 17, 0, 0, 0, time.UTC),
+			date(2026, 3, 15, 0), date(2026, 3, 1, 0), date(2026, 4, 1, 0),
+		},
+		{
+			"short plan rolls by plan days", weekly,
+			date(2026, 1, 1, 0), date(2026, 1, 16, 12),
+			date(2026, 1, 16, 0), date(2026, 1, 15, 0), date(2026, 1, 22, 0),
+		},
+		{
+			"short plan at period boundary", weekly,
+			date(2026, 1, 1, 0), date(2026, 1, 8, 0),
+			date(2026, 1, 8, 0), date(2026, 1, 8, 0), date(2026, 1, 15, 0),
+		},
+		{
+			"month-long day plan rolls monthly", longDays,
+			date(2026, 1, 31, 10), date(2026, 2, 15, 12),
+			date(2026, 2, 15, 0), date(2026, 1, 31, 10), date(2026, 2, 28, 10),
+		},
+		{
+			"anchor in the future", weekly,
+			date(2026, 2, 1, 0), date(2026, 1, 20, 12),
+			date(2026, 1, 20, 0), date(2026, 2, 1, 0), date(2026, 2, 8, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &model.UserModel{ApiLimit: tt.limit, CycleAnchor: &tt.anchor}
+			window := GetUsageWindow(user, tt.now)
+			if !window.DayStart.Equal(tt.dayStart) {
+				t.Errorf("DayStart = %v, want %v", window.DayStart, tt.dayStart)
+			}
+			if !window.CycleStart.Equal(tt.cycleFrom) || !window.CycleEnd.Equal(tt.cycleTo) {
+				t.Errorf("cycle = [%v, %v), want [%v, %v)",
+					window.CycleStart, window.CycleEnd, tt.cycleFrom, tt.cycleTo)
+			}
+		})
+	}
+}
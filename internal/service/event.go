@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+	"llm-member/internal/payment"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PaymentEventService struct {
+	db *gorm.DB
+
+	orderService *OrderService
+	setupService *SetupService
+}
+
+func NewPaymentEventService() *PaymentEventService {
+	return &PaymentEventService{
+		db: config.GetDB(), orderService: NewOrderService(),
+		setupService: NewSetupService(),
+	}
+}
+
+// Receive 验证并记录支付回调，同一事件只处理一次，处理失败的事件允许渠道重试
+func (s *PaymentEventService) Receive(name string, req *http.Request) (*model.PaymentEventModel, error) {
+	method := model.PaymentMethod(name)
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrWebhookBodyReadFailed, err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	record := &model.PaymentEventModel{
+		Method: method, EventID: digest(body), Payload: string(body),
+	}
+	event, err := payment.NewPayment(method).Webhook(req)
+	if err != nil {
+		consts.LogDetailedError(
+			consts.PaymentProvider(method),
+			consts.ErrorTypeConfig, err, "verify payment webhook",
+		)
+		record.Result, record.Error = model.EventRejected, err.Error()
+		s.save(record)
+		return record, consts.GetFriendlyError(err)
+	}
+
+	record.Verified = true
+	if event == nil { // 渠道未处理的事件类型
+		record.Result = model.EventIgnored
+		s.save(record)
+		return record, nil
+	}
+	if event.ID != "" {
+		record.EventID = event.ID
+	}
+	data, _ := json.Marshal(event)
+	record.Type, record.OrderID = event.Type, event.OrderID
+	record.Status, record.Event = event.Status, string(data)
+	record.Result = model.EventPending
+
+	created, err := s.save(record)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		var exist model.PaymentEventModel
+		err := s.db.Where("method = ? AND event_id = ?", method, record.EventID).
+			First(&exist).Error
+		if err != nil {
+			return nil, err
+		}
+		if exist.Result != model.EventFailed {
+			log.Printf("[webhook] 重复事件 %s/%s 已忽略", method, record.EventID)
+			return &exist, nil
+		}
+		record = &exist
+	}
+	return record, s.process(record, event)
+}
+
+// Ack 渠道约定的回调成功应答，未约定时返回 false
+func (s *PaymentEventService) Ack(name string) (string, bool) {
+	if ack, ok := payment.NewPayment(model.PaymentMethod(name)).(payment.IWebhookAck); ok {
+		return ack.WebhookAck(), true
+	}
+	return "", false
+}
+
+// Replay 管理员重放已记录的事件
+func (s *PaymentEventService) Replay(id uint64) (*model.PaymentEventModel, error) {
+	var record model.PaymentEventModel
+	if err := s.db.First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, consts.ErrPaymentEventNotFound
+		}
+		return nil, err
+	}
+	if !record.Verified || record.Event == "" {
+		return &record, consts.ErrPaymentEventNotReplayable
+	}
+	var event payment.Event
+	if err := json.Unmarshal([]byte(record.Event), &event); err != nil {
+		return &record, fmt.Errorf("%w: %v", consts.ErrWebhookEventParseFailed, err)
+	}
+	return &record, s.process(&record, &event)
+}
+
+// QueryEvents 分页查询支付事件
+func (s *PaymentEventService) QueryEvents(req *model.PaginateRequest) (*model.PaginateResponse, error) {
+	var total int64
+	var events []model.PaymentEventModel
+
+	query := s.db.Model(&model.PaymentEventModel{})
+	query.Where(req.Query).Order("id DESC")
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	offset := int((req.Page - 1) * req.Size)
+	if err := query.Offset(offset).Limit(int(req.Size)).
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	response := &model.PaginateResponse{
+		Data: events, Page: req.Page, Size: req.Size, Total: total,
+		Count: uint((total + int64(req.Size) - 1) / int64(req.Size)),
+	}
+	return response, nil
+}
+
+// process 处理事件并记录结果
+func (s *PaymentEventService) process(record *model.PaymentEventModel, event *payment.Event) error {
+	log.Printf(
+		"[webhook] 处理支付事件: Type=%s, OrderID=%s, Status=%s, Amount=%.2f",
+		event.Type, event.OrderID, event.Status, event.Amount,
+	)
+	result, err := s.dispatch(record.Method, event)
+	if err != nil {
+		result = model.EventFailed
+	}
+
+	now := time.Now()
+	record.Result, record.Error, record.ProcessedAt = result, "", &now
+	if err != nil {
+		record.Error = err.Error()
+	}
+	record.Attempts++
+	if dbErr := s.db.Model(record).Updates(map[string]any{
+		"result": record.Result, "error": record.Error,
+		"attempts": record.Attempts, "processed_at": now,
+	}).Error; dbErr != nil {
+		log.Printf("[webhook] 更新事件 %d 失败: %v", record.ID, dbErr)
+	}
+	return err
+}
+
+// dispatch 按事件状态推进订单：成功入账，失败或取消关闭订单，退款标记订单
+func (s *PaymentEventService) dispatch(method model.PaymentMethod, event *payment.Event) (model.EventResult, error) {
+	if event.Subscription != nil && strings.HasPrefix(event.Type, "subscription.") {
+		// 订阅续费、变更和终止事件没有新的待支付订单，直接同步订阅
+		return model.EventProcessed, NewSubscriptionService().Sync(method, event)
+	}
+	if event.RefundID != "" {
+		// 后台发起、渠道异步通知结果的退款，按退款单号确认
+		return NewRefundService().Confirm(method, event)
+	}
+	if event.OrderID == "" {
+		return "", consts.ErrPaymentWebhookMissingParams
+	}
+	order, err := s.orderService.FindOrder(event.OrderID)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
+	}
+	// 只处理本渠道创建的订单，防止一个渠道的回调变更其他渠道的订单
+	if order.Method != method {
+		log.Printf("[webhook] 订单 %s 的支付方式为 %s，忽略 %s 回调", order.OrderID, order.Method, method)
+		return model.EventIgnored, nil
+	}
+
+	change := model.OrderChange{
+		Source: model.OrderSourceWebhook, Actor: string(method), Remark: event.Type,
+	}
+	switch event.Status {
+	case payment.EventStatusSuccess:
+		// 已退款订单收到的交易完结通知无需再入账
+		if order.Status == model.PaymentPartialRefunded || order.Status == model.PaymentRefunded {
+			return model.EventIgnored, nil
+		}
+		// 回调金额与订单不一致时不入账，由管理员核实后处理
+		if event.Amount > 0 {
+			if err := payment.MatchAmount(order, event.Amount, event.Currency); err != nil {
+				return "", err
+			}
+		}
+		if event.Subscription != nil && event.Subscription.ID != "" {
+			// 订阅首次支付，关联第三方订阅
+			if err := NewSubscriptionService().Sync(method, event); err != nil {
+				log.Printf("[webhook] bind subscription %s failed: %v", event.Subscription.ID, err)
+			}
+		}
+		var limit *model.ApiLimit
+		if order.Kind != model.OrderTopup { // 充值订单无需套餐限制
+			if limit, err = s.setupService.GetPlanLimit(order.PayPlan); err != nil {
+				return "", err
+			}
+		}
+		return model.EventProcessed, s.orderService.PaySuccess(order.OrderID, limit, change)
+	case payment.EventStatusFailed, payment.EventStatusCancelled:
+		if order.Status != model.PaymentPending {
+			return model.EventIgnored, nil
+		}
+		return model.EventProcessed, s.orderService.UpdateStatus(order.OrderID, model.PaymentCanceled, change)
+	case payment.EventStatusRefunded:
+		// 后台发起的退款已在退款流程中处理并回滚权益
+		refundService := NewRefundService()
+		if !order.Status.CanTransit(model.PaymentRefunded) || refundService.HasRefund(order.OrderID) {
+			return model.EventIgnored, nil
+		}
+		// 渠道侧发起的退款同样登记退款记录并回滚套餐或余额
+		_, err := refundService.Record(order, event.Amount, "渠道退款: "+event.Type, change)
+		return model.EventProcessed, err
+	default:
+		return model.EventIgnored, nil
+	}
+}
+
+// save 写入事件记录，返回是否为新事件
+func (s *PaymentEventService) save(record *model.PaymentEventModel) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		log.Printf("[webhook] 保存事件 %s/%s 失败: %v", record.Method, record.EventID, result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// digest 渠道未提供事件ID时以请求体摘要去重
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/model"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	jobLeaderKey   = "llm:job:leader"
+	jobLeaderTTL   = 30 * time.Second
+	jobRunKeepDays = 7
+)
+
+// renewLeader 仅在当前实例持有时续期，避免覆盖其他实例的租约
+var renewLeader = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// JobFunc 定时任务，返回处理成功和失败的数量
+type JobFunc func() (processed, failed int, err error)
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      JobFunc
+}
+
+// scheduler 进程内共享的任务注册表和选主状态
+var scheduler struct {
+	once     sync.Once
+	mu       sync.Mutex
+	jobs     []*job
+	instance string
+	leader   atomic.Bool
+}
+
+type JobService struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewJobService() *JobService {
+	return &JobService{db: config.GetDB(), redis: config.GetRedis()}
+}
+
+// Register 注册并启动定时任务，interval 为 0 时不启动
+// 配置 Redis 时多实例通过租约选主，只有主实例执行任务
+func (s *JobService) Register(name string, interval time.Duration, run JobFunc) {
+	if interval <= 0 {
+		return
+	}
+	scheduler.once.Do(s.campaign)
+
+	j := &job{name: name, interval: interval, run: run}
+	scheduler.mu.Lock()
+	scheduler.jobs = append(scheduler.jobs, j)
+	scheduler.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if scheduler.leader.Load() {
+				s.execute(j)
+			}
+		}
+	}()
+}
+
+// Run 立即执行一次已注册的任务，仅主实例执行，返回是否已执行
+func (s *JobService) Run(name string) bool {
+	if !scheduler.leader.Load() {
+		return false
+	}
+	scheduler.mu.Lock()
+	var target *job
+	for _, j := range scheduler.jobs {
+		if j.name == name {
+			target = j
+		}
+	}
+	scheduler.mu.Unlock()
+	if target == nil {
+		return false
+	}
+	s.execute(target)
+	return true
+}
+
+// GetStatus 获取已注册任务及其最近一次运行
+func (s *JobService) GetStatus() (*model.JobStatusResponse, error) {
+	scheduler.mu.Lock()
+	jobs := append([]*job(nil), scheduler.jobs...)
+	scheduler.mu.Unlock()
+
+	response := &model.JobStatusResponse{
+		Instance: scheduler.instance, Leader: scheduler.leader.Load(),
+		Jobs: make([]model.JobInfo, 0, len(jobs)),
+	}
+	for _, j := range jobs {
+		info := model.JobInfo{Name: j.name, Interval: j.interval.String()}
+		var run model.JobRunModel
+		err := s.db.Where("name = ?", j.name).Order("id DESC").Limit(1).Find(&run).Error
+		if err != nil {
+			return nil, err
+		}
+		if run.ID != 0 {
+			info.LastRun = &run
+		}
+		response.Jobs = append(response.Jobs, info)
+	}
+	return response, nil
+}
+
+// QueryRuns 分页查询任务运行记录
+func (s *JobService) QueryRuns(req *model.PaginateRequest) (*model.PaginateResponse, error) {
+	var total int64
+	var runs []model.JobRunModel
+
+	query := s.db.Model(&model.JobRunModel{})
+	query.Where(req.Query).Order("id DESC")
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	offset := int((req.Page - 1) * req.Size)
+	if err := query.Offset(offset).Limit(int(req.Size)).
+		Find(&runs).Error; err != nil {
+		return nil, err
+	}
+
+	response := &model.PaginateResponse{
+		Data: runs, Page: req.Page, Size: req.Size, Total: total,
+		Count: uint((total + int64(req.Size) - 1) / int64(req.Size)),
+	}
+	return response, nil
+}
+
+// execute 执行一次任务并记录运行结果
+func (s *JobService) execute(j *job) {
+	run := &model.JobRunModel{
+		Name: j.name, Instance: scheduler.instance,
+		Status: model.JobRunning, StartedAt: time.Now(),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		log.Printf("[JOB] record %s run failed: %v", j.name, err)
+	}
+
+	processed, failed, err := s.call(j)
+	now := time.Now()
+	run.Status, run.Processed, run.Failed = model.JobSucceed, processed, failed
+	run.FinishedAt, run.Duration = &now, now.Sub(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Status, run.Message = model.JobFailed, err.Error()
+		log.Printf("[JOB] %s failed: %v", j.name, err)
+	} else if processed > 0 || failed > 0 {
+		log.Printf("[JOB] %s processed %d, failed %d", j.name, processed, failed)
+	}
+
+	if run.ID == 0 {
+		return
+	}
+	if err := s.db.Model(run).Updates(map[string]any{
+		"status": run.Status, "processed": run.Processed, "failed": run.Failed,
+		"message": run.Message, "finished_at": now, "duration": run.Duration,
+	}).Error; err != nil {
+		log.Printf("[JOB] update %s run failed: %v", j.name, err)
+	}
+}
+
+// call 执行任务，任务 panic 时记为失败，不影响后续调度
+func (s *JobService) call(j *job) (processed, failed int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run()
+}
+
+// campaign 启动选主和运行记录清理，未配置 Redis 时当前实例即为主实例
+func (s *JobService) campaign() {
+	host, _ := os.Hostname()
+	scheduler.instance = fmt.Sprintf("%s-%d", host, os.Getpid())
+
+	if s.redis == nil {
+		scheduler.leader.Store(true)
+	} else {
+		s.elect()
+		go func() {
+			ticker := time.NewTicker(jobLeaderTTL / 3)
+			defer ticker.Stop()
+			for range ticker.C {
+				s.elect()
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if scheduler.leader.Load() {
+				s.prune()
+			}
+		}
+	}()
+}
+
+// elect 抢占或续期主实例租约，Redis 不可用时放弃执行
+func (s *JobService) elect() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	leader, err := s.redis.SetNX(ctx, jobLeaderKey, scheduler.instance, jobLeaderTTL).Result()
+	if err == nil && !leader {
+		var renewed int64
+		renewed, err = renewLeader.Run(
+			ctx, s.redis, []string{jobLeaderKey},
+			scheduler.instance, jobLeaderTTL.Milliseconds(),
+		).Int64()
+		leader = renewed == 1
+	}
+	if err != nil {
+		log.Printf("[JOB] elect leader failed: %v", err)
+		leader = false
+	}
+	if scheduler.leader.Swap(leader) != leader {
+		log.Printf("[JOB] instance %s leader: %v", scheduler.instance, leader)
+	}
+}
+
+// prune 清理过期的运行记录
+func (s *JobService) prune() {
+	before := time.Now().AddDate(0, 0, -jobRunKeepDays)
+	if err := s.db.Unscoped().Where("started_at < ?", before).
+		Delete(&model.JobRunModel{}).Error; err != nil {
+		log.Printf("[JOB] prune runs failed: %v", err)
+	}
+}
@@ -91,6 +91,29 @@ func (s *MailService) SendResetCodeEmail(token *model.VerifyModel) error {
 	return s.Send([]string{token.Email}, subject, body.String())
 }
 
+// SendRefundEmail 发送订单退款通知邮件
+func (s *MailService) SendRefundEmail(user *model.UserModel, order *model.OrderModel, refund *model.RefundModel) error {
+	subject := "您的订单已退款"
+
+	// 使用模板渲染邮件内容
+	templateData := map[string]any{
+		"name":     s.cfg.AppName,
+		"username": user.Username,
+		"order_id": order.OrderID,
+		"amount":   fmt.Sprintf("%.2f", refund.Amount),
+		"currency": refund.Currency,
+		"reason":   refund.Reason,
+		"reversal": refund.Reversal,
+	}
+
+	body, err := s.GetTemplate("mail.refund", templateData)
+	if err != nil {
+		return fmt.Errorf("%w: %w", consts.ErrEmailTemplateLoadFailed, err)
+	}
+
+	return s.Send([]string{user.Email}, subject, body.String())
+}
+
 // 参考net/smtp的func SendMail()
 // 使用net.Dial连接tls（SSL）端口时，smtp.NewClient()会卡住且不提示err
 // len(to)>1时，to[1]开始提示是密送
@@ -5,7 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
-	"net/http"
+	"strings"
 	"time"
 
 	"llm-member/internal/config"
@@ -21,24 +21,6 @@ type OrderService struct {
 	db *gorm.DB
 }
 
-// getProviderFromMethod 根据支付方式获取提供商类型
-func (s *OrderService) getProviderFromMethod(method model.PaymentMethod) consts.PaymentProvider {
-	switch method {
-	case "stripe":
-		return consts.ProviderStripe
-	case "alipay":
-		return consts.ProviderAlipay
-	case "wechat":
-		return consts.ProviderWechat
-	case "paypal":
-		return consts.ProviderPaypal
-	case "creem":
-		return consts.ProviderCreem
-	default:
-		return consts.PaymentProvider(string(method))
-	}
-}
-
 // NewOrderService 创建支付服务实例
 func NewOrderService() *OrderService {
 	return &OrderService{
@@ -48,39 +30,102 @@ func NewOrderService() *OrderService {
 
 func (s *OrderService) CreateOrder(req *model.OrderRequest, plan *model.PlanInfo) (*model.OrderModel, error) {
 	// 检查支付方式是否可用
-	if !config.HasPayment(string(req.Method)) {
+	info, ok := payment.Lookup(req.Method)
+	if !ok || !info.Enabled() {
 		return nil, fmt.Errorf("%w %s", consts.ErrPaymentMethodNotEnabled, req.Method)
 	}
+	if !info.Subscription && req.Kind == model.OrderSubscribe {
+		return nil, fmt.Errorf("%w: %s", consts.ErrSubscriptionNotSupported, req.Method)
+	}
+	provider := info.New()
+	// 充值和自动续费按渠道金额收取，不支持优惠码
+	if req.CouponCode != "" && (req.Kind == model.OrderTopup || req.Kind == model.OrderSubscribe) {
+		return nil, consts.ErrCouponNotApplicable
+	}
+	change := model.OrderChange{
+		Source: model.OrderSourceUser, Actor: fmt.Sprintf("user:%d", *req.UserId),
+	}
 	// 生成订单ID, 创建订单记录
 	order := &model.OrderModel{
-		UserID:  *req.UserId,
-		PayPlan: req.PayPlan, Amount: *req.Amount,
-		Method: req.Method, Status: model.PaymentPending,
+		UserID: *req.UserId, Kind: req.Kind,
+		PayPlan: req.PayPlan, Amount: *req.Amount, Credit: req.Credit,
+		Method: req.Method, Scene: req.Scene, Status: model.PaymentPending,
 		ExpiredAt: time.Now().Add(30 * time.Minute), // 30分钟过期
 	}
+	// 订单金额和币种为收款依据，各渠道均按此收费
+	if order.Currency = plan.Currency; order.Currency == "" {
+		order.Currency = config.GetCurrency()
+	}
+	// 自动续费按套餐周期扣款，渠道据此设置续费间隔
+	if req.Kind == model.OrderSubscribe {
+		period, err := NewSetupService().ParsePlanLimit(plan)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", consts.ErrParsePlanLimitFailed, err)
+		}
+		order.Period = period
+	}
 	if orderID, err := s.generateOrderID(); err != nil {
 		return nil, fmt.Errorf("%w: %v", consts.ErrOrderIDGenerationFailed, err)
 	} else {
 		order.OrderID = orderID
 	}
 
-	// 保存订单到数据库
-	if err := s.db.Create(order).Error; err != nil {
-		return nil, fmt.Errorf("%w: %v", consts.ErrOrderSaveFailed, err)
+	// 保存订单到数据库，使用优惠码时在同一事务中计入兑换次数
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if req.CouponCode != "" {
+			if err := NewCouponService().Redeem(tx, order, req.CouponCode); err != nil {
+				return err
+			}
+		}
+		// 按套餐原价收费时使用渠道中配置的产品，升级补差价、优惠等按金额收费
+		if product, ok := plan.Products[req.Method]; ok {
+			if req.Kind == model.OrderSubscribe {
+				order.Product = product.SubscriptionID
+			} else if order.Amount == plan.Price {
+				order.Product = product.ProductID
+			}
+		}
+		if err := tx.Create(order).Error; err != nil {
+			return fmt.Errorf("%w: %v", consts.ErrOrderSaveFailed, err)
+		}
+		return s.record(tx, order.OrderID, "", model.PaymentPending, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 全额抵扣的订单无需支付，直接完成
+	if order.Amount <= 0 && order.Coupon != "" {
+		limit, err := NewSetupService().GetPlanLimit(order.PayPlan)
+		if err != nil {
+			return nil, err
+		}
+		change.Remark = "优惠码全额抵扣"
+		if err := s.PaySuccess(order.OrderID, limit, change); err != nil {
+			return nil, err
+		}
+		return s.FindOrder(order.OrderID)
 	}
 	// 支付订单
-	providerType := s.getProviderFromMethod(req.Method)
-	provider := payment.NewPayment(req.Method)
+	providerType := consts.PaymentProvider(req.Method)
 	if err := provider.Create(order); err != nil {
 		consts.LogDetailedError(providerType, consts.ErrorTypeCreation, err, "create payment order")
+		// 渠道下单失败时取消订单，归还优惠码
+		change.Remark = "渠道下单失败"
+		s.UpdateStatus(order.OrderID, model.PaymentCanceled, change)
 		return nil, consts.GetFriendlyError(err)
 	}
-	if err := s.db.Save(order).Error; err != nil {
+	// 状态只能由状态机变更，避免覆盖下单期间已到达的回调
+	if err := s.db.Omit("status", "succeed_at").Save(order).Error; err != nil {
 		return nil, fmt.Errorf("%w: %v", consts.ErrOrderSaveFailed, err)
 	}
 	return order, nil
 }
 
+// GetPaymentMethods 获取已完成配置的支付方式
+func (s *OrderService) GetPaymentMethods() []*payment.Provider {
+	return payment.EnabledProviders()
+}
+
 // FindOrder 获取支付订单
 func (s *OrderService) FindOrder(orderID string) (*model.OrderModel, error) {
 	var order model.OrderModel
@@ -90,43 +135,49 @@ func (s *OrderService) FindOrder(orderID string) (*model.OrderModel, error) {
 	return &order, nil
 }
 
-// VerifyCallback 验证支付回调
-func (s *OrderService) VerifyCallback(name string, req *http.Request) (*model.OrderModel, error) {
-	method := model.PaymentMethod(name)
-	providerType := s.getProviderFromMethod(method)
-	provider := payment.NewPayment(method)
+// FindByThridID 按渠道订单号获取支付订单
+func (s *OrderService) FindByThridID(method model.PaymentMethod, thridID string) (*model.OrderModel, error) {
+	var order model.OrderModel
+	err := s.db.Where("method = ? AND thrid_id = ?", method, thridID).First(&order).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
 
-	var orderId string
-	// 使用支付提供商的Webhook方法验证回调
-	if event, err := provider.Webhook(req); err != nil {
-		consts.LogDetailedError(
-			providerType, consts.ErrorTypeConfig, err,
-			"verify payment webhook",
-		)
-		return nil, consts.GetFriendlyError(err)
-	} else if event == nil || event.OrderID == "" {
-		return nil, consts.ErrPaymentWebhookMissingParams
-	} else {
-		orderId = event.OrderID
-		log.Printf(
-			"[webhook] 收到支付事件: Type=%s, OrderID=%s, Status=%s, Amount=%.2f",
-			event.Type, event.OrderID, event.Status, event.Amount,
-		)
+// PaymentForm 生成跳转渠道的支付表单，仅未过期的待支付订单可用
+func (s *OrderService) PaymentForm(orderID string) (string, map[string]string, error) {
+	order, err := s.FindOrder(orderID)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
+	}
+	if order.Status != model.PaymentPending || time.Now().After(order.ExpiredAt) {
+		return "", nil, consts.ErrOrderNotPayable
 	}
 
-	if order, err := s.FindOrder(orderId); err != nil {
-		return nil, fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
-	} else {
-		return order, nil
+	provider, ok := payment.NewPayment(order.Method).(payment.IPaymentForm)
+	if !ok {
+		return "", nil, consts.ErrPaymentMethodNotSupported
+	}
+	action, fields, err := provider.Form(order)
+	if err != nil {
+		consts.LogDetailedError(
+			consts.PaymentProvider(order.Method),
+			consts.ErrorTypeCreation, err, "build payment form",
+		)
+		return "", nil, consts.GetFriendlyError(err)
 	}
+	return action, fields, nil
 }
 
-func (s *OrderService) QueryPayment(order *model.OrderModel) error {
+// QueryPayment 主动查询待支付订单在渠道的状态，并按状态机更新订单
+func (s *OrderService) QueryPayment(order *model.OrderModel, change model.OrderChange) error {
 	if order.Status != model.PaymentPending {
 		return nil
 	}
 
-	providerType := s.getProviderFromMethod(order.Method)
+	from := order.Status
+	providerType := consts.PaymentProvider(order.Method)
 	provider := payment.NewPayment(order.Method)
 	if err := provider.Query(order); err != nil {
 		consts.LogDetailedError(
@@ -135,27 +186,89 @@ func (s *OrderService) QueryPayment(order *model.OrderModel) error {
 		)
 		return consts.GetFriendlyError(err)
 	}
-	return nil
+
+	switch {
+	case !from.CanTransit(order.Status):
+		if order.Status != from {
+			log.Printf("[order][%s] ignore queried status %s", order.OrderID, order.Status)
+			order.Status = from
+		}
+		return nil
+	case order.Status == model.PaymentSucceed:
+		var limit *model.ApiLimit
+		if order.Kind != model.OrderTopup {
+			limit, _ = NewSetupService().GetPlanLimit(order.PayPlan)
+		}
+		return s.PaySuccess(order.OrderID, limit, change)
+	default:
+		return s.UpdateStatus(order.OrderID, order.Status, change)
+	}
 }
 
-// UpdatePaymentStatus 更新支付状态
-func (s *OrderService) UpdateStatus(orderID string, status string) error {
-	updates := map[string]any{
-		"status": status,
+// UpdateStatus 按状态机更新订单状态，支付成功请使用 PaySuccess
+func (s *OrderService) UpdateStatus(orderID string, to model.OrderStatus, change model.OrderChange) error {
+	order, err := s.FindOrder(orderID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
 	}
+	if order.Status == to {
+		return nil
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return s.transit(tx, order, to, change)
+	})
+	if err == nil && (to == model.PaymentCanceled || to == model.PaymentExpired) {
+		err = NewCouponService().Release(orderID)
+	}
+	return err
+}
 
-	if status == string(model.PaymentSucceed) {
+// GetHistory 获取订单的状态变更记录
+func (s *OrderService) GetHistory(orderID string) ([]model.OrderHistoryModel, error) {
+	var history []model.OrderHistoryModel
+	err := s.db.Where("order_id = ?", orderID).Order("id").Find(&history).Error
+	return history, err
+}
+
+// transit 在事务中校验并变更订单状态，同时写入变更记录
+func (s *OrderService) transit(tx *gorm.DB, order *model.OrderModel, to model.OrderStatus, change model.OrderChange) error {
+	from := order.Status
+	if !from.CanTransit(to) {
+		return fmt.Errorf("%w: %s -> %s", consts.ErrInvalidOrderTransition, from, to)
+	}
+
+	updates := map[string]any{"status": to}
+	if to == model.PaymentSucceed {
 		now := time.Now()
-		updates["succeed_at"] = &now
+		updates["succeed_at"], order.SucceedAt = now, &now
+	}
+	// 以当前状态为条件更新，并发变更时只有一个能成功
+	result := tx.Model(&model.OrderModel{}).
+		Where("id = ? AND status = ?", order.ID, from).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("%w: %v", consts.ErrOrderStatusUpdateFailed, result.Error)
 	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", consts.ErrOrderStatusConflict, order.OrderID)
+	}
+	order.Status = to
+	return s.record(tx, order.OrderID, from, to, change)
+}
 
-	return s.db.Model(&model.OrderModel{}).
-		Where("order_id = ?", orderID).
-		Updates(updates).Error
+// record 写入订单状态变更记录
+func (s *OrderService) record(tx *gorm.DB, orderID string, from, to model.OrderStatus, change model.OrderChange) error {
+	history := model.OrderHistoryModel{
+		OrderID: orderID, From: from, To: to,
+		Source: change.Source, Actor: change.Actor, Remark: change.Remark,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrOrderStatusUpdateFailed, err)
+	}
+	return nil
 }
 
-// ProcessPaymentSuccess 处理支付成功
-func (s *OrderService) PaySuccess(orderId string, limit *model.ApiLimit) error {
+// PaySuccess 处理支付成功
+func (s *OrderService) PaySuccess(orderId string, limit *model.ApiLimit, change model.OrderChange) error {
 	order, err := s.FindOrder(orderId)
 	if err != nil {
 		return fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
@@ -163,6 +276,12 @@ func (s *OrderService) PaySuccess(orderId string, limit *model.ApiLimit) error {
 	if order.Status == model.PaymentSucceed {
 		return nil // 已经处理过了
 	}
+	late := order.Status == model.PaymentCanceled || order.Status == model.PaymentExpired
+	if late {
+		// 关单后渠道才确认支付，用户已付款，照常发放权益并记录以便核查
+		log.Printf("[order][%s] late payment confirmed for %s order", order.OrderID, order.Status)
+		change.Remark = strings.TrimSpace(change.Remark + " 关单后确认支付")
+	}
 
 	// 开始事务
 	tx := s.db.Begin()
@@ -173,27 +292,42 @@ func (s *OrderService) PaySuccess(orderId string, limit *model.ApiLimit) error {
 	}()
 
 	// 更新订单状态
-	var updateOrder = map[string]any{
-		"status": model.PaymentSucceed, "succeed_at": time.Now(),
-	}
-	if err := tx.Model(order).Updates(updateOrder).Error; err != nil {
+	if err := s.transit(tx, order, model.PaymentSucceed, change); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("%w: %v", consts.ErrOrderStatusUpdateFailed, err)
+		return err
+	}
+	// 关单时已归还优惠码，按优惠价入账前重新计入兑换次数
+	if late && order.Coupon != "" {
+		if err := NewCouponService().Restore(tx, order); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%w: %v", consts.ErrOrderSaveFailed, err)
+		}
+	}
+
+	// 充值订单：余额入账
+	if order.Kind == model.OrderTopup {
+		_, err := NewWalletService().CreditTx(
+			tx, order.UserID, order.Amount,
+			model.LedgerTopup, order.OrderID, "钱包充值",
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit().Error
 	}
 
 	// 更新用户套餐
-	var updateUser = map[string]any{
-		"user_plan": order.PayPlan, "api_limit": limit,
-		"expire_at": time.Now().AddDate(0, 0, limit.ExpireDays),
+	if limit == nil {
+		tx.Rollback()
+		return fmt.Errorf("%w: %s", consts.ErrPlanNotFound, order.PayPlan)
 	}
-	var query = tx.Model(&model.UserModel{}).Where("id = ?", order.UserID)
-	if err := query.Updates(updateUser).Error; err != nil {
+	if err := NewPlanService().ApplyOrder(tx, order, limit); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("%w: %v", consts.ErrUserPlanUpdateFailed, err)
+		return err
 	}
 
-	tx.Commit()
-	return nil
+	return tx.Commit().Error
 }
 
 // GetAllOrders 获取用户订单列表
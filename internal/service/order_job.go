@@ -0,0 +1,94 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+	"llm-member/internal/payment"
+)
+
+const (
+	orderJobBatch  = 100              // 每次运行处理的订单数
+	orderJobSettle = time.Minute      // 新订单留给回调的时间，期间不主动查询
+	orderCloseWait = 30 * time.Minute // 渠道关单持续失败时，超过此时间后仍本地关闭
+)
+
+// StartJobs 启动超时关单和支付对账任务
+func (s *OrderService) StartJobs(expireInterval, reconcileInterval time.Duration) {
+	jobs := NewJobService()
+	jobs.Register("order-expire", expireInterval, s.CloseExpired)
+	jobs.Register("order-reconcile", reconcileInterval, s.Reconcile)
+}
+
+// CloseExpired 关闭超时未支付的订单，返回关闭和处理失败的数量
+func (s *OrderService) CloseExpired() (int, int, error) {
+	var orders []model.OrderModel
+	err := s.db.Where("status = ? AND expired_at < ?", model.PaymentPending, time.Now()).
+		Order("id").Limit(orderJobBatch).Find(&orders).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var processed, failed int
+	for i := range orders {
+		if err := s.closeExpired(&orders[i]); err != nil {
+			log.Printf("[order][%s] close expired failed: %v", orders[i].OrderID, err)
+			failed++
+		} else {
+			processed++
+		}
+	}
+	return processed, failed, nil
+}
+
+// closeExpired 先查询渠道确认未支付，再关闭渠道订单并标记为过期
+func (s *OrderService) closeExpired(order *model.OrderModel) error {
+	change := model.OrderChange{Source: model.OrderSourceJob, Actor: "order-expire"}
+	// 临近过期时支付但回调丢失的订单，查询后直接入账
+	if err := s.QueryPayment(order, change); err != nil {
+		log.Printf("[order][%s] query before close failed: %v", order.OrderID, err)
+	}
+	if order.Status != model.PaymentPending {
+		return nil
+	}
+
+	if err := payment.NewPayment(order.Method).Close(order); err != nil {
+		consts.LogDetailedError(
+			consts.PaymentProvider(order.Method),
+			consts.ErrorTypeCancel, err, "close expired order",
+		)
+		// 渠道订单可能未创建或已失效，等待一段时间后不再依赖渠道关单
+		if time.Since(order.ExpiredAt) < orderCloseWait {
+			return err
+		}
+	}
+	change.Remark = "订单超时未支付"
+	return s.UpdateStatus(order.OrderID, model.PaymentExpired, change)
+}
+
+// Reconcile 主动查询未过期的待支付订单，补偿丢失的支付回调，返回状态已更新和查询失败的数量
+func (s *OrderService) Reconcile() (int, int, error) {
+	now := time.Now()
+	var orders []model.OrderModel
+	err := s.db.Where(
+		"status = ? AND expired_at >= ? AND created_at < ?",
+		model.PaymentPending, now, now.Add(-orderJobSettle),
+	).Order("id").Limit(orderJobBatch).Find(&orders).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	change := model.OrderChange{Source: model.OrderSourceJob, Actor: "order-reconcile"}
+	var processed, failed int
+	for i := range orders {
+		if err := s.QueryPayment(&orders[i], change); err != nil {
+			log.Printf("[order][%s] reconcile failed: %v", orders[i].OrderID, err)
+			failed++
+		} else if orders[i].Status != model.PaymentPending {
+			processed++
+		}
+	}
+	return processed, failed, nil
+}
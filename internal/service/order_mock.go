@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+	"llm-member/internal/payment"
+)
+
+// SetMockOutcome 设置模拟支付订单的结果，超时结果立即到期，由超时关单任务关闭
+func (s *OrderService) SetMockOutcome(orderID string, outcome model.MockOutcome) (*model.OrderModel, error) {
+	order, err := s.findMockOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != model.PaymentPending {
+		return nil, fmt.Errorf("%w: %s", consts.ErrOrderNotPayable, order.Status)
+	}
+
+	updates := map[string]any{"pay_url": payment.MockURL(outcome)}
+	if outcome == model.MockExpiry {
+		updates["expired_at"] = time.Now()
+	}
+	if err := s.db.Model(order).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrOrderSaveFailed, err)
+	}
+	return order, nil
+}
+
+// SendMockWebhook 为模拟支付订单发送签名回调，经回调接口完成验签、记录和入账
+func (s *OrderService) SendMockWebhook(orderID string, req *model.MockWebhookRequest) (*payment.Event, error) {
+	order, err := s.findMockOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := order.Amount
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	event, err := payment.NewMockPayment().Notify(order, req.Status, amount)
+	if err != nil {
+		consts.LogDetailedError(
+			consts.PaymentProvider(order.Method),
+			consts.ErrorTypeWebhook, err, "send mock webhook",
+		)
+		return event, err
+	}
+	return event, nil
+}
+
+// findMockOrder 获取使用模拟支付的订单
+func (s *OrderService) findMockOrder(orderID string) (*model.OrderModel, error) {
+	order, err := s.FindOrder(orderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
+	}
+	if order.Method != model.PaymentMock {
+		return nil, fmt.Errorf("%w: %s", consts.ErrPaymentMethodNotSupported, order.Method)
+	}
+	return order, nil
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type PlanService struct {
+	db *gorm.DB
+
+	setupService *SetupService
+}
+
+func NewPlanService() *PlanService {
+	return &PlanService{
+		db: config.GetDB(), setupService: NewSetupService(),
+	}
+}
+
+// IsExpired 套餐是否已过期（超过宽限期），默认套餐不会过期
+func (s *PlanService) IsExpired(user *model.UserModel) bool {
+	if user.ExpireAt == nil {
+		return false
+	}
+	if user.UserPlan == model.PayPlan(config.GetDefaultPlan()) {
+		return false
+	}
+	return time.Now().After(user.ExpireAt.Add(config.GetExpireGrace()))
+}
+
+// Downgrade 将用户回退到默认套餐并记录变更，成功后同步更新 user
+// 如果有已到期的预约降级，则切换到预约的套餐
+func (s *PlanService) Downgrade(user *model.UserModel, reason string) error {
+	if applied, err := s.applyScheduled(user); applied || err != nil {
+		return err
+	}
+
+	plan := model.PayPlan(config.GetDefaultPlan())
+	limit, err := s.setupService.GetPlanLimit(plan)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	change := &model.PlanChangeModel{
+		UserID: user.ID, Reason: reason,
+		FromPlan: user.UserPlan, FromLimit: user.ApiLimit,
+		FromExpire: user.ExpireAt, ToPlan: plan, ToLimit: limit,
+	}
+	changed := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 以原过期时间为条件，避免覆盖并发续费的结果
+		query := tx.Model(&model.UserModel{}).Where(
+			"id = ? AND user_plan = ? AND expire_at = ?",
+			user.ID, user.UserPlan, user.ExpireAt,
+		)
+		result := query.Updates(map[string]any{
+			"user_plan": plan, "api_limit": limit, "expire_at": nil,
+			"cycle_anchor": now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		changed = true
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrUserPlanUpdateFailed, err)
+	}
+	if !changed { // 已被续费或降级，重新加载最新套餐
+		return s.db.First(user, user.ID).Error
+	}
+
+	user.UserPlan, user.ApiLimit, user.ExpireAt = plan, limit, nil
+	user.CycleAnchor = &now
+	return nil
+}
+
+// Quote 计算购买目标套餐的报价
+// 升级立即生效，按当前套餐剩余时间折算抵扣；降级在当前周期结束后生效；续费顺延有效期
+func (s *PlanService) Quote(user *model.UserModel, name model.PayPlan) (*model.PlanQuote, error) {
+	target, err := s.setupService.GetPlanInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := s.setupService.GetPlanLimit(name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	quote := &model.PlanQuote{
+		Action: model.PlanActionNew, FromPlan: user.UserPlan, ToPlan: name,
+		Price: target.Price, Amount: target.Price, EffectiveAt: now,
+		ExpireAt: periodEnd(limit, now),
+	}
+	// 默认套餐或已过期的套餐没有剩余价值，按新购处理
+	if user.ExpireAt == nil || !user.ExpireAt.After(now) ||
+		user.UserPlan == model.PayPlan(config.GetDefaultPlan()) {
+		return quote, nil
+	}
+	if user.UserPlan == name {
+		quote.Action = model.PlanActionRenew
+		quote.ExpireAt = periodEnd(limit, *user.ExpireAt)
+		return quote, nil
+	}
+	current, err := s.setupService.GetPlanInfo(user.UserPlan)
+	if err != nil { // 原套餐已删除
+		return quote, nil
+	}
+
+	if target.Price > current.Price {
+		quote.Action = model.PlanActionUpgrade
+		quote.Credit = s.remainingValue(user, current, now)
+		quote.Amount = roundAmount(target.Price - quote.Credit)
+		return quote, nil
+	}
+	quote.Action = model.PlanActionDowngrade
+	quote.EffectiveAt = *user.ExpireAt
+	quote.ExpireAt = periodEnd(limit, *user.ExpireAt)
+	return quote, nil
+}
+
+// remainingValue 当前套餐剩余价值，按剩余时间占一个周期的比例折算，最多抵扣一个周期
+func (s *PlanService) remainingValue(user *model.UserModel, current *model.PlanInfo, now time.Time) float64 {
+	limit := user.ApiLimit
+	if limit == nil || (limit.ExpireDays <= 0 && limit.ExpireMonths <= 0) {
+		var err error
+		if limit, err = s.setupService.ParsePlanLimit(current); err != nil {
+			return 0
+		}
+	}
+	period := user.ExpireAt.Sub(periodStart(limit, *user.ExpireAt))
+	if period <= 0 {
+		return 0
+	}
+	ratio := float64(user.ExpireAt.Sub(now)) / float64(period)
+	return roundAmount(current.Price * math.Max(math.Min(ratio, 1), 0))
+}
+
+// ApplyOrder 在支付成功的事务中变更用户套餐
+// 降级只登记预约变更，其余订单立即生效并取消尚未生效的预约降级
+func (s *PlanService) ApplyOrder(tx *gorm.DB, order *model.OrderModel, limit *model.ApiLimit) error {
+	var user model.UserModel
+	if err := tx.First(&user, order.UserID).Error; err != nil {
+		return consts.ErrUserNotFound
+	}
+	err := tx.Model(&model.PlanChangeModel{}).
+		Where("user_id = ? AND status = ?", user.ID, model.PlanChangePending).
+		Update("status", model.PlanChangeCanceled).Error
+	if err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrUserPlanUpdateFailed, err)
+	}
+
+	now := time.Now()
+	change := &model.PlanChangeModel{
+		UserID: user.ID, OrderID: order.OrderID,
+		FromPlan: user.UserPlan, FromLimit: user.ApiLimit, FromExpire: user.ExpireAt,
+		ToPlan: order.PayPlan, ToLimit: limit,
+	}
+
+	expire := periodEnd(limit, now)
+	switch {
+	case order.Kind == model.OrderDowngrade:
+		effective := now
+		if user.ExpireAt != nil && user.ExpireAt.After(now) {
+			effective = *user.ExpireAt
+		}
+		expire = periodEnd(limit, effective)
+		change.Reason, change.Status = "downgrade", model.PlanChangePending
+		change.EffectiveAt, change.ToExpire = &effective, &expire
+		if effective.After(now) {
+			return tx.Create(change).Error
+		}
+		change.Status = model.PlanChangeApplied
+	case order.Kind == model.OrderUpgrade:
+		change.Reason = "upgrade"
+	case user.UserPlan == order.PayPlan && user.ExpireAt != nil && user.ExpireAt.After(now):
+		change.Reason = "renew"
+		expire = periodEnd(limit, *user.ExpireAt)
+	default:
+		change.Reason = "purchase"
+	}
+	change.ToExpire = &expire
+
+	var updateUser = map[string]any{
+		"user_plan": order.PayPlan, "api_limit": limit, "expire_at": expire,
+	}
+	if change.Reason != "renew" { // 续费沿用原计费周期
+		updateUser["cycle_anchor"] = now
+	}
+	if err := tx.Model(&user).Updates(updateUser).Error; err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrUserPlanUpdateFailed, err)
+	}
+	return tx.Create(change).Error
+}
+
+// RevertOrder 在退款事务中撤销订单带来的套餐变更，返回处理说明
+// 仅当用户套餐仍是该订单的结果时恢复到下单前的状态，之后已有其他变更则不回滚
+func (s *PlanService) RevertOrder(tx *gorm.DB, order *model.OrderModel) (string, error) {
+	var change model.PlanChangeModel
+	err := tx.Where("order_id = ? AND reason <> ?", order.OrderID, "refund").
+		Order("id DESC").First(&change).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "订单未变更套餐", nil
+	} else if err != nil {
+		return "", err
+	}
+	switch change.Status {
+	case model.PlanChangePending: // 预约降级尚未生效，直接取消
+		err := tx.Model(&change).Update("status", model.PlanChangeCanceled).Error
+		return "已取消预约降级", err
+	case model.PlanChangeCanceled:
+		return "预约变更已取消，无需回滚", nil
+	}
+
+	var user model.UserModel
+	if err := tx.First(&user, order.UserID).Error; err != nil {
+		return "", consts.ErrUserNotFound
+	}
+	if user.UserPlan != change.ToPlan || !sameTime(user.ExpireAt, change.ToExpire) {
+		return "套餐已有后续变更，未回滚", nil
+	}
+
+	plan, limit, expire := change.FromPlan, change.FromLimit, change.FromExpire
+	if plan == "" {
+		plan, expire = model.PayPlan(config.GetDefaultPlan()), nil
+		if limit, err = s.setupService.GetPlanLimit(plan); err != nil {
+			return "", err
+		}
+	}
+	revert := &model.PlanChangeModel{
+		UserID: user.ID, OrderID: order.OrderID, Reason: "refund",
+		FromPlan: user.UserPlan, FromLimit: user.ApiLimit, FromExpire: user.ExpireAt,
+		ToPlan: plan, ToLimit: limit, ToExpire: expire,
+	}
+	// 恢复的有效期已过时，由过期检查回退到默认套餐
+	err = tx.Model(&user).Updates(map[string]any{
+		"user_plan": plan, "api_limit": limit, "expire_at": expire,
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", consts.ErrUserPlanUpdateFailed, err)
+	}
+	if err := tx.Create(revert).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("套餐已恢复为 %s", plan), nil
+}
+
+// sameTime 比较两个可能为空的时间，精确到秒
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Unix() == b.Unix()
+}
+
+// applyScheduled 应用已到生效时间的预约变更，返回是否已应用
+func (s *PlanService) applyScheduled(user *model.UserModel) (bool, error) {
+	var change model.PlanChangeModel
+	err := s.db.Where("user_id = ? AND status = ? AND effective_at <= ?",
+		user.ID, model.PlanChangePending, time.Now()).
+		Order("id DESC").First(&change).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	applied := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&change).Where("status = ?", model.PlanChangePending).
+			Update("status", model.PlanChangeApplied)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		err := tx.Model(&model.UserModel{}).Where("id = ?", user.ID).Updates(map[string]any{
+			"user_plan": change.ToPlan, "api_limit": change.ToLimit, "expire_at": change.ToExpire,
+			"cycle_anchor": change.EffectiveAt,
+		}).Error
+		applied = err == nil
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", consts.ErrUserPlanUpdateFailed, err)
+	}
+	if !applied { // 已被并发应用，重新加载最新套餐
+		return true, s.db.First(user, user.ID).Error
+	}
+
+	user.UserPlan, user.ApiLimit, user.ExpireAt = change.ToPlan, change.ToLimit, change.ToExpire
+	user.CycleAnchor = change.EffectiveAt
+	log.Printf("[PLAN] user %d switched to scheduled plan %s", user.ID, change.ToPlan)
+	return true, nil
+}
+
+// roundAmount 金额保留两位小数
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// DowngradeExpired 降级所有已过期的用户，返回降级成功和失败的数量
+func (s *PlanService) DowngradeExpired() (int, int, error) {
+	var users []model.UserModel
+	deadline := time.Now().Add(-config.GetExpireGrace())
+	query := s.db.Where("expire_at IS NOT NULL AND expire_at < ?", deadline)
+	query = query.Where("user_plan <> ?", config.GetDefaultPlan())
+	if err := query.Find(&users).Error; err != nil {
+		return 0, 0, err
+	}
+
+	var processed, failed int
+	for i := range users {
+		if err := s.Downgrade(&users[i], "expired"); err != nil {
+			log.Printf("[PLAN] downgrade user %d failed: %v", users[i].ID, err)
+			failed++
+			continue
+		}
+		processed++
+	}
+	return processed, failed, nil
+}
+
+// StartExpiryCheck 注册过期套餐降级任务
+func (s *PlanService) StartExpiryCheck(interval time.Duration) {
+	NewJobService().Register("plan-expire", interval, s.DowngradeExpired)
+}
+
+// GetPlanChanges 获取用户的套餐变更记录
+func (s *PlanService) GetPlanChanges(userID uint64) ([]model.PlanChangeModel, error) {
+	var changes []model.PlanChangeModel
+	err := s.db.Where("user_id = ?", userID).
+		Order("created_at DESC").Find(&changes).Error
+	return changes, err
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"llm-member/internal/model"
+)
+
+func TestRemainingValue(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	// 3 月 31 日到期的月付套餐，周期从 2 月 28 日开始，共 31 天
+	expireAt := time.Date(2026, 3, 31, 12, 0, 0, 0, loc)
+	monthly := &model.ApiLimit{ExpireMonths: 1}
+	weekly := &model.ApiLimit{ExpireDays: 7}
+
+	tests := []struct {
+		name  string
+		limit *model.ApiLimit
+		now   time.Time
+		price float64
+		want  float64
+	}{
+		{"at expiry", monthly, expireAt, 31, 0},
+		{"after expiry", monthly, expireAt.Add(time.Hour), 31, 0},
+		{"one day left", monthly, expireAt.AddDate(0, 0, -1), 31, 1},
+		{"half period left", monthly, expireAt.Add(-31 * 12 * time.Hour), 31, 15.5},
+		{"period start after month end", monthly, time.Date(2026, 2, 28, 12, 0, 0, 0, loc), 31, 31},
+		{"before period start", monthly, time.Date(2026, 2, 1, 0, 0, 0, 0, loc), 31, 31},
+		{"rounded to cents", monthly, expireAt.AddDate(0, 0, -10), 9.99, 3.22},
+		{"day based plan", weekly, expireAt.AddDate(0, 0, -2), 7, 2},
+	}
+	s := &PlanService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &model.UserModel{ApiLimit: tt.limit, ExpireAt: &expireAt}
+			got := s.remainingValue(user, &model.PlanInfo{Price: tt.price}, tt.now)
+			if got != tt.want {
+				t.Errorf("remainingValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// priceCache 价格表的进程内缓存，写入价格后重新加载，加载失败时沿用上次加载的价格表
+var priceCache struct {
+	sync.RWMutex
+	loaded  bool
+	retryAt time.Time // 加载失败后沿用旧价格表，到期前不再重试
+	prices  map[string]model.PriceModel
+}
+
+// priceRetryInterval 价格表加载失败后的重试间隔
+const priceRetryInterval = 10 * time.Second
+
+type PriceService struct {
+	db *gorm.DB
+}
+
+func NewPriceService() *PriceService {
+	return &PriceService{db: config.GetDB()}
+}
+
+// GetPrices 获取全部模型价格
+func (s *PriceService) GetPrices() ([]model.PriceModel, error) {
+	var prices []model.PriceModel
+	err := s.db.Order("model_id").Find(&prices).Error
+	return prices, err
+}
+
+// SetPrice 新增或更新模型价格
+func (s *PriceService) SetPrice(price *model.PriceModel) error {
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "model_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"input", "output", "cached", "updated_at"}),
+	}).Create(price).Error
+	if err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+// DeletePrice 删除模型价格
+func (s *PriceService) DeletePrice(id uint64) error {
+	result := s.db.Unscoped().Delete(&model.PriceModel{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return consts.ErrPriceNotFound
+	}
+	s.invalidate()
+	return nil
+}
+
+// FindPrice 按顺序查找第一个配置了价格的模型
+func (s *PriceService) FindPrice(models ...string) *model.PriceModel {
+	prices, _ := s.loadPrices()
+	for _, id := range models {
+		if price, ok := prices[id]; ok && id != "" {
+			return &price
+		}
+	}
+	return nil
+}
+
+// Compute 计算请求费用：按输入、输出价格计费，命中缓存时按缓存价格计费
+// 未配置缓存价格时按正常价格计费，命中缓存的费用再按套餐的 rate 折算，最终乘以套餐倍率
+func (s *PriceService) Compute(plan *model.PlanInfo, usage model.Usage, cached bool, models ...string) float64 {
+	price := s.FindPrice(models...)
+	if price == nil {
+		return 0
+	}
+
+	multiplier, rate := 1.0, 1.0
+	if plan != nil && plan.Multiplier > 0 {
+		multiplier = plan.Multiplier
+	}
+	if cached && plan != nil && plan.Cache != nil {
+		rate = plan.Cache.Rate
+	}
+
+	var cost float64
+	if cached && price.Cached > 0 {
+		cost = float64(usage.PromptTokens+usage.CompletionTokens) * price.Cached
+	} else {
+		cost = float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output
+	}
+	if cached {
+		cost *= rate
+	}
+	return cost / 1e6 * multiplier
+}
+
+// Available 检查价格表是否可用，从未成功加载时返回错误，按费用计量的套餐据此拒绝请求
+func (s *PriceService) Available() error {
+	_, err := s.loadPrices()
+	return err
+}
+
+// loadPrices 加载价格表，数据库异常时沿用上次加载的价格表，间隔 priceRetryInterval 后重试
+func (s *PriceService) loadPrices() (map[string]model.PriceModel, error) {
+	priceCache.RLock()
+	if pricesFresh() {
+		defer priceCache.RUnlock()
+		return priceCache.prices, nil
+	}
+	priceCache.RUnlock()
+
+	priceCache.Lock()
+	defer priceCache.Unlock()
+	if pricesFresh() {
+		return priceCache.prices, nil
+	}
+	prices, err := s.GetPrices()
+	if err != nil {
+		log.Printf("[PRICE] load prices failed: %v", err)
+		if priceCache.prices == nil {
+			return nil, fmt.Errorf("%w: %v", consts.ErrPriceTableUnavailable, err)
+		}
+		priceCache.retryAt = time.Now().Add(priceRetryInterval)
+		return priceCache.prices, nil
+	}
+	priceCache.prices = make(map[string]model.PriceModel, len(prices))
+	for _, price := range prices {
+		priceCache.prices[price.ModelID] = price
+	}
+	priceCache.loaded = true
+	return priceCache.prices, nil
+}
+
+// pricesFresh 价格表已加载或仍在失败重试间隔内，调用方需持有锁
+func pricesFresh() bool {
+	return priceCache.loaded || time.Now().Before(priceCache.retryAt)
+}
+
+// invalidate 标记价格表需要重新加载，保留当前价格表供加载失败时使用
+func (s *PriceService) invalidate() {
+	priceCache.Lock()
+	priceCache.loaded, priceCache.retryAt = false, time.Time{}
+	priceCache.Unlock()
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// reserveScript 在剩余额度内预留 Token，超出时回滚
+// 返回 {是否成功, 当前预留总量}
+var reserveScript = redis.NewScript(`
+local reserved = redis.call('INCRBY', KEYS[1], ARGV[1])
+if reserved > tonumber(ARGV[2]) then
+	reserved = redis.call('DECRBY', KEYS[1], ARGV[1])
+	return {0, reserved}
+end
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return {1, reserved}
+`)
+
+// reservationTTL 预留记录的兜底过期时间，防止进程异常退出后额度被长期占用
+const reservationTTL = 10 * time.Minute
+
+// memoryReserved 无 Redis 时使用的进程内预留记录
+var memoryReserved = struct {
+	sync.Mutex
+	tokens map[uint64]int64
+}{tokens: make(map[uint64]int64)}
+
+type QuotaService struct {
+	redis *redis.Client
+
+	tokenService *TokenService
+}
+
+func NewQuotaService() *QuotaService {
+	return &QuotaService{
+		redis:        config.GetRedis(),
+		tokenService: NewTokenService(),
+	}
+}
+
+// Estimate 预估请求消耗的 Token：提示词 Token + max_tokens（未指定时使用默认值）
+func (s *QuotaService) Estimate(req *model.ChatRequest) model.Usage {
+	prompt, _ := s.tokenService.CountMsgsToken(req.Messages, req.Model, req.Stream)
+	completion := config.GetDefaultMaxTokens()
+	if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		completion = *req.MaxTokens
+	}
+	return model.Usage{
+		PromptTokens: prompt, CompletionTokens: completion,
+		TotalTokens: prompt + completion,
+	}
+}
+
+// Reserve 按 Token 计量的套餐在剩余额度中预留本次请求的预估用量
+// 返回的 release 需在实际用量入账后调用，以释放预留
+func (s *QuotaService) Reserve(user *model.UserModel, tokens int) (func(), error) {
+	release := func() {}
+	if user.ApiUsage == nil || user.ApiLimit == nil {
+		return release, nil
+	}
+	usage, limit := CurrentUsage(user, time.Now()), user.ApiLimit
+	if tokens <= 0 || (limit.DailyTokens == 0 && limit.MonthlyTokens == 0) {
+		return release, nil
+	}
+
+	remaining := int64(math.MaxInt64)
+	if limit.DailyTokens > 0 {
+		remaining = int64(limit.DailyTokens) - int64(usage.TodayTokens)
+	}
+	if limit.MonthlyTokens > 0 {
+		remaining = min(remaining, int64(limit.MonthlyTokens)-int64(usage.TotalTokens))
+	}
+	ok, reserved := s.reserve(user.ID, int64(tokens), remaining)
+	if !ok {
+		available := max(remaining-reserved, 0)
+		return release, fmt.Errorf("%w (%d/%d)", consts.ErrTokenQuotaInsufficient, tokens, available)
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() { s.release(user.ID, int64(tokens)) })
+	}
+	return release, nil
+}
+
+func (s *QuotaService) key(userID uint64) string {
+	return fmt.Sprintf("quota:reserved:%d", userID)
+}
+
+func (s *QuotaService) reserve(userID uint64, tokens, remaining int64) (bool, int64) {
+	if s.redis == nil {
+		memoryReserved.Lock()
+		defer memoryReserved.Unlock()
+		reserved := memoryReserved.tokens[userID]
+		if reserved+tokens > remaining {
+			return false, reserved
+		}
+		memoryReserved.tokens[userID] = reserved + tokens
+		return true, reserved + tokens
+	}
+
+	res, err := reserveScript.Run(
+		context.Background(), s.redis, []string{s.key(userID)},
+		tokens, remaining, int(reservationTTL.Seconds()),
+	).Int64Slice()
+	if err != nil || len(res) != 2 {
+		// Redis 异常时放行，仍由 CheckUsage 兜底
+		log.Printf("[QUOTA] reserve failed: %v", err)
+		return true, 0
+	}
+	return res[0] == 1, res[1]
+}
+
+func (s *QuotaService) release(userID uint64, tokens int64) {
+	if s.redis == nil {
+		memoryReserved.Lock()
+		defer memoryReserved.Unlock()
+		memoryReserved.tokens[userID] -= tokens
+		if memoryReserved.tokens[userID] <= 0 {
+			delete(memoryReserved.tokens, userID)
+		}
+		return
+	}
+
+	ctx, key := context.Background(), s.key(userID)
+	if reserved, err := s.redis.DecrBy(ctx, key, tokens).Result(); err != nil {
+		log.Printf("[QUOTA] release failed: %v", err)
+	} else if reserved <= 0 {
+		s.redis.Del(ctx, key)
+	}
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// rateWindow 滑动窗口大小
+const rateWindow = time.Minute
+
+// requestScript 滑动窗口请求计数，未超限时记录本次请求
+// 返回 {是否通过, 窗口内请求数, 最早请求时间(ms)}
+var requestScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, ARGV[1] - ARGV[2])
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	count = count + 1
+	allowed = 1
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {allowed, count, tonumber(oldest[2] or ARGV[1])}
+`)
+
+// tokenScript 统计滑动窗口内的 Token 数，成员格式为 id:tokens
+// 返回 {窗口内 Token 数, 最早记录时间(ms)}
+var tokenScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, ARGV[1] - ARGV[2])
+local items = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+local sum, oldest = 0, tonumber(ARGV[1])
+for i = 1, #items, 2 do
+	sum = sum + (tonumber(string.match(items[i], ':(%d+)$')) or 0)
+	if i == 1 then oldest = tonumber(items[i + 1]) end
+end
+return {sum, oldest}
+`)
+
+// memoryLimiter 无 Redis 时使用的进程内滑动窗口，每个窗口周期清理一次空闲用户
+var memoryLimiter = struct {
+	sync.Mutex
+	requests map[uint64][]time.Time
+	tokens   map[uint64][]tokenEntry
+	running  map[uint64]int
+	sweptAt  time.Time
+}{
+	requests: make(map[uint64][]time.Time),
+	tokens:   make(map[uint64][]tokenEntry),
+	running:  make(map[uint64]int),
+}
+
+type tokenEntry struct {
+	at     time.Time
+	tokens int
+}
+
+// redisFailures Redis 异常时放行请求，错误按窗口周期汇总输出，避免刷屏
+var redisFailures = struct {
+	sync.Mutex
+	loggedAt   time.Time
+	suppressed int
+}{}
+
+// RateLimitResult 速率限制检查结果，用于输出 x-ratelimit-* 响应头
+type RateLimitResult struct {
+	Limit *model.RateLimit
+
+	RemainingRequests int
+	RemainingTokens   int
+	ResetRequests     time.Duration
+	ResetTokens       time.Duration
+	RetryAfter        time.Duration
+}
+
+type RateLimitService struct {
+	redis *redis.Client
+}
+
+func NewRateLimitService() *RateLimitService {
+	return &RateLimitService{redis: config.GetRedis()}
+}
+
+// Resolve 合并套餐与用户级速率限制，用户设置的非零字段优先
+func (s *RateLimitService) Resolve(plan *model.PlanInfo, user *model.UserModel) *model.RateLimit {
+	limit := &model.RateLimit{}
+	if plan != nil && plan.Entitlements != nil {
+		limit = plan.Entitlements.RateLimit()
+	}
+	if override := user.RateLimit; override != nil {
+		if override.RPM > 0 {
+			limit.RPM = override.RPM
+		}
+		if override.TPM > 0 {
+			limit.TPM = override.TPM
+		}
+		if override.Concurrency > 0 {
+			limit.Concurrency = override.Concurrency
+		}
+	}
+	return limit
+}
+
+// Acquire 检查并占用速率配额，返回的 release 用于在请求结束时释放并发占用
+func (s *RateLimitService) Acquire(userID uint64, limit *model.RateLimit) (*RateLimitResult, func(), error) {
+	release := func() {}
+	if limit.IsZero() {
+		return nil, release, nil
+	}
+
+	result := &RateLimitResult{Limit: limit}
+	if limit.Concurrency > 0 {
+		if !s.acquireSlot(userID, limit.Concurrency) {
+			result.RetryAfter = time.Second
+			return result, release, fmt.Errorf("%w (%d)", consts.ErrConcurrencyLimitReached, limit.Concurrency)
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { s.releaseSlot(userID) }) }
+	}
+
+	// 先检查 Token 窗口，避免被拒绝的请求占用请求窗口
+	if limit.TPM > 0 {
+		used, reset := s.countTokens(userID)
+		result.RemainingTokens = max(limit.TPM-used, 0)
+		result.ResetTokens = reset
+		if used >= limit.TPM {
+			release()
+			result.RetryAfter = reset
+			return result, func() {}, fmt.Errorf("%w (%d/%d)", consts.ErrTokenRateLimitReached, used, limit.TPM)
+		}
+	}
+
+	if limit.RPM > 0 {
+		allowed, count, reset := s.takeRequest(userID, limit.RPM)
+		result.RemainingRequests = max(limit.RPM-count, 0)
+		result.ResetRequests = reset
+		if !allowed {
+			release()
+			result.RetryAfter = reset
+			return result, func() {}, fmt.Errorf("%w (%d/%d)", consts.ErrRequestRateLimitReached, count, limit.RPM)
+		}
+	}
+	return result, release, nil
+}
+
+// RecordTokens 记录请求实际消耗的 Token，计入 TPM 窗口
+func (s *RateLimitService) RecordTokens(userID uint64, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	now := time.Now()
+	if s.redis == nil {
+		memoryLimiter.Lock()
+		defer memoryLimiter.Unlock()
+		sweepMemory(now)
+		memoryLimiter.tokens[userID] = append(
+			memoryLimiter.tokens[userID], tokenEntry{at: now, tokens: tokens},
+		)
+		return
+	}
+
+	key := s.key("tpm", userID)
+	member := fmt.Sprintf("%s:%d", uuid.NewString(), tokens)
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: member})
+	pipe.PExpire(ctx, key, rateWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logRedisFailure("record tokens", err)
+	}
+}
+
+// Headers 生成 OpenAI 客户端可识别的 x-ratelimit-* 响应头
+func (r *RateLimitResult) Headers() map[string]string {
+	headers := map[string]string{}
+	if r == nil || r.Limit == nil {
+		return headers
+	}
+	if r.Limit.RPM > 0 {
+		headers["x-ratelimit-limit-requests"] = strconv.Itoa(r.Limit.RPM)
+		headers["x-ratelimit-remaining-requests"] = strconv.Itoa(r.RemainingRequests)
+		headers["x-ratelimit-reset-requests"] = formatReset(r.ResetRequests)
+	}
+	if r.Limit.TPM > 0 {
+		headers["x-ratelimit-limit-tokens"] = strconv.Itoa(r.Limit.TPM)
+		headers["x-ratelimit-remaining-tokens"] = strconv.Itoa(r.RemainingTokens)
+		headers["x-ratelimit-reset-tokens"] = formatReset(r.ResetTokens)
+	}
+	if r.RetryAfter > 0 {
+		seconds := int((r.RetryAfter + time.Second - 1) / time.Second)
+		headers["Retry-After"] = strconv.Itoa(seconds)
+	}
+	return headers
+}
+
+func (s *RateLimitService) key(kind string, userID uint64) string {
+	return fmt.Sprintf("ratelimit:%s:%d", kind, userID)
+}
+
+// takeRequest 在请求窗口中占用一次，返回是否通过、窗口内请求数与窗口重置时间
+func (s *RateLimitService) takeRequest(userID uint64, limit int) (bool, int, time.Duration) {
+	now := time.Now()
+	if s.redis == nil {
+		memoryLimiter.Lock()
+		defer memoryLimiter.Unlock()
+		sweepMemory(now)
+		list := pruneTimes(memoryLimiter.requests[userID], now)
+		allowed := len(list) < limit
+		if allowed {
+			list = append(list, now)
+		}
+		if len(list) > 0 {
+			memoryLimiter.requests[userID] = list
+		} else {
+			delete(memoryLimiter.requests, userID)
+		}
+		reset := time.Duration(0)
+		if len(list) > 0 {
+			reset = list[0].Add(rateWindow).Sub(now)
+		}
+		return allowed, len(list), reset
+	}
+
+	keys := []string{s.key("rpm", userID)}
+	res, err := requestScript.Run(
+		context.Background(), s.redis, keys, now.UnixMilli(),
+		rateWindow.Milliseconds(), limit, uuid.NewString(),
+	).Int64Slice()
+	if err != nil || len(res) != 3 {
+		// Redis 异常时放行，避免影响正常请求
+		logRedisFailure("request window", err)
+		return true, 0, 0
+	}
+	reset := time.UnixMilli(res[2]).Add(rateWindow).Sub(now)
+	return res[0] == 1, int(res[1]), reset
+}
+
+// countTokens 统计 Token 窗口内已消耗的 Token 数与窗口重置时间
+func (s *RateLimitService) countTokens(userID uint64) (int, time.Duration) {
+	now := time.Now()
+	if s.redis == nil {
+		memoryLimiter.Lock()
+		defer memoryLimiter.Unlock()
+		sweepMemory(now)
+		list := pruneTokens(memoryLimiter.tokens[userID], now)
+		if len(list) > 0 {
+			memoryLimiter.tokens[userID] = list
+		} else {
+			delete(memoryLimiter.tokens, userID)
+		}
+		used, reset := 0, time.Duration(0)
+		for _, entry := range list {
+			used += entry.tokens
+		}
+		if len(list) > 0 {
+			reset = list[0].at.Add(rateWindow).Sub(now)
+		}
+		return used, reset
+	}
+
+	keys := []string{s.key("tpm", userID)}
+	res, err := tokenScript.Run(
+		context.Background(), s.redis, keys,
+		now.UnixMilli(), rateWindow.Milliseconds(),
+	).Int64Slice()
+	if err != nil || len(res) != 2 {
+		logRedisFailure("token window", err)
+		return 0, 0
+	}
+	return int(res[0]), time.UnixMilli(res[1]).Add(rateWindow).Sub(now)
+}
+
+// acquireSlot 占用一个并发名额
+func (s *RateLimitService) acquireSlot(userID uint64, limit int) bool {
+	if s.redis == nil {
+		memoryLimiter.Lock()
+		defer memoryLimiter.Unlock()
+		if memoryLimiter.running[userID] >= limit {
+			return false
+		}
+		memoryLimiter.running[userID]++
+		return true
+	}
+
+	ctx, key := context.Background(), s.key("concurrency", userID)
+	count, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		logRedisFailure("acquire slot", err)
+		return true
+	}
+	// 兜底过期，防止进程异常退出导致计数无法释放
+	if err := s.redis.Expire(ctx, key, 10*time.Minute).Err(); err != nil {
+		logRedisFailure("expire slot", err)
+	}
+	if count > int64(limit) {
+		s.redis.Decr(ctx, key)
+		return false
+	}
+	return true
+}
+
+// releaseSlot 释放并发名额
+func (s *RateLimitService) releaseSlot(userID uint64) {
+	if s.redis == nil {
+		memoryLimiter.Lock()
+		defer memoryLimiter.Unlock()
+		if memoryLimiter.running[userID] > 1 {
+			memoryLimiter.running[userID]--
+		} else {
+			delete(memoryLimiter.running, userID)
+		}
+		return
+	}
+
+	ctx, key := context.Background(), s.key("concurrency", userID)
+	count, err := s.redis.Decr(ctx, key).Result()
+	if err != nil {
+		logRedisFailure("release slot", err)
+	} else if count < 0 {
+		s.redis.Set(ctx, key, 0, 10*time.Minute)
+	}
+}
+
+// sweepMemory 清理窗口已空且无并发占用的用户，调用方需持有 memoryLimiter 锁
+func sweepMemory(now time.Time) {
+	if now.Sub(memoryLimiter.sweptAt) < rateWindow {
+		return
+	}
+	memoryLimiter.sweptAt = now
+	for userID, list := range memoryLimiter.requests {
+		if list = pruneTimes(list, now); len(list) > 0 {
+			memoryLimiter.requests[userID] = list
+		} else {
+			delete(memoryLimiter.requests, userID)
+		}
+	}
+	for userID, list := range memoryLimiter.tokens {
+		if list = pruneTokens(list, now); len(list) > 0 {
+			memoryLimiter.tokens[userID] = list
+		} else {
+			delete(memoryLimiter.tokens, userID)
+		}
+	}
+	for userID, running := range memoryLimiter.running {
+		if running <= 0 {
+			delete(memoryLimiter.running, userID)
+		}
+	}
+}
+
+// logRedisFailure 记录 Redis 异常，每个窗口周期至少输出一次，并附带期间省略的次数
+func logRedisFailure(op string, err error) {
+	redisFailures.Lock()
+	defer redisFailures.Unlock()
+	if time.Since(redisFailures.loggedAt) < rateWindow {
+		redisFailures.suppressed++
+		return
+	}
+	log.Printf("[RATELIMIT] %s failed, allowing request: %v (%d similar errors suppressed)",
+		op, err, redisFailures.suppressed)
+	redisFailures.loggedAt, redisFailures.suppressed = time.Now(), 0
+}
+
+func pruneTimes(list []time.Time, now time.Time) []time.Time {
+	for len(list) > 0 && now.Sub(list[0]) >= rateWindow {
+		list = list[1:]
+	}
+	return list
+}
+
+func pruneTokens(list []tokenEntry, now time.Time) []tokenEntry {
+	for len(list) > 0 && now.Sub(list[0].at) >= rateWindow {
+		list = list[1:]
+	}
+	return list
+}
+
+func formatReset(d time.Duration) string {
+	if d <= 0 {
+		return "0s"
+	}
+	return d.Round(time.Millisecond).String()
+}
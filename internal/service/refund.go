@@ -0,0 +1,333 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+	"llm-member/internal/payment"
+
+	"gorm.io/gorm"
+)
+
+type RefundService struct {
+	db *gorm.DB
+
+	orderService  *OrderService
+	planService   *PlanService
+	walletService *WalletService
+}
+
+func NewRefundService() *RefundService {
+	return &RefundService{
+		db: config.GetDB(), orderService: NewOrderService(),
+		planService: NewPlanService(), walletService: NewWalletService(),
+	}
+}
+
+// Refund 发起订单退款：调用支付渠道退款，更新订单状态，并回滚订单发放的套餐或余额
+// 金额为 0 时退还剩余全部金额；部分退款只退钱，不回滚套餐
+func (s *RefundService) Refund(orderID string, req *model.RefundRequest, change model.OrderChange) (*model.RefundModel, error) {
+	order, err := s.orderService.FindOrder(orderID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
+	}
+	if !order.Status.CanTransit(model.PaymentRefunded) {
+		return nil, fmt.Errorf("%w: %s", consts.ErrOrderNotRefundable, order.Status)
+	}
+	if provider, ok := payment.Lookup(order.Method); !ok || !provider.Refund {
+		return nil, fmt.Errorf("%w: %s", consts.ErrPaymentMethodNotSupported, order.Method)
+	}
+
+	remain := roundAmount(order.Amount - order.Refunded)
+	amount := roundAmount(req.Amount)
+	if amount == 0 {
+		amount = remain
+	}
+	if amount <= 0 || amount > remain {
+		return nil, fmt.Errorf("%w: %.2f, refundable %.2f", consts.ErrInvalidRefundAmount, amount, remain)
+	}
+	// 充值的余额已被消费时无法扣回，不允许退款
+	if order.Kind == model.OrderTopup {
+		balance, err := s.walletService.GetBalance(order.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if balance < amount {
+			return nil, fmt.Errorf("%w: balance %.2f", consts.ErrInsufficientBalance, balance)
+		}
+	}
+
+	refund, err := s.newRefund(order, amount, req.Reason, change)
+	if err != nil {
+		return nil, err
+	}
+	// 先预占可退金额再调用渠道，并发退款时超出部分在预占时即被拒绝
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.reserve(tx, order, refund)
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := payment.NewPayment(order.Method).Refund(order, refund); err != nil {
+		// 渠道已受理、结果异步通知，保留预占金额和待处理记录，由回调确认或释放
+		if errors.Is(err, consts.ErrRefundProcessing) {
+			log.Printf("[refund][%s] refund %s accepted, waiting for notify", order.OrderID, refund.RefundID)
+			return refund, nil
+		}
+		consts.LogDetailedError(
+			consts.PaymentProvider(order.Method),
+			consts.ErrorTypeRefund, err, "refund order",
+		)
+		s.release(order, refund, err.Error())
+		return refund, consts.GetFriendlyError(err)
+	}
+	return refund, s.complete(order, refund, change)
+}
+
+// Confirm 处理渠道异步通知的退款结果：成功时回滚订单发放的权益，失败时释放预占的金额
+func (s *RefundService) Confirm(method model.PaymentMethod, event *payment.Event) (model.EventResult, error) {
+	var refund model.RefundModel
+	if err := s.db.Where("refund_id = ?", event.RefundID).First(&refund).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[refund] 退款 %s 不存在，忽略 %s 回调", event.RefundID, method)
+			return model.EventIgnored, nil
+		}
+		return "", err
+	}
+	order, err := s.orderService.FindOrder(refund.OrderID)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
+	}
+	// 只确认本渠道发起且仍在处理中的退款，重复通知直接忽略
+	if order.Method != method || refund.Status != model.RefundPending {
+		return model.EventIgnored, nil
+	}
+
+	switch event.Status {
+	case payment.EventStatusRefunded:
+		if event.Amount > 0 && roundAmount(event.Amount) != refund.Amount {
+			return "", fmt.Errorf(
+				"%w: refund %.2f, expected %.2f", consts.ErrPaymentAmountMismatch,
+				event.Amount, refund.Amount,
+			)
+		}
+		change := model.OrderChange{
+			Source: model.OrderSourceWebhook, Actor: string(method), Remark: event.Type,
+		}
+		return model.EventProcessed, s.complete(order, &refund, change)
+	case payment.EventStatusFailed:
+		s.release(order, &refund, "渠道通知退款失败: "+event.Type)
+		return model.EventProcessed, nil
+	default:
+		return model.EventIgnored, nil
+	}
+}
+
+// Record 登记渠道侧发起的退款（商户后台退款、拒付等），与后台退款一样回滚订单发放的权益
+// 金额为 0 或超过可退金额时按剩余全部金额处理
+func (s *RefundService) Record(order *model.OrderModel, amount float64, reason string, change model.OrderChange) (*model.RefundModel, error) {
+	remain := roundAmount(order.Amount - order.Refunded)
+	if amount = roundAmount(amount); amount <= 0 || amount > remain {
+		amount = remain
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: %.2f, refundable %.2f", consts.ErrInvalidRefundAmount, amount, remain)
+	}
+	refund, err := s.newRefund(order, amount, reason, change)
+	if err != nil {
+		return nil, err
+	}
+	// 渠道已完成退款，预占与回滚在同一事务中完成
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.reserve(tx, order, refund); err != nil {
+			return err
+		}
+		return s.settle(tx, order, refund, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Kind == model.OrderSubscribe && order.Status == model.PaymentRefunded {
+		s.cancelSubscription(order, refund)
+	}
+	go s.notify(order, refund)
+	return refund, nil
+}
+
+// complete 渠道退款完成后回滚订单发放的权益，全额退款的自动续费订单同时取消订阅
+func (s *RefundService) complete(order *model.OrderModel, refund *model.RefundModel, change model.OrderChange) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.settle(tx, order, refund, change)
+	})
+	if err != nil {
+		// 渠道已退款但本地处理失败，保留待处理记录供人工核对
+		log.Printf("[refund][%s] refund %s settle failed: %v", order.OrderID, refund.RefundID, err)
+		s.db.Model(refund).Update("error", err.Error())
+		return err
+	}
+
+	if order.Kind == model.OrderSubscribe && order.Status == model.PaymentRefunded {
+		s.cancelSubscription(order, refund)
+	}
+	go s.notify(order, refund)
+	return nil
+}
+
+// release 渠道退款失败，释放预占的金额并将退款记录标记为失败
+func (s *RefundService) release(order *model.OrderModel, refund *model.RefundModel, reason string) {
+	refund.Status, refund.Error = model.RefundFailed, reason
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.OrderModel{}).Where("id = ?", order.ID).
+			UpdateColumn("refunded", gorm.Expr("refunded - ?", refund.Amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(refund).Updates(map[string]any{
+			"status": refund.Status, "error": refund.Error,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("[refund][%s] release refund %s failed: %v", order.OrderID, refund.RefundID, err)
+	}
+}
+
+// GetRefunds 获取订单的退款记录
+func (s *RefundService) GetRefunds(orderID string) ([]model.RefundModel, error) {
+	var refunds []model.RefundModel
+	err := s.db.Where("order_id = ?", orderID).Order("id").Find(&refunds).Error
+	return refunds, err
+}
+
+// HasRefund 订单是否有进行中或已完成的退款，渠道的退款回调据此忽略
+func (s *RefundService) HasRefund(orderID string) bool {
+	var count int64
+	s.db.Model(&model.RefundModel{}).Where(
+		"order_id = ? AND status IN ?", orderID,
+		[]model.RefundStatus{model.RefundPending, model.RefundSucceed},
+	).Count(&count)
+	return count > 0
+}
+
+// newRefund 创建待处理的退款记录
+func (s *RefundService) newRefund(order *model.OrderModel, amount float64, reason string, change model.OrderChange) (*model.RefundModel, error) {
+	refund := &model.RefundModel{
+		OrderID: order.OrderID, Amount: amount, Currency: payment.Currency(order),
+		Reason: reason, Status: model.RefundPending,
+		Actor: change.Actor, Source: change.Source,
+	}
+	var err error
+	if refund.RefundID, err = s.generateRefundID(); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// reserve 在事务中预占可退金额并写入退款记录，超出可退金额时失败
+func (s *RefundService) reserve(tx *gorm.DB, order *model.OrderModel, refund *model.RefundModel) error {
+	result := tx.Model(&model.OrderModel{}).
+		Where("id = ? AND refunded + ? <= amount + 0.001", order.ID, refund.Amount).
+		UpdateColumn("refunded", gorm.Expr("refunded + ?", refund.Amount))
+	if result.Error != nil {
+		return fmt.Errorf("%w: %v", consts.ErrOrderStatusUpdateFailed, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", consts.ErrOrderStatusConflict, order.OrderID)
+	}
+	return tx.Create(refund).Error
+}
+
+// settle 在事务中变更订单状态并回滚订单发放的权益，退款金额已在发起时预占
+func (s *RefundService) settle(tx *gorm.DB, order *model.OrderModel, refund *model.RefundModel, change model.OrderChange) error {
+	// 重新读取订单，并发退款期间状态可能已变更
+	if err := tx.First(order, order.ID).Error; err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
+	}
+	// 按已完成的退款判断是否全额退款，预占中的退款可能仍会失败
+	var settled float64
+	err := tx.Model(&model.RefundModel{}).
+		Where("order_id = ? AND status = ?", order.OrderID, model.RefundSucceed).
+		Select("COALESCE(SUM(amount), 0)").Scan(&settled).Error
+	if err != nil {
+		return err
+	}
+
+	to := model.PaymentPartialRefunded
+	if roundAmount(settled+refund.Amount) >= order.Amount {
+		to = model.PaymentRefunded
+	}
+	change.Remark = fmt.Sprintf("退款 %.2f: %s", refund.Amount, refund.Reason)
+	if order.Status == to { // 再次部分退款，状态不变，仅记录
+		if err := s.orderService.record(tx, order.OrderID, to, to, change); err != nil {
+			return err
+		}
+	} else if err := s.orderService.transit(tx, order, to, change); err != nil {
+		return err
+	}
+
+	switch {
+	case order.Kind == model.OrderTopup:
+		_, err := s.walletService.DebitTx(
+			tx, order.UserID, refund.Amount, model.LedgerRefund,
+			order.OrderID, "退款扣回: "+refund.Reason, true,
+		)
+		if err != nil {
+			return err
+		}
+		refund.Reversal = fmt.Sprintf("扣回余额 %.2f", refund.Amount)
+	case to != model.PaymentRefunded:
+		refund.Reversal = "部分退款，保留套餐"
+	default:
+		reversal, err := s.planService.RevertOrder(tx, order)
+		if err != nil {
+			return err
+		}
+		refund.Reversal = reversal
+	}
+
+	refund.Status = model.RefundSucceed
+	return tx.Model(refund).Updates(map[string]any{
+		"status": refund.Status, "reversal": refund.Reversal,
+	}).Error
+}
+
+// cancelSubscription 自动续费订单全额退款后取消订阅，失败只记录不影响退款结果
+func (s *RefundService) cancelSubscription(order *model.OrderModel, refund *model.RefundModel) {
+	var sub model.SubscriptionModel
+	if err := s.db.Where("order_id = ?", order.OrderID).First(&sub).Error; err != nil {
+		return
+	}
+	note := "，已取消自动续费"
+	if _, err := NewSubscriptionService().Cancel(sub.UserID, sub.ID); err != nil {
+		log.Printf("[refund][%s] cancel subscription %d failed: %v", order.OrderID, sub.ID, err)
+		note = "，取消自动续费失败"
+	}
+	refund.Reversal += note
+	s.db.Model(refund).Update("reversal", refund.Reversal)
+}
+
+// notify 邮件通知用户退款结果
+func (s *RefundService) notify(order *model.OrderModel, refund *model.RefundModel) {
+	var user model.UserModel
+	if err := s.db.First(&user, order.UserID).Error; err != nil || user.Email == "" {
+		return
+	}
+	if err := NewMailService().SendRefundEmail(&user, order, refund); err != nil {
+		log.Printf("[refund][%s] send refund email failed: %v", order.OrderID, err)
+	}
+}
+
+func (s *RefundService) generateRefundID() (string, error) {
+	bytes := make([]byte, 4)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("RF%d%s", time.Now().Unix(), hex.EncodeToString(bytes)), nil
+}
@@ -31,10 +31,11 @@ type APIConfig struct {
 }
 
 type RelayService struct {
+	catalog *CatalogService
 }
 
 func NewRelayService() *RelayService {
-	return &RelayService{}
+	return &RelayService{catalog: NewCatalogService()}
 }
 
 func (s *RelayService) ChatCompletions(ctx context.Context, req *model.ChatRequest) (*model.ChatResponse, error) {
@@ -93,10 +94,13 @@ func (s *RelayService) GetAPIConfig(model string) (*APIConfig, error) {
 	if apiConfig.Provider == "unknown" {
 		return nil, fmt.Errorf("%w: %s", consts.ErrUnsupportedModel, model)
 	}
+	if apiConfig.Provider == "disabled" {
+		return nil, fmt.Errorf("%w: %s", consts.ErrModelDisabled, model)
+	}
 
 	if provider := config.GetProvider(apiConfig.Provider); provider == nil {
-		fmt.Printf("[LLM] Provider %s not found in config\n", provider)
-		return nil, fmt.Errorf("%w: %s", consts.ErrProviderNotConfigured, provider)
+		fmt.Printf("[LLM] Provider %s not found in config\n", apiConfig.Provider)
+		return nil, fmt.Errorf("%w: %s", consts.ErrProviderNotConfigured, apiConfig.Provider)
 	} else {
 		apiConfig.APIKey = provider.APIKey
 		apiConfig.BaseURL = provider.BaseURL
@@ -204,8 +208,21 @@ func (s *RelayService) GetModels() []model.LLModelInfo {
 		}...)
 	}
 
-	// OpenAI-Like 模型
-	if config.HasProvider("openai-like") {
+	// 自动发现的模型
+	discovered := map[string]bool{}
+	for _, item := range s.catalog.GetEnabledModels() {
+		if !config.HasProvider(item.Provider) {
+			continue
+		}
+		discovered[item.Provider] = true
+		modelList = append(modelList, model.LLModelInfo{
+			ID: item.ModelID, Object: "model",
+			Provider: item.Provider, Name: item.ModelID,
+		})
+	}
+
+	// OpenAI-Like 模型（尚未发现模型时保留占位模型）
+	if config.HasProvider("openai-like") && !discovered["openai-like"] {
 		modelList = append(modelList, []model.LLModelInfo{
 			{ID: "custom-model", Object: "model", Provider: "openai-like", Name: "Custom Model"},
 		}...)
@@ -215,6 +232,15 @@ func (s *RelayService) GetModels() []model.LLModelInfo {
 }
 
 func (s *RelayService) GetProvider(model string) string {
+	// 模型目录中登记的模型优先，已禁用的模型不再按前缀路由
+	provider, disabled := s.catalog.FindProvider(model)
+	if provider != "" {
+		return provider
+	}
+	if disabled {
+		return "disabled"
+	}
+
 	// OpenAI 模型
 	if strings.HasPrefix(model, "gpt-") {
 		return "openai"
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +20,12 @@ import (
 	"gorm.io/gorm"
 )
 
+// planKeyPattern 套餐标识：小写字母、数字、下划线和短横线，与 user_plan 列长度一致
+var planKeyPattern = regexp.MustCompile(`^[a-z0-9_-]{1,20}$`)
+
+// currencyPattern ISO 4217 币种代码
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
 type SetupService struct {
 	db *gorm.DB
 
@@ -107,98 +115,221 @@ func (s *SetupService) GetAllConfigs() ([]model.ConfigModel, error) {
 	return configs, err
 }
 
-// GetAllPlans 获取所有付费方案配置
+// GetAllPlans 获取所有付费方案配置，按展示顺序排列
 func (s *SetupService) GetAllPlans() []model.PlanInfo {
+	configs, err := s.GetByKind("plan")
+	if err != nil {
+		return nil
+	}
+
 	var plans []model.PlanInfo
-	keys := []string{"basic", "extra", "ultra", "super"}
-	for _, key := range keys {
-		plan := model.PlanInfo{Plan: key}
-		err := s.GetAsTarget("plan."+key, &plan)
-		if err != nil {
+	for _, item := range configs {
+		plan := model.PlanInfo{Plan: strings.TrimPrefix(item.Key, "plan.")}
+		if err := json.Unmarshal([]byte(item.Data), &plan); err != nil {
 			continue
 		}
+		if err := normalizePlan(&plan); err != nil {
+			log.Printf("[SETUP] plan %s usage error: %v", plan.Plan, err)
+		}
 		plans = append(plans, plan)
 	}
+	sort.SliceStable(plans, func(i, j int) bool {
+		if plans[i].Sort != plans[j].Sort {
+			return plans[i].Sort < plans[j].Sort
+		}
+		return plans[i].Price < plans[j].Price
+	})
 	return plans
 }
 
-// GetEnablePlans 获取已启用付费方案配置
+// GetEnablePlans 获取可购买的付费方案配置
 func (s *SetupService) GetEnablePlans() []model.PlanInfo {
 	var plans []model.PlanInfo
-	keys := []string{"basic", "extra", "ultra", "super"}
-	for _, key := range keys {
-		plan := model.PlanInfo{Plan: key}
-		err := s.GetAsTarget("plan."+key, &plan)
-		if err != nil || !plan.Enabled {
-			continue
+	for _, plan := range s.GetAllPlans() {
+		if plan.Enabled && !plan.Archived {
+			plans = append(plans, plan)
 		}
-		plans = append(plans, plan)
 	}
 	return plans
 }
 
+// SavePlan 校验并保存套餐配置，不存在时创建
+func (s *SetupService) SavePlan(plan *model.PlanInfo) error {
+	if err := s.ValidatePlan(plan); err != nil {
+		return err
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	return s.SetConfig(&model.ConfigModel{
+		Kind: "plan", Key: "plan." + plan.Plan, Data: string(data),
+	})
+}
+
+// SortPlans 按给定的套餐顺序更新展示顺序
+func (s *SetupService) SortPlans(keys []string) error {
+	for index, key := range keys {
+		plan, err := s.GetPlanInfo(model.PayPlan(key))
+		if err != nil {
+			return err
+		}
+		plan.Sort = index
+		if err := s.SavePlan(plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidatePlan 校验套餐配置，旧版用量字符串会被转换为结构化权益
+func (s *SetupService) ValidatePlan(plan *model.PlanInfo) error {
+	if !planKeyPattern.MatchString(plan.Plan) {
+		return fmt.Errorf("%w: %s", consts.ErrInvalidPlanKey, plan.Plan)
+	}
+	if _, _, err := parsePeriod(plan.Period); err != nil {
+		return err
+	}
+	plan.Currency = strings.ToUpper(strings.TrimSpace(plan.Currency))
+	if plan.Currency != "" && !currencyPattern.MatchString(plan.Currency) {
+		return fmt.Errorf("%w: %s", consts.ErrInvalidPlanCurrency, plan.Currency)
+	}
+	if err := normalizePlan(plan); err != nil {
+		return err
+	}
+	if plan.Cache != nil && (plan.Cache.Rate < 0 || plan.Cache.Rate > 1) {
+		return fmt.Errorf("%w: cache rate must be between 0 and 1", consts.ErrInvalidEntitlements)
+	}
+
+	ent := plan.Entitlements
+	if ent == nil {
+		return fmt.Errorf("%w: entitlements required", consts.ErrInvalidEntitlements)
+	}
+	caps := []struct {
+		name           string
+		daily, monthly float64
+	}{
+		{"tokens", float64(ent.DailyTokens), float64(ent.MonthlyTokens)},
+		{"requests", float64(ent.DailyRequests), float64(ent.MonthlyRequests)},
+		{"projects", float64(ent.DailyProjects), float64(ent.MonthlyProjects)},
+		{"cost", ent.DailyCost, ent.MonthlyCost},
+	}
+	for _, c := range caps {
+		if c.daily < 0 || c.monthly < 0 {
+			return fmt.Errorf("%w: %s must not be negative", consts.ErrInvalidEntitlements, c.name)
+		}
+		if c.daily > 0 && c.monthly > 0 && c.daily > c.monthly {
+			return fmt.Errorf("%w: daily %s exceeds monthly", consts.ErrInvalidEntitlements, c.name)
+		}
+	}
+	if ent.RPM < 0 || ent.TPM < 0 || ent.Concurrency < 0 {
+		return fmt.Errorf("%w: rate limit must not be negative", consts.ErrInvalidEntitlements)
+	}
+	if ent.MaxContext < 0 || ent.MaxTokens < 0 {
+		return fmt.Errorf("%w: context size must not be negative", consts.ErrInvalidEntitlements)
+	}
+
+	var err error
+	if ent.Models, err = cleanPatterns(ent.Models); err != nil {
+		return err
+	}
+	if ent.DenyModels, err = cleanPatterns(ent.DenyModels); err != nil {
+		return err
+	}
+	return nil
+}
+
+// cleanPatterns 去除空白的模型模式并检查通配语法
+func cleanPatterns(patterns []string) ([]string, error) {
+	var result []string
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: invalid model pattern %q", consts.ErrInvalidEntitlements, pattern)
+		}
+		result = append(result, pattern)
+	}
+	return result, nil
+}
+
+// ParsePlanLimit 根据套餐周期和权益生成用户的用量限制
 func (s *SetupService) ParsePlanLimit(plan *model.PlanInfo) (*model.ApiLimit, error) {
-	// plan.period 必须是：
-	// 	7d, 14d, 1m、1y 等
-	// 分别表示：
-	// 	7 天, 14 天, 1 月, 1 年
-	periodPattern := `^\d+[dmy]$`
-	matched, err := regexp.MatchString(periodPattern, plan.Period)
+	days, months, err := parsePeriod(plan.Period)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", consts.ErrPeriodRegexError, err)
+		return nil, err
 	}
-	if !matched {
-		return nil, fmt.Errorf("%w: %s", consts.ErrPlanPeriodFormatError, plan.Period)
+	ent := plan.Entitlements
+	if ent == nil {
+		if ent, err = parseUsage(plan.Usage); err != nil {
+			return nil, err
+		}
 	}
-	limit := &model.ApiLimit{}
 
-	// 解析 period 并转换为 time.Duration
-	periodStr := plan.Period
-	unit := periodStr[len(periodStr)-1:]      // 获取最后一个字符 (d/m/y)
-	numberStr := periodStr[:len(periodStr)-1] // 获取数字部分
-	number, err := strconv.Atoi(numberStr)
+	limit := &model.ApiLimit{
+		ExpireDays: days, ExpireMonths: months,
+		DailyTokens: ent.DailyTokens, MonthlyTokens: ent.MonthlyTokens,
+		DailyRequests: ent.DailyRequests, MonthlyRequests: ent.MonthlyRequests,
+		DailyProjects: ent.DailyProjects, MonthlyProjects: ent.MonthlyProjects,
+		DailyCost: ent.DailyCost, MonthlyCost: ent.MonthlyCost,
+	}
+	// 主要限制方法用于展示，取第一个设置了上限的指标
+	switch {
+	case ent.DailyTokens > 0 || ent.MonthlyTokens > 0:
+		limit.LimitMethod = "tokens"
+	case ent.DailyRequests > 0 || ent.MonthlyRequests > 0:
+		limit.LimitMethod = "requests"
+	case ent.DailyProjects > 0 || ent.MonthlyProjects > 0:
+		limit.LimitMethod = "projects"
+	case ent.DailyCost > 0 || ent.MonthlyCost > 0:
+		limit.LimitMethod = "cost"
+	}
+	return limit, nil
+}
+
+// parsePeriod 解析套餐周期，如 7d、14d、1m、1y，分别表示 7 天、14 天、1 个月、1 年
+func parsePeriod(period string) (days, months int, err error) {
+	matched, err := regexp.MatchString(`^\d+[dmy]$`, period)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", consts.ErrInvalidPeriodNumber, err)
+		return 0, 0, fmt.Errorf("%w: %v", consts.ErrPeriodRegexError, err)
+	}
+	if !matched {
+		return 0, 0, fmt.Errorf("%w: %s", consts.ErrPlanPeriodFormatError, period)
 	}
 
-	// 根据单位转换为 time.Duration
+	unit := period[len(period)-1:]
+	number, err := strconv.Atoi(period[:len(period)-1])
+	if err != nil || number <= 0 {
+		return 0, 0, fmt.Errorf("%w: %s", consts.ErrInvalidPeriodNumber, period)
+	}
 	switch unit {
 	case "d":
-		limit.ExpireDays = number
+		return number, 0, nil
 	case "m":
-		limit.ExpireDays = 30 // 按30天计算
+		return 0, number, nil
 	case "y":
-		limit.ExpireDays = 365 // 按365天计算
-	default:
-		return nil, fmt.Errorf("%w: %s", consts.ErrUnsupportedPeriodUnit, unit)
+		return 0, number * 12, nil
 	}
+	return 0, 0, fmt.Errorf("%w: %s", consts.ErrUnsupportedPeriodUnit, unit)
+}
 
-	// plan.usage 必须是：
-	// 	 1k tokens, 2k requests, 3m projects 等
-	// 分别表示：
-	// 	 1k tokens, 2k API 请求, 3m 项目调用 等
-	usagePattern := `^\d+[km]?\s+(tokens|requests|projects)$`
-	matched, err = regexp.MatchString(usagePattern, plan.Usage)
+// parseUsage 解析旧版用量字符串，如 1k tokens, 2k requests, 3m projects, 99.9 cost
+// 其中 k、m 分别表示千、百万；每日上限按每月的 1/30 计算
+func parseUsage(usage string) (*model.PlanEntitlements, error) {
+	usagePattern := `^\d+(\.\d+)?[km]?\s+(tokens|requests|projects|cost)$`
+	matched, err := regexp.MatchString(usagePattern, usage)
 	if err != nil {
-		return nil, fmt.Errorf("usage regex error: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrUsageRegexError, err)
 	}
 	if !matched {
-		return nil, fmt.Errorf("plan usage format error: %s", plan.Usage)
-	}
-
-	// 解析 usage 字符串
-	usageParts := strings.Fields(plan.Usage) // 按空格分割
-	if len(usageParts) != 2 {
-		return nil, fmt.Errorf("invalid usage format: %s", plan.Usage)
+		return nil, fmt.Errorf("%w: %s", consts.ErrPlanUsageFormatError, usage)
 	}
 
-	numberWithUnit := usageParts[0] // 如: "1k", "2m", "100"
-	usageType := usageParts[1]      // 如: "tokens", "requests", "projects"
-
-	// 解析数量和单位
-	var baseNumber uint64
-	var multiplier uint64 = 1
-
+	usageParts := strings.Fields(usage)
+	numberWithUnit, usageType := usageParts[0], usageParts[1]
+	var multiplier float64 = 1
 	if strings.HasSuffix(numberWithUnit, "k") {
 		multiplier = 1000
 		numberWithUnit = numberWithUnit[:len(numberWithUnit)-1]
@@ -206,41 +337,63 @@ func (s *SetupService) ParsePlanLimit(plan *model.PlanInfo) (*model.ApiLimit, er
 		multiplier = 1000000
 		numberWithUnit = numberWithUnit[:len(numberWithUnit)-1]
 	}
-
-	parsedNumber, err := strconv.ParseUint(numberWithUnit, 10, 64)
+	amount, err := strconv.ParseFloat(numberWithUnit, 64)
 	if err != nil {
-		return nil, fmt.Errorf("invalid usage number: %v", err)
+		return nil, fmt.Errorf("%w: %v", consts.ErrInvalidUsageNumber, err)
 	}
-	baseNumber = parsedNumber * multiplier
+	amount *= multiplier
 
-	// 根据使用类型设置相应的限制
-	// 这里假设按月计算，如果需要按日计算可以除以30
+	ent := &model.PlanEntitlements{}
 	switch usageType {
 	case "tokens":
-		limit.MonthlyTokens = baseNumber
-		limit.DailyTokens = baseNumber / 30
+		ent.MonthlyTokens = uint64(amount)
+		ent.DailyTokens = ent.MonthlyTokens / 30
 	case "requests":
-		limit.MonthlyRequests = baseNumber
-		limit.DailyRequests = baseNumber / 30
+		ent.MonthlyRequests = uint64(amount)
+		ent.DailyRequests = ent.MonthlyRequests / 30
 	case "projects":
-		limit.MonthlyProjects = baseNumber
-		limit.DailyProjects = baseNumber / 30
+		ent.MonthlyProjects = uint64(amount)
+		ent.DailyProjects = ent.MonthlyProjects / 30
+	case "cost":
+		ent.MonthlyCost = amount
+		ent.DailyCost = amount / 30
 	default:
-		return nil, fmt.Errorf("unsupported usage type: %s", usageType)
+		return nil, fmt.Errorf("%w: %s", consts.ErrUnsupportedUsageType, usageType)
 	}
+	return ent, nil
+}
 
-	// 设置限制方法
-	limit.LimitMethod = usageType
-	return limit, nil
+// normalizePlan 将旧版的用量字符串并入结构化权益
+func normalizePlan(plan *model.PlanInfo) error {
+	if plan.Entitlements == nil && plan.Usage != "" {
+		ent, err := parseUsage(plan.Usage)
+		if err != nil {
+			return err
+		}
+		plan.Entitlements = ent
+	}
+	return nil
 }
+
 func (s *SetupService) autoMigration() error {
 	// 自动迁移数据库表
 	err := s.db.AutoMigrate(
 		&model.UserModel{},
 		&model.VerifyModel{},
 		&model.OrderModel{},
+		&model.OrderHistoryModel{},
+		&model.RefundModel{},
 		&model.LlmLogModel{},
 		&model.ConfigModel{},
+		&model.CatalogModel{},
+		&model.PlanChangeModel{},
+		&model.PriceModel{},
+		&model.WalletLedgerModel{},
+		&model.SubscriptionModel{},
+		&model.CouponModel{},
+		&model.CouponRedemptionModel{},
+		&model.PaymentEventModel{},
+		&model.JobRunModel{},
 	)
 	return err
 }
@@ -277,11 +430,14 @@ func (s *SetupService) createDefaultAdmin() error {
 		admin.APIKey = key
 	}
 
-	// build plan limit
-	if limit, err := s.GetPlanLimit(model.PlanSuper); err == nil {
-		admin.ApiLimit, admin.UserPlan = limit, model.PlanSuper
-	} else {
-		log.Println("GetPlanLimit error: ", err)
+	// 管理员使用排序最后（最高级）的套餐
+	if plans := s.GetEnablePlans(); len(plans) > 0 {
+		top := model.PayPlan(plans[len(plans)-1].Plan)
+		if limit, err := s.GetPlanLimit(top); err == nil {
+			admin.ApiLimit, admin.UserPlan = limit, top
+		} else {
+			log.Println("GetPlanLimit error: ", err)
+		}
 	}
 
 	if err := s.db.Create(&admin).Error; err != nil {
@@ -291,10 +447,10 @@ func (s *SetupService) createDefaultAdmin() error {
 }
 
 func (s *SetupService) GetPlanLimit(name model.PayPlan) (*model.ApiLimit, error) {
-	plan := &model.PlanInfo{Plan: string(name)}
-	if err := s.GetAsTarget("plan."+plan.Plan, plan); err != nil {
-		log.Println("[SETUP] GetAsTarget error: ", err.Error())
-		return nil, fmt.Errorf("%w: %s", consts.ErrPlanNotFound, plan.Plan)
+	plan, err := s.GetPlanInfo(name)
+	if err != nil {
+		log.Println("[SETUP] GetPlanInfo error: ", err.Error())
+		return nil, err
 	}
 	if !plan.Enabled {
 		log.Println("[SETUP] GetPlanLimit error: ", "not enabled")
@@ -308,12 +464,36 @@ func (s *SetupService) GetPlanLimit(name model.PayPlan) (*model.ApiLimit, error)
 	}
 }
 
+// GetPlanInfo 获取套餐信息
+func (s *SetupService) GetPlanInfo(name model.PayPlan) (*model.PlanInfo, error) {
+	plan := &model.PlanInfo{Plan: string(name)}
+	if err := s.GetAsTarget("plan."+plan.Plan, plan); err != nil {
+		return nil, fmt.Errorf("%w: %s", consts.ErrPlanNotFound, plan.Plan)
+	}
+	if err := normalizePlan(plan); err != nil {
+		log.Printf("[SETUP] plan %s usage error: %v", plan.Plan, err)
+	}
+	return plan, nil
+}
+
+// basicModels 体验版可用的基础模型
+var basicModels = []string{
+	"gpt-3.5-turbo*", "gpt-4o-mini*", "claude-3-5-haiku*",
+	"qwen-turbo*", "glm-4-flash", "glm-4-air", "deepseek-chat",
+}
+
 func (s *SetupService) GetDefaultPlan() []model.PlanInfo {
 	planInfo := []model.PlanInfo{
 		{
 			Plan: "basic", Name: "体验版",
 			Period: "1d", Usage: "1k tokens",
 			Brief: "适合个人用户和小型项目",
+			Entitlements: &model.PlanEntitlements{
+				DailyTokens: 1000, MonthlyTokens: 1000,
+				RPM: 10, Concurrency: 1, MaxTokens: 1024,
+				// 体验版仅开放基础模型，高级模型需升级套餐
+				Models: basicModels,
+			},
 			Features: []string{
 				"100万 tokens/月",
 				"基础模型访问",
@@ -325,6 +505,9 @@ func (s *SetupService) GetDefaultPlan() []model.PlanInfo {
 			Plan: "extra", Name: "增强版",
 			Period: "1m", Usage: "10k tokens",
 			Price: 99, Brief: "适合中小企业和开发团队",
+			Entitlements: &model.PlanEntitlements{
+				MonthlyTokens: 10000, RPM: 60, Concurrency: 5,
+			},
 			Features: []string{
 				"500万 tokens/月",
 				"所有模型访问",
@@ -337,6 +520,9 @@ func (s *SetupService) GetDefaultPlan() []model.PlanInfo {
 			Plan: "ultra", Name: "专业版",
 			Period: "1m", Usage: "50k tokens",
 			Price: 299, Brief: "适合大型企业和高频使用",
+			Entitlements: &model.PlanEntitlements{
+				MonthlyTokens: 50000, RPM: 300, Concurrency: 20,
+			},
 			Features: []string{
 				"2000万 tokens/月",
 				"所有模型访问",
@@ -349,6 +535,7 @@ func (s *SetupService) GetDefaultPlan() []model.PlanInfo {
 			Plan: "super", Name: "旗舰版",
 			Period: "1m", Usage: "100m tokens",
 			Price: 1999, Brief: "适合超大型企业和极高频使用",
+			Entitlements: &model.PlanEntitlements{MonthlyTokens: 100000000},
 			Features: []string{
 				"无限 tokens",
 				"所有模型访问",
@@ -362,61 +549,28 @@ func (s *SetupService) GetDefaultPlan() []model.PlanInfo {
 	return planInfo
 }
 
-// initDefaultConfigs 初始化默认配置
+// initDefaultConfigs 初始化默认配置，尚未创建任何套餐时写入默认套餐
 func (s *SetupService) initDefaultConfigs() error {
-	var creemConfig = config.GetCreemConfig()
-	var stripeConfig = config.GetStripeConfig()
-	for _, plan := range s.GetDefaultPlan() {
-		var config model.ConfigModel
-		var key = "plan." + plan.Plan
-		var query = s.db.Where("`key` = ?", key)
-		var err = query.First(&config).Error
-		if err != gorm.ErrRecordNotFound {
-			continue
-		}
+	var count int64
+	if err := s.db.Model(&model.ConfigModel{}).
+		Where("kind = ?", "plan").Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
 
-		plan.Enabled = true
-		config.Key, config.Kind = key, "plan"
+	for index, plan := range s.GetDefaultPlan() {
+		plan.Enabled, plan.Sort = true, index
+		var config = model.ConfigModel{Key: "plan." + plan.Plan, Kind: "plan"}
 		if data, err := json.Marshal(plan); err != nil {
 			continue
 		} else {
 			config.Data = string(data)
 		}
-		s.setPlanByCreem(&plan, creemConfig)
-		s.setPlanByStripe(&plan, stripeConfig)
 		if err := s.db.Create(&config).Error; err != nil {
 			return fmt.Errorf("failed to create config %s: %v", config.Key, err)
 		}
 	}
 	return nil
 }
-func (s *SetupService) setPlanByCreem(plan *model.PlanInfo, cfg *config.Creem) {
-	if cfg == nil {
-		return
-	}
-	switch plan.Plan {
-	case "basic":
-		plan.Enabled = cfg.PlanBasicId != ""
-	case "extra":
-		plan.Enabled = cfg.PlanExtraId != ""
-	case "ultra":
-		plan.Enabled = cfg.PlanUltraId != ""
-	case "super":
-		plan.Enabled = cfg.PlanSuperId != ""
-	}
-}
-func (s *SetupService) setPlanByStripe(plan *model.PlanInfo, cfg *config.Stripe) {
-	if cfg == nil {
-		return
-	}
-	switch plan.Plan {
-	case "basic":
-		plan.Enabled = cfg.PlanBasicId != ""
-	case "extra":
-		plan.Enabled = cfg.PlanExtraId != ""
-	case "ultra":
-		plan.Enabled = cfg.PlanUltraId != ""
-	case "super":
-		plan.Enabled = cfg.PlanSuperId != ""
-	}
-}
@@ -85,8 +85,9 @@ func (s *StatsService) getAPIStats(stats *model.StatsResponse) error {
 		stats.SuccessRate = float64(successCount) / float64(stats.TotalRequests) * 100
 	}
 
-	// 今日请求数
-	today := time.Now().Truncate(24 * time.Hour)
+	// 今日请求数（配置时区的零点）
+	local := now.In(config.GetTimezone())
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
 	s.db.Model(&model.LlmLogModel{}).Where("req_time >= ?", today).Count(&stats.RequestsToday)
 
 	// 本周请求数
@@ -130,14 +131,14 @@ func (s *StatsService) getMemberStats(stats *model.StatsResponse) error {
 	s.db.Model(&model.UserModel{}).Count(&stats.TotalMembers)
 
 	// 付费会员数（非basic套餐的用户）
-	s.db.Model(&model.UserModel{}).Where("user_plan != ?", "basic").Count(&stats.PaidMembers)
+	s.db.Model(&model.UserModel{}).Where("user_plan != ?", config.GetDefaultPlan()).Count(&stats.PaidMembers)
 
 	// 本月新增会员数
 	monthStart := time.Date(time.Now().Year(), time.Now().Month(), 1, 0, 0, 0, 0, time.Local)
 	s.db.Model(&model.UserModel{}).Where("created_at >= ?", monthStart).Count(&stats.MonthlyNewMembers)
 
 	// 本月新增付费会员数
-	s.db.Model(&model.UserModel{}).Where("created_at >= ? AND user_plan != ?", monthStart, "basic").Count(&stats.MonthlyNewPaidMembers)
+	s.db.Model(&model.UserModel{}).Where("created_at >= ? AND user_plan != ?", monthStart, config.GetDefaultPlan()).Count(&stats.MonthlyNewPaidMembers)
 
 	return nil
 }
@@ -174,78 +175,3 @@ func (s *StatsService) getOrderStats(stats *model.StatsResponse) error {
 
 	return nil
 }
-
-// UpdateUserStats 更新用户统计信息
-func (s *StatsService) UpdateUserStats(user *model.UserModel) error {
-	// 获取当前时间信息
-	today := time.Now().Truncate(24 * time.Hour)
-	monthStart := time.Date(
-		time.Now().Year(), time.Now().Month(),
-		1, 0, 0, 0, 0, time.Now().Location(),
-	)
-
-	// 初始化 ApiUsage 结构
-	var apiUsage = model.ApiUsage{}
-
-	// 统计总的使用量（所有时间）- 一次查询获取三个数据
-	var totalStats struct {
-		TotalTokens   uint64
-		TotalRequests uint64
-		TotalProjects uint64
-	}
-
-	// 使用子查询一次性获取总统计数据
-	allAgg := `
-		COUNT(*) as TotalRequests,
-		COALESCE(SUM(CAST(JSON_EXTRACT(all_usage, '$.totalTokens') AS SIGNED)), 0) as TotalTokens,
-		(
-			SELECT COUNT(DISTINCT proj_id) FROM llm_log 
-			WHERE status = 'success' AND user_id = ? AND req_time >= ?
-		) as TotalProjects
-	`
-	result := s.db.Model(&model.LlmLogModel{}).
-		Where("status = ? AND user_id = ? AND req_time >= ?", "success", user.ID, monthStart).
-		Select(allAgg, user.ID, monthStart).Scan(&totalStats)
-	if result.Error != nil {
-		return result.Error
-	}
-
-	// 统计时间范围内的使用量
-	var periodStats struct {
-		PeriodRequests uint64
-		PeriodTokens   uint64
-		PeriodProjects uint64
-	}
-
-	// 使用子查询一次性获取时间段统计数据
-	periodAgg := `
-		COUNT(*) as PeriodRequests,
-		COALESCE(SUM(CAST(JSON_EXTRACT(all_usage, '$.totalTokens') AS SIGNED)), 0) as PeriodTokens,
-		(
-			SELECT COUNT(DISTINCT proj_id)  FROM llm_log
-			WHERE status = 'success' AND user_id = ? AND req_time >= ?
-		) as PeriodProjects
-	`
-	result = s.db.Model(&model.LlmLogModel{}).
-		Where("status = 'success' AND user_id = ? AND req_time >= ?", user.ID, today).
-		Select(periodAgg, user.ID, today).Scan(&periodStats)
-
-	if result.Error != nil {
-		return result.Error
-	}
-
-	// 赋值总统计数据
-	apiUsage.TotalTokens = totalStats.TotalTokens
-	apiUsage.TotalRequests = totalStats.TotalRequests
-	apiUsage.TotalProjects = totalStats.TotalProjects
-
-	// 赋值时间段统计数据（今日数据）
-	apiUsage.TodayTokens = periodStats.PeriodTokens
-	apiUsage.TodayRequests = periodStats.PeriodRequests
-	apiUsage.TodayProjects = periodStats.PeriodProjects
-
-	// 构建更新数据
-	var query = s.db.Model(&model.UserModel{})
-	var data = map[string]any{"api_usage": apiUsage}
-	return query.Where("id = ?", user.ID).Updates(data).Error
-}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+	"llm-member/internal/payment"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SubscriptionService struct {
+	db *gorm.DB
+
+	planService  *PlanService
+	setupService *SetupService
+}
+
+func NewSubscriptionService() *SubscriptionService {
+	return &SubscriptionService{
+		db: config.GetDB(), planService: NewPlanService(),
+		setupService: NewSetupService(),
+	}
+}
+
+// GetUserSubscriptions 获取用户的订阅列表
+func (s *SubscriptionService) GetUserSubscriptions(userID uint64) ([]model.SubscriptionModel, error) {
+	var subs []model.SubscriptionModel
+	err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&subs).Error
+	return subs, err
+}
+
+// Cancel 取消用户订阅，已付费周期结束后不再续费
+func (s *SubscriptionService) Cancel(userID, id uint64) (*model.SubscriptionModel, error) {
+	var sub model.SubscriptionModel
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&sub).Error; err != nil {
+		return nil, consts.ErrSubscriptionNotFound
+	}
+	if sub.Status == model.SubscriptionCanceled || sub.CancelAtPeriodEnd {
+		return &sub, nil
+	}
+
+	provider, ok := payment.NewPayment(sub.Method).(payment.ISubscription)
+	if !ok {
+		return nil, consts.ErrSubscriptionNotSupported
+	}
+	if err := provider.CancelSubscription(&sub); err != nil {
+		return nil, err
+	}
+
+	sub.CancelAtPeriodEnd = true
+	if err := s.db.Model(&sub).Update("cancel_at_period_end", true).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Sync 根据支付回调同步订阅状态：续费成功时延长套餐有效期，订阅终止时收回套餐
+func (s *SubscriptionService) Sync(method model.PaymentMethod, event *payment.Event) error {
+	info := event.Subscription
+	if info == nil || info.ID == "" {
+		return consts.ErrPaymentWebhookMissingParams
+	}
+	sub, err := s.bind(method, event)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]any{}
+	if info.Customer != "" {
+		updates["customer"] = info.Customer
+	}
+	if info.PeriodStart > 0 {
+		start := time.Unix(info.PeriodStart, 0)
+		updates["current_period_start"], sub.CurrentPeriodStart = start, &start
+	}
+	if info.PeriodEnd > 0 {
+		end := time.Unix(info.PeriodEnd, 0)
+		updates["current_period_end"], sub.CurrentPeriodEnd = end, &end
+	}
+	switch event.Type {
+	case payment.EventSubscriptionRenewed:
+		sub.Status = model.SubscriptionActive
+	case payment.EventSubscriptionUpdated, payment.EventSubscriptionCanceled:
+		sub.Status = model.SubscriptionStatus(info.Status)
+		updates["cancel_at_period_end"] = info.CancelAtPeriodEnd
+	}
+	updates["status"] = sub.Status
+	if sub.Status == model.SubscriptionCanceled && sub.CanceledAt == nil {
+		now := time.Now()
+		updates["canceled_at"], sub.CanceledAt = now, &now
+	}
+	if err := s.db.Model(sub).Updates(updates).Error; err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrUserPlanUpdateFailed, err)
+	}
+
+	switch {
+	case event.Type == payment.EventSubscriptionRenewed:
+		return s.renew(sub)
+	case sub.Status == model.SubscriptionCanceled:
+		return s.lapse(sub)
+	}
+	return nil
+}
+
+// bind 查找订阅记录，首次回调时根据订单创建
+func (s *SubscriptionService) bind(method model.PaymentMethod, event *payment.Event) (*model.SubscriptionModel, error) {
+	var sub model.SubscriptionModel
+	// 只关联本渠道的订阅和订单，防止一个渠道的回调变更其他渠道的订阅
+	err := s.db.Where("method = ? AND thrid_id = ?", method, event.Subscription.ID).First(&sub).Error
+	if err == nil {
+		return &sub, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) || event.OrderID == "" {
+		return nil, consts.ErrSubscriptionNotFound
+	}
+
+	var order model.OrderModel
+	if err := s.db.Where("order_id = ? AND method = ?", event.OrderID, method).First(&order).Error; err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrOrderQueryFailed, err)
+	}
+	sub = model.SubscriptionModel{
+		UserID: order.UserID, OrderID: order.OrderID,
+		ThridID: event.Subscription.ID, PayPlan: order.PayPlan,
+		Method: method, Status: model.SubscriptionActive,
+	}
+	// 结账完成与首期账单回调可能并发到达，以第三方订阅ID去重
+	err = s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&sub).Error
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Where("method = ? AND thrid_id = ?", method, sub.ThridID).First(&sub).Error
+	return &sub, err
+}
+
+// renew 续费成功：有效期延长到当前周期结束，套餐已被回收时重新开通
+func (s *SubscriptionService) renew(sub *model.SubscriptionModel) error {
+	limit, err := s.setupService.GetPlanLimit(sub.PayPlan)
+	if err != nil {
+		return err
+	}
+	var user model.UserModel
+	if err := s.db.First(&user, sub.UserID).Error; err != nil {
+		return consts.ErrUserNotFound
+	}
+
+	expire := periodEnd(limit, time.Now())
+	if sub.CurrentPeriodEnd != nil {
+		expire = *sub.CurrentPeriodEnd
+	}
+
+	if user.UserPlan == sub.PayPlan {
+		if user.ExpireAt != nil && !user.ExpireAt.Before(expire) {
+			return nil // 重复回调
+		}
+		return s.db.Model(&user).Update("expire_at", expire).Error
+	}
+
+	change := &model.PlanChangeModel{
+		UserID: user.ID, Reason: "subscription", OrderID: sub.OrderID,
+		FromPlan: user.UserPlan, FromLimit: user.ApiLimit, FromExpire: user.ExpireAt,
+		ToPlan: sub.PayPlan, ToLimit: limit, ToExpire: &expire,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]any{
+			"user_plan": sub.PayPlan, "api_limit": limit, "expire_at": expire,
+			"cycle_anchor": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", consts.ErrUserPlanUpdateFailed, err)
+	}
+	log.Printf("[SUBSCRIPTION] user %d restored to plan %s until %s", user.ID, sub.PayPlan, expire)
+	return nil
+}
+
+// lapse 订阅终止：已付费周期内保留权益，由过期检查到期后降级，否则立即降级
+func (s *SubscriptionService) lapse(sub *model.SubscriptionModel) error {
+	var user model.UserModel
+	if err := s.db.First(&user, sub.UserID).Error; err != nil {
+		return consts.ErrUserNotFound
+	}
+	if user.UserPlan != sub.PayPlan {
+		return nil // 用户已更换套餐
+	}
+
+	if end := sub.CurrentPeriodEnd; end != nil && end.After(time.Now()) {
+		if user.ExpireAt != nil && !user.ExpireAt.After(*end) {
+			return nil
+		}
+		return s.db.Model(&user).Update("expire_at", *end).Error
+	}
+	return s.planService.Downgrade(&user, "subscription_canceled")
+}
@@ -5,6 +5,7 @@ import (
 	"llm-member/internal/consts"
 	"llm-member/internal/model"
 	"sync"
+	"time"
 
 	"github.com/tiktoken-go/tokenizer"
 	"github.com/tiktoken-go/tokenizer/codec"
@@ -30,30 +31,47 @@ func (ts *TokenService) CheckUsage(user *model.UserModel) error {
 		return nil
 	}
 
-	usage, limit := user.ApiUsage, user.ApiLimit
-	switch limit.LimitMethod {
-	case "tokens":
-		if usage.TodayTokens >= limit.DailyTokens {
-			return fmt.Errorf("%w (%d/%d)", consts.ErrDailyTokenLimitReached, usage.TodayTokens, limit.DailyTokens)
-		}
-		if usage.TotalTokens >= limit.MonthlyTokens {
-			return fmt.Errorf("%w (%d/%d)", consts.ErrMonthlyTokenLimitReached, usage.TotalTokens, limit.MonthlyTokens)
-		}
-	case "requests":
-		if usage.TodayRequests >= limit.DailyRequests {
-			return fmt.Errorf("%w (%d/%d)", consts.ErrDailyRequestLimitReached, usage.TodayRequests, limit.DailyRequests)
-		}
-		if usage.TotalRequests >= limit.MonthlyRequests {
-			return fmt.Errorf("%w (%d/%d)", consts.ErrMonthlyRequestLimitReached, usage.TotalRequests, limit.MonthlyRequests)
-		}
-	case "projects":
-		if usage.TodayProjects >= limit.DailyProjects {
-			return fmt.Errorf("%w (%d/%d)", consts.ErrDailyProjectLimitReached, usage.TodayProjects, limit.DailyProjects)
-		}
-		if usage.TotalProjects >= limit.MonthlyProjects {
-			return fmt.Errorf("%w (%d/%d)", consts.ErrMonthlyProjectLimitReached, usage.TotalProjects, limit.MonthlyProjects)
+	// 每项上限独立生效，0 表示不限制
+	usage, limit := CurrentUsage(user, time.Now()), user.ApiLimit
+	switch {
+	case limit.DailyTokens > 0 && usage.TodayTokens >= limit.DailyTokens:
+		return fmt.Errorf("%w (%d/%d)", consts.ErrDailyTokenLimitReached, usage.TodayTokens, limit.DailyTokens)
+	case limit.MonthlyTokens > 0 && usage.TotalTokens >= limit.MonthlyTokens:
+		return fmt.Errorf("%w (%d/%d)", consts.ErrMonthlyTokenLimitReached, usage.TotalTokens, limit.MonthlyTokens)
+	case limit.DailyRequests > 0 && usage.TodayRequests >= limit.DailyRequests:
+		return fmt.Errorf("%w (%d/%d)", consts.ErrDailyRequestLimitReached, usage.TodayRequests, limit.DailyRequests)
+	case limit.MonthlyRequests > 0 && usage.TotalRequests >= limit.MonthlyRequests:
+		return fmt.Errorf("%w (%d/%d)", consts.ErrMonthlyRequestLimitReached, usage.TotalRequests, limit.MonthlyRequests)
+	case limit.DailyProjects > 0 && usage.TodayProjects >= limit.DailyProjects:
+		return fmt.Errorf("%w (%d/%d)", consts.ErrDailyProjectLimitReached, usage.TodayProjects, limit.DailyProjects)
+	case limit.MonthlyProjects > 0 && usage.TotalProjects >= limit.MonthlyProjects:
+		return fmt.Errorf("%w (%d/%d)", consts.ErrMonthlyProjectLimitReached, usage.TotalProjects, limit.MonthlyProjects)
+	case limit.DailyCost > 0 && usage.TodayCost >= limit.DailyCost:
+		return fmt.Errorf("%w (%.4f/%.4f)", consts.ErrDailyCostLimitReached, usage.TodayCost, limit.DailyCost)
+	case limit.MonthlyCost > 0 && usage.TotalCost >= limit.MonthlyCost:
+		return fmt.Errorf("%w (%.4f/%.4f)", consts.ErrMonthlyCostLimitReached, usage.TotalCost, limit.MonthlyCost)
+	}
+	return nil
+}
+
+// CheckEntitlements 按套餐权益检查请求：功能是否开启、上下文是否超限，并将 max_tokens 收紧到套餐上限
+func (ts *TokenService) CheckEntitlements(ent *model.PlanEntitlements, req *model.ChatRequest) error {
+	if ent == nil {
+		return nil
+	}
+	if req.Stream && !ent.HasFlag(model.FlagStream) {
+		return consts.ErrStreamNotAllowed
+	}
+	if ent.MaxContext > 0 {
+		prompt, _ := ts.CountMsgsToken(req.Messages, req.Model, req.Stream)
+		if prompt > ent.MaxContext {
+			return fmt.Errorf("%w (%d/%d)", consts.ErrContextTooLong, prompt, ent.MaxContext)
 		}
 	}
+	if ent.MaxTokens > 0 && (req.MaxTokens == nil || *req.MaxTokens <= 0 || *req.MaxTokens > ent.MaxTokens) {
+		maxTokens := ent.MaxTokens
+		req.MaxTokens = &maxTokens
+	}
 	return nil
 }
 
@@ -0,0 +1,492 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"llm-member/internal/config"
+	"llm-member/internal/model"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// recordScript 原子累加日窗口和周期窗口的计数，并标记用户待回写
+// KEYS: 日计数, 周期计数, 日项目集合, 周期项目集合, 待回写集合
+// ARGV: tokens, requests, cost, 项目ID, 用户ID, 日窗口过期时间, 周期窗口过期时间
+var recordScript = redis.NewScript(`
+for i = 1, 2 do
+	redis.call('HINCRBY', KEYS[i], 'tokens', ARGV[1])
+	redis.call('HINCRBY', KEYS[i], 'requests', ARGV[2])
+	redis.call('HINCRBYFLOAT', KEYS[i], 'cost', ARGV[3])
+	if ARGV[4] ~= '' then
+		redis.call('SADD', KEYS[i + 2], ARGV[4])
+	end
+	redis.call('EXPIREAT', KEYS[i], ARGV[5 + i])
+	redis.call('EXPIREAT', KEYS[i + 2], ARGV[5 + i])
+end
+redis.call('SADD', KEYS[5], ARGV[5])
+return 1
+`)
+
+const usageDirtyKey = "usage:dirty"
+
+// usageCounter 单个窗口的用量计数
+type usageCounter struct {
+	Tokens   uint64
+	Requests uint64
+	Cost     float64
+	Projects map[string]struct{}
+
+	expireAt time.Time
+}
+
+// memoryUsage 无 Redis 时使用的进程内计数
+var memoryUsage = struct {
+	sync.Mutex
+	counters map[string]*usageCounter
+	dirty    map[uint64]struct{}
+}{
+	counters: make(map[string]*usageCounter),
+	dirty:    make(map[uint64]struct{}),
+}
+
+type UsageService struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewUsageService() *UsageService {
+	return &UsageService{db: config.GetDB(), redis: config.GetRedis()}
+}
+
+// Record 请求日志写入后累加用量计数
+// 缓存命中只计折算后的 Token 和费用，不计请求数和项目数
+func (s *UsageService) Record(user *model.UserModel, entry *model.LlmLogModel) {
+	if entry.Status != "success" && entry.Status != "cached" {
+		return
+	}
+	counter := usageCounter{Cost: entry.Cost}
+	switch usage := entry.AllUsage.(type) {
+	case model.Usage:
+		counter.Tokens = uint64(max(usage.TotalTokens, 0))
+	case *model.Usage:
+		counter.Tokens = uint64(max(usage.TotalTokens, 0))
+	}
+	var project string
+	if entry.Status == "success" {
+		counter.Requests, project = 1, entry.ProjID
+	}
+
+	window := GetUsageWindow(user, entry.ReqTime)
+	if s.redis != nil {
+		err := s.recordRedis(user, window, counter, project)
+		if err == nil {
+			s.recover(user, window)
+			return
+		}
+		// Redis 不可用时改用进程内计数，恢复后由对账任务按日志重建
+		log.Printf("[USAGE] record user %d in redis failed, fallback to memory: %v", user.ID, err)
+	}
+	s.recordMemory(user, window, counter, project)
+}
+
+// recordRedis 在 Redis 中累加计数，窗口计数不存在时从日志重建，重建结果已包含本次请求
+func (s *UsageService) recordRedis(user *model.UserModel, window model.UsageWindow, counter usageCounter, project string) error {
+	dayKey, cycleKey := s.keys(user.ID, window)
+	seeded, err := s.redisSeeded(dayKey, cycleKey)
+	if err != nil {
+		return err
+	}
+	if !seeded {
+		return s.seedRedis(user, window)
+	}
+
+	keys := []string{dayKey, cycleKey, dayKey + ":proj", cycleKey + ":proj", usageDirtyKey}
+	dayExpire, cycleExpire := s.expireAt(window)
+	return recordScript.Run(
+		context.Background(), s.redis, keys,
+		counter.Tokens, counter.Requests, counter.Cost, project, user.ID,
+		dayExpire.Unix(), cycleExpire.Unix(),
+	).Err()
+}
+
+// recordMemory 在进程内累加计数，窗口计数不存在时从日志重建，重建结果已包含本次请求
+func (s *UsageService) recordMemory(user *model.UserModel, window model.UsageWindow, counter usageCounter, project string) {
+	dayKey, cycleKey := s.keys(user.ID, window)
+	if !s.memorySeeded(dayKey, cycleKey) {
+		if err := s.seedMemory(user, window); err != nil {
+			log.Printf("[USAGE] seed user %d failed: %v", user.ID, err)
+		}
+		return
+	}
+
+	memoryUsage.Lock()
+	defer memoryUsage.Unlock()
+	for _, key := range []string{dayKey, cycleKey} {
+		c := memoryUsage.counters[key]
+		c.Tokens += counter.Tokens
+		c.Requests += counter.Requests
+		c.Cost += counter.Cost
+		if project != "" {
+			c.Projects[project] = struct{}{}
+		}
+	}
+	memoryUsage.dirty[user.ID] = struct{}{}
+}
+
+// Snapshot 读取用户当前窗口的实时用量
+// Redis 不可用时改用进程内计数，日志也无法统计时按用户表中的用量并重置已结束的窗口
+func (s *UsageService) Snapshot(user *model.UserModel) *model.ApiUsage {
+	now := time.Now()
+	window := GetUsageWindow(user, now)
+	if s.redis != nil {
+		day, cycle, err := s.snapshotRedis(user, window)
+		if err == nil {
+			if s.recover(user, window) {
+				day, cycle, err = s.snapshotRedis(user, window)
+			}
+		}
+		if err == nil {
+			return s.usage(window, day, cycle)
+		}
+		log.Printf("[USAGE] snapshot user %d from redis failed, fallback to memory: %v", user.ID, err)
+	}
+
+	dayKey, cycleKey := s.keys(user.ID, window)
+	if !s.memorySeeded(dayKey, cycleKey) {
+		if err := s.seedMemory(user, window); err != nil {
+			log.Printf("[USAGE] seed user %d failed: %v", user.ID, err)
+			usage := CurrentUsage(user, now)
+			return &usage
+		}
+	}
+	return s.usage(window, s.loadMemory(dayKey), s.loadMemory(cycleKey))
+}
+
+// snapshotRedis 从 Redis 读取日窗口和周期窗口的计数，不存在时先从日志重建
+func (s *UsageService) snapshotRedis(user *model.UserModel, window model.UsageWindow) (usageCounter, usageCounter, error) {
+	dayKey, cycleKey := s.keys(user.ID, window)
+	seeded, err := s.redisSeeded(dayKey, cycleKey)
+	if err == nil && !seeded {
+		err = s.seedRedis(user, window)
+	}
+	if err != nil {
+		return usageCounter{}, usageCounter{}, err
+	}
+	day, err := s.loadRedis(dayKey)
+	if err != nil {
+		return usageCounter{}, usageCounter{}, err
+	}
+	cycle, err := s.loadRedis(cycleKey)
+	return day, cycle, err
+}
+
+// recover 曾降级为进程内计数的用户，Redis 恢复后按日志重建计数并丢弃进程内计数，返回是否已重建
+func (s *UsageService) recover(user *model.UserModel, window model.UsageWindow) bool {
+	dayKey, cycleKey := s.keys(user.ID, window)
+	memoryUsage.Lock()
+	_, day := memoryUsage.counters[dayKey]
+	_, cycle := memoryUsage.counters[cycleKey]
+	memoryUsage.Unlock()
+	if !day && !cycle {
+		return false
+	}
+
+	if err := s.seedRedis(user, window); err != nil {
+		log.Printf("[USAGE] reseed user %d in redis failed: %v", user.ID, err)
+		return false
+	}
+	memoryUsage.Lock()
+	delete(memoryUsage.counters, dayKey)
+	delete(memoryUsage.counters, cycleKey)
+	memoryUsage.Unlock()
+	return true
+}
+
+func (s *UsageService) usage(window model.UsageWindow, day, cycle usageCounter) *model.ApiUsage {
+	return &model.ApiUsage{
+		TotalTokens: cycle.Tokens, TotalRequests: cycle.Requests,
+		TotalProjects: uint64(len(cycle.Projects)), TotalCost: cycle.Cost,
+		TodayTokens: day.Tokens, TodayRequests: day.Requests,
+		TodayProjects: uint64(len(day.Projects)), TodayCost: day.Cost,
+		DayStart: &window.DayStart, CycleStart: &window.CycleStart,
+		CycleEnd: &window.CycleEnd,
+	}
+}
+
+// Flush 将有新用量的用户计数回写到用户表
+func (s *UsageService) Flush() (int, error) {
+	// 取出 Redis 记录失败时仍回写已取出的进程内记录
+	userIDs, err := s.popDirty()
+
+	count := 0
+	for _, id := range userIDs {
+		var user model.UserModel
+		if err := s.db.First(&user, id).Error; err != nil {
+			continue
+		}
+		if err := s.save(&user, s.Snapshot(&user)); err != nil {
+			log.Printf("[USAGE] flush user %d failed: %v", id, err)
+			continue
+		}
+		count++
+	}
+	return count, err
+}
+
+// Reconcile 按请求日志重建用户当前窗口的计数并回写用户表
+func (s *UsageService) Reconcile(user *model.UserModel) error {
+	window := GetUsageWindow(user, time.Now())
+	if err := s.seed(user, window); err != nil {
+		return err
+	}
+	return s.save(user, s.Snapshot(user))
+}
+
+// ReconcileAll 重建最近有请求的用户的计数，返回处理的用户数
+func (s *UsageService) ReconcileAll() (int, error) {
+	var userIDs []uint64
+	// 计费周期最长为一个月，更早的日志不影响当前窗口
+	since := time.Now().AddDate(0, -1, -1)
+	err := s.db.Model(&model.LlmLogModel{}).Where("req_time >= ?", since).
+		Distinct("user_id").Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range userIDs {
+		var user model.UserModel
+		if err := s.db.First(&user, id).Error; err != nil {
+			continue
+		}
+		if err := s.Reconcile(&user); err != nil {
+			log.Printf("[USAGE] reconcile user %d failed: %v", id, err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// StartJobs 注册计数回写和对账任务
+func (s *UsageService) StartJobs(flushInterval, reconcileInterval time.Duration) {
+	jobs := NewJobService()
+	jobs.Register("usage-flush", flushInterval, func() (int, int, error) {
+		count, err := s.Flush()
+		return count, 0, err
+	})
+	jobs.Register("usage-reconcile", reconcileInterval, func() (int, int, error) {
+		count, err := s.ReconcileAll()
+		return count, 0, err
+	})
+}
+
+// aggregate 从请求日志统计指定时间之后的用量
+func (s *UsageService) aggregate(userID uint64, since time.Time) (*usageCounter, error) {
+	var stats struct {
+		Tokens   uint64
+		Requests uint64
+		Cost     float64
+	}
+	agg := `
+		COALESCE(SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END), 0) as Requests,
+		COALESCE(SUM(CAST(JSON_EXTRACT(all_usage, '$.totalTokens') AS SIGNED)), 0) as Tokens,
+		COALESCE(SUM(cost), 0) as Cost
+	`
+	err := s.db.Model(&model.LlmLogModel{}).
+		Where("status IN ? AND user_id = ? AND req_time >= ?", []string{"success", "cached"}, userID, since).
+		Select(agg).Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []string
+	err = s.db.Model(&model.LlmLogModel{}).
+		Where("status = ? AND user_id = ? AND req_time >= ? AND proj_id <> ''", "success", userID, since).
+		Distinct("proj_id").Pluck("proj_id", &projects).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counter := &usageCounter{
+		Tokens: stats.Tokens, Requests: stats.Requests, Cost: stats.Cost,
+		Projects: make(map[string]struct{}, len(projects)),
+	}
+	for _, project := range projects {
+		counter.Projects[project] = struct{}{}
+	}
+	return counter, nil
+}
+
+// seed 用日志统计结果覆盖当前窗口的计数
+func (s *UsageService) seed(user *model.UserModel, window model.UsageWindow) error {
+	if s.redis == nil {
+		return s.seedMemory(user, window)
+	}
+	return s.seedRedis(user, window)
+}
+
+// aggregateWindow 从请求日志统计日窗口和周期窗口的用量
+func (s *UsageService) aggregateWindow(userID uint64, window model.UsageWindow) (*usageCounter, *usageCounter, error) {
+	day, err := s.aggregate(userID, window.DayStart)
+	if err != nil {
+		return nil, nil, err
+	}
+	cycle, err := s.aggregate(userID, window.CycleStart)
+	if err != nil {
+		return nil, nil, err
+	}
+	day.expireAt, cycle.expireAt = s.expireAt(window)
+	return day, cycle, nil
+}
+
+func (s *UsageService) seedMemory(user *model.UserModel, window model.UsageWindow) error {
+	day, cycle, err := s.aggregateWindow(user.ID, window)
+	if err != nil {
+		return err
+	}
+
+	dayKey, cycleKey := s.keys(user.ID, window)
+	memoryUsage.Lock()
+	defer memoryUsage.Unlock()
+	// 顺带清理已过期的窗口
+	now := time.Now()
+	for key, counter := range memoryUsage.counters {
+		if now.After(counter.expireAt) {
+			delete(memoryUsage.counters, key)
+		}
+	}
+	memoryUsage.counters[dayKey], memoryUsage.counters[cycleKey] = day, cycle
+	memoryUsage.dirty[user.ID] = struct{}{}
+	return nil
+}
+
+func (s *UsageService) seedRedis(user *model.UserModel, window model.UsageWindow) error {
+	day, cycle, err := s.aggregateWindow(user.ID, window)
+	if err != nil {
+		return err
+	}
+
+	dayKey, cycleKey := s.keys(user.ID, window)
+	ctx := context.Background()
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, counter := range map[string]*usageCounter{dayKey: day, cycleKey: cycle} {
+			pipe.Del(ctx, key, key+":proj")
+			pipe.HSet(ctx, key, "tokens", counter.Tokens, "requests", counter.Requests,
+				"cost", counter.Cost, "seeded", 1)
+			pipe.ExpireAt(ctx, key, counter.expireAt)
+			if len(counter.Projects) > 0 {
+				members := make([]any, 0, len(counter.Projects))
+				for project := range counter.Projects {
+					members = append(members, project)
+				}
+				pipe.SAdd(ctx, key+":proj", members...)
+				pipe.ExpireAt(ctx, key+":proj", counter.expireAt)
+			}
+		}
+		pipe.SAdd(ctx, usageDirtyKey, user.ID)
+		return nil
+	})
+	return err
+}
+
+// memorySeeded 进程内窗口计数是否已初始化
+func (s *UsageService) memorySeeded(keys ...string) bool {
+	memoryUsage.Lock()
+	defer memoryUsage.Unlock()
+	for _, key := range keys {
+		if _, ok := memoryUsage.counters[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// redisSeeded Redis 中的窗口计数是否已初始化
+func (s *UsageService) redisSeeded(keys ...string) (bool, error) {
+	for _, key := range keys {
+		ok, err := s.redis.HExists(context.Background(), key, "seeded").Result()
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// loadMemory 读取进程内的窗口计数
+func (s *UsageService) loadMemory(key string) usageCounter {
+	memoryUsage.Lock()
+	defer memoryUsage.Unlock()
+	if counter, ok := memoryUsage.counters[key]; ok {
+		return *counter
+	}
+	return usageCounter{}
+}
+
+// loadRedis 读取 Redis 中的窗口计数
+func (s *UsageService) loadRedis(key string) (usageCounter, error) {
+	ctx := context.Background()
+	values, err := s.redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return usageCounter{}, err
+	}
+	projects, err := s.redis.SMembers(ctx, key+":proj").Result()
+	if err != nil {
+		return usageCounter{}, err
+	}
+	counter := usageCounter{Projects: make(map[string]struct{}, len(projects))}
+	counter.Tokens, _ = strconv.ParseUint(values["tokens"], 10, 64)
+	counter.Requests, _ = strconv.ParseUint(values["requests"], 10, 64)
+	counter.Cost, _ = strconv.ParseFloat(values["cost"], 64)
+	for _, project := range projects {
+		counter.Projects[project] = struct{}{}
+	}
+	return counter, nil
+}
+
+// popDirty 取出待回写的用户，包含 Redis 不可用期间进程内记录的用户
+func (s *UsageService) popDirty() ([]uint64, error) {
+	memoryUsage.Lock()
+	userIDs := make([]uint64, 0, len(memoryUsage.dirty))
+	for id := range memoryUsage.dirty {
+		userIDs = append(userIDs, id)
+	}
+	memoryUsage.dirty = make(map[uint64]struct{})
+	memoryUsage.Unlock()
+	if s.redis == nil {
+		return userIDs, nil
+	}
+
+	members, err := s.redis.SPopN(context.Background(), usageDirtyKey, 1000).Result()
+	if err != nil && err != redis.Nil {
+		return userIDs, err
+	}
+	for _, member := range members {
+		if id, err := strconv.ParseUint(member, 10, 64); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	return userIDs, nil
+}
+
+func (s *UsageService) save(user *model.UserModel, usage *model.ApiUsage) error {
+	user.ApiUsage = usage
+	var data = map[string]any{"api_usage": usage}
+	return s.db.Model(&model.UserModel{}).Where("id = ?", user.ID).Updates(data).Error
+}
+
+func (s *UsageService) keys(userID uint64, window model.UsageWindow) (string, string) {
+	return fmt.Sprintf("usage:day:%d:%d", userID, window.DayStart.Unix()),
+		fmt.Sprintf("usage:cycle:%d:%d", userID, window.CycleStart.Unix())
+}
+
+// expireAt 窗口结束后再保留一天，便于对账
+func (s *UsageService) expireAt(window model.UsageWindow) (time.Time, time.Time) {
+	return window.DayStart.AddDate(0, 0, 2), window.CycleEnd.AddDate(0, 0, 1)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"time"
 
 	"llm-member/internal/config"
 	"llm-member/internal/consts"
@@ -89,8 +90,27 @@ func (s *UserService) UpdateUser(req *model.UpdateUserRequest) (*model.UserModel
 		user.IsActive = *req.IsActive
 	}
 
-	if req.UserPlan != nil {
-		user.UserPlan = *req.UserPlan
+	if req.UserPlan != nil && *req.UserPlan != user.UserPlan {
+		now := time.Now() // 更换套餐后重新开始计费周期
+		user.UserPlan, user.CycleAnchor = *req.UserPlan, &now
+	}
+
+	// 全部为 0 时清除用户级覆盖，回退到套餐设置
+	if req.RateLimit != nil {
+		if req.RateLimit.IsZero() {
+			user.RateLimit = nil
+		} else {
+			user.RateLimit = req.RateLimit
+		}
+	}
+
+	// 规则为空时清除用户级覆盖，回退到套餐设置
+	if req.ModelAccess != nil {
+		if req.ModelAccess.IsZero() {
+			user.ModelAccess = nil
+		} else {
+			user.ModelAccess = req.ModelAccess
+		}
 	}
 
 	if err := s.db.Save(&user).Error; err != nil {
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"fmt"
+
+	"llm-member/internal/config"
+	"llm-member/internal/consts"
+	"llm-member/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WalletService struct {
+	db *gorm.DB
+}
+
+func NewWalletService() *WalletService {
+	return &WalletService{db: config.GetDB()}
+}
+
+// Credit 入账（充值、退款、结算退回等）
+func (s *WalletService) Credit(userID uint64, amount float64, kind model.LedgerKind, refID, remark string) (*model.WalletLedgerModel, error) {
+	var entry *model.WalletLedgerModel
+	err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+		entry, err = s.CreditTx(tx, userID, amount, kind, refID, remark)
+		return err
+	})
+	return entry, err
+}
+
+// Debit 扣款，overdraft 为 false 时余额不足直接失败
+// overdraft 为 true 时允许透支，用于退款扣回等必须完成的扣款
+func (s *WalletService) Debit(userID uint64, amount float64, kind model.LedgerKind, refID, remark string, overdraft bool) (*model.WalletLedgerModel, error) {
+	var entry *model.WalletLedgerModel
+	err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+		entry, err = s.DebitTx(tx, userID, amount, kind, refID, remark, overdraft)
+		return err
+	})
+	return entry, err
+}
+
+// DebitUpTo 扣款但不透支，余额不足时只扣至零，用于按实际费用补扣的场景
+func (s *WalletService) DebitUpTo(userID uint64, amount float64, kind model.LedgerKind, refID, remark string) (*model.WalletLedgerModel, error) {
+	var entry *model.WalletLedgerModel
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user model.UserModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("balance").First(&user, userID).Error; err != nil {
+			return consts.ErrUserNotFound
+		}
+		if user.Balance < amount {
+			amount = user.Balance
+		}
+		if amount <= 0 {
+			return consts.ErrInsufficientBalance
+		}
+		var err error
+		entry, err = s.DebitTx(tx, userID, amount, kind, refID, remark, false)
+		return err
+	})
+	return entry, err
+}
+
+// CreditTx 在已有事务中入账
+func (s *WalletService) CreditTx(tx *gorm.DB, userID uint64, amount float64, kind model.LedgerKind, refID, remark string) (*model.WalletLedgerModel, error) {
+	if amount <= 0 {
+		return nil, consts.ErrInvalidWalletAmount
+	}
+	result := tx.Model(&model.UserModel{}).Where("id = ?", userID).
+		Update("balance", gorm.Expr("balance + ?", amount))
+	if result.Error != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrWalletUpdateFailed, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, consts.ErrUserNotFound
+	}
+	return s.appendLedger(tx, userID, amount, kind, refID, remark)
+}
+
+// DebitTx 在已有事务中扣款，以余额为条件更新，防止并发扣款导致超额消费
+func (s *WalletService) DebitTx(tx *gorm.DB, userID uint64, amount float64, kind model.LedgerKind, refID, remark string, overdraft bool) (*model.WalletLedgerModel, error) {
+	if amount <= 0 {
+		return nil, consts.ErrInvalidWalletAmount
+	}
+	query := tx.Model(&model.UserModel{}).Where("id = ?", userID)
+	if !overdraft {
+		query = query.Where("balance >= ?", amount)
+	}
+	result := query.Update("balance", gorm.Expr("balance - ?", amount))
+	if result.Error != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrWalletUpdateFailed, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, consts.ErrInsufficientBalance
+	}
+	return s.appendLedger(tx, userID, -amount, kind, refID, remark)
+}
+
+// GetBalance 获取用户余额
+func (s *WalletService) GetBalance(userID uint64) (float64, error) {
+	var user model.UserModel
+	if err := s.db.Select("balance").First(&user, userID).Error; err != nil {
+		return 0, consts.ErrUserNotFound
+	}
+	return user.Balance, nil
+}
+
+// QueryLedger 分页查询钱包流水
+func (s *WalletService) QueryLedger(req *model.PaginateRequest) (*model.PaginateResponse, error) {
+	var total int64
+	var entries []model.WalletLedgerModel
+
+	query := s.db.Model(&model.WalletLedgerModel{})
+	if len(req.Query) > 0 {
+		query = query.Where(req.Query)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	offset := int((req.Page - 1) * req.Size)
+	if err := query.Order("id DESC").Offset(offset).
+		Limit(int(req.Size)).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	response := &model.PaginateResponse{
+		Data: entries, Page: req.Page, Size: req.Size, Total: total,
+		Count: uint((total + int64(req.Size) - 1) / int64(req.Size)),
+	}
+	return response, nil
+}
+
+// appendLedger 读取更新后的余额并追加流水
+func (s *WalletService) appendLedger(tx *gorm.DB, userID uint64, amount float64, kind model.LedgerKind, refID, remark string) (*model.WalletLedgerModel, error) {
+	var user model.UserModel
+	if err := tx.Select("balance").First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrWalletUpdateFailed, err)
+	}
+	entry := &model.WalletLedgerModel{
+		UserID: userID, Kind: kind, Amount: amount,
+		Balance: user.Balance, RefID: refID, Remark: remark,
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return nil, fmt.Errorf("%w: %v", consts.ErrWalletUpdateFailed, err)
+	}
+	return entry, nil
+}
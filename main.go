@@ -11,6 +11,7 @@ import (
 	"llm-member/internal/auth"
 	"llm-member/internal/config"
 	"llm-member/internal/handle"
+	"llm-member/internal/payment"
 	"llm-member/internal/service"
 )
 
@@ -23,12 +24,19 @@ func main() {
 	}
 
 	var cfg = config.Load()
+	if err := payment.Validate(); err != nil {
+		log.Fatal("Failed to validate payment providers:", err)
+	}
 	if err := config.InitDB(cfg); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 	if err := service.HandleInit(); err != nil {
 		log.Fatal("Failed to initialize data:", err)
 	}
+	service.NewCatalogService().StartDiscovery(config.GetDiscoverInterval())
+	service.NewPlanService().StartExpiryCheck(config.GetExpireCheckInterval())
+	service.NewUsageService().StartJobs(config.GetUsageFlushInterval(), config.GetUsageReconcileInterval())
+	service.NewOrderService().StartJobs(config.GetOrderExpireInterval(), config.GetOrderReconcileInterval())
 
 	gin.SetMode(cfg.AppMode)
 	r := gin.Default()
@@ -58,6 +66,7 @@ func main() {
 		v1.POST("/verify-token", auth.NoneMiddleware(), authHandle.VerifyCallbackToken)
 		v1.POST("/user-profile", keyMiddle, authHandle.GetUserProfile)
 		v1.POST("/chat/completions", keyMiddle, relayHandle.ChatCompletions)
+		v1.GET("/models", keyMiddle, relayHandle.GetModels)
 	}
 
 	api := r.Group("/api")
@@ -80,6 +89,8 @@ func main() {
 			rootApi.POST("/pricing-plans", s.GetPricingPlans)
 			// order callback should public
 			rootApi.POST("/callback/:name", s.DoPaymentCallback)
+			rootApi.GET("/return/:name", s.DoPaymentReturn)
+			rootApi.GET("/pay/:id", s.DoPaymentForm)
 		}
 
 		basicApi := api.Group("/", auth.AuthMiddleware(authService))
@@ -89,6 +100,10 @@ func main() {
 			basicApi.PUT("/profile", b.SetUserProfile)
 			basicApi.POST("/usage", b.GetUserUsage)
 			basicApi.POST("/orders", b.GetUserOrders)
+			basicApi.GET("/wallet", b.GetUserWallet)
+			basicApi.POST("/wallet/ledger", b.GetUserLedger)
+			basicApi.GET("/subscriptions", b.GetUserSubscriptions)
+			basicApi.POST("/subscriptions/:id/cancel", b.CancelSubscription)
 			basicApi.POST("/api-keys", b.GetUserAPIKeys)
 			basicApi.POST("/regenerate", b.RegenerateKey)
 		}
@@ -97,6 +112,7 @@ func main() {
 		{
 			o := handle.NewOrderHandler()
 			orderApi.POST("/create", o.CreatePaymentOrder)
+			orderApi.POST("/quote", o.QuotePlan)
 			orderApi.POST("/methods", o.GetPaymentMethods)
 			orderApi.POST("/query/:id", o.QueryPaymentOrder)
 			orderApi.POST("/qrcode/:id", o.ShowPaymentQrcode)
@@ -107,22 +123,46 @@ func main() {
 			h := handle.NewAdminHandle()
 			adminApi.GET("/current", h.Current)
 			adminApi.PUT("/users/:id", h.UpdateUser)
+			adminApi.GET("/users/:id/plan-changes", h.GetPlanChanges)
+			adminApi.POST("/users/:id/wallet", h.AdjustWallet)
+			adminApi.POST("/wallet/ledger", h.GetLedger)
 			adminApi.POST("/users/create", h.CreateUser)
 			adminApi.POST("/users/:id/toggle", h.ToggleUserStatus)
 			adminApi.POST("/users/:id/generate", h.GenerateAPIKey)
 
 			adminApi.POST("/logs", h.GetLogs)
 			adminApi.GET("/usage", h.GetUsage)
+			adminApi.POST("/usage/reconcile", h.ReconcileUsage)
 			adminApi.GET("/stats", h.GetStats)
 			adminApi.GET("/models", h.GetModels)
+			adminApi.GET("/catalog", h.GetCatalog)
+			adminApi.POST("/catalog/discover", h.DiscoverModels)
+			adminApi.POST("/catalog/:id/toggle", h.ToggleModel)
+			adminApi.GET("/prices", h.GetPrices)
+			adminApi.POST("/prices", h.SetPrice)
+			adminApi.DELETE("/prices/:id", h.DeletePrice)
+			adminApi.GET("/coupons", h.GetCoupons)
+			adminApi.POST("/coupons", h.SaveCoupon)
+			adminApi.POST("/coupons/:id/toggle", h.ToggleCoupon)
 			adminApi.POST("/users", h.GetUsers)
 			adminApi.POST("/orders", h.GetOrders)
+			adminApi.GET("/orders/:id/history", h.GetOrderHistory)
+			adminApi.POST("/orders/:id/cancel", h.CancelOrder)
+			adminApi.POST("/orders/:id/refund", h.RefundOrder)
+			adminApi.GET("/orders/:id/refunds", h.GetOrderRefunds)
+			adminApi.POST("/orders/:id/mock", h.SetMockOutcome)
+			adminApi.POST("/orders/:id/mock-webhook", h.SendMockWebhook)
+			adminApi.POST("/payment-events", h.GetPaymentEvents)
+			adminApi.POST("/payment-events/:id/replay", h.ReplayPaymentEvent)
+			adminApi.GET("/jobs", h.GetJobs)
+			adminApi.POST("/job-runs", h.GetJobRuns)
 		}
 
 		setupApi := api.Group("/setup", auth.AdminMiddleware(authService))
 		{
 			s := handle.NewSetupHandler()
 			setupApi.GET("/pricing", s.GetPricingPlans)
+			setupApi.POST("/pricing/sort", s.SortPricingPlans)
 			setupApi.PUT("/pricing/:plan", s.SetPricingPlan)
 		}
 	}
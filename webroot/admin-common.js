@@ -125,6 +125,17 @@ class LLMMemberApp {
       });
     });
 
+    // 立即发现模型
+    document.getElementById("discoverModelsBtn").addEventListener("click", () => {
+      this.discoverModels();
+    });
+
+    // 保存模型价格
+    document.getElementById("priceForm").addEventListener("submit", (e) => {
+      e.preventDefault();
+      this.savePrice();
+    });
+
     // 模型筛选按钮
     document.addEventListener("click", (e) => {
       if (e.target.classList.contains("provider-filter-btn")) {
@@ -314,6 +325,8 @@ class LLMMemberApp {
       const data = await this.apiCall("/api/admin/models");
       this.allModels = data.data || []; // 存储所有模型数据
       this.updateModelsTable(this.allModels);
+      this.loadCatalog();
+      this.loadPrices();
     } catch (error) {
       if (error.message !== "Unauthorized") {
         console.error("Failed to load models page:", error);
@@ -321,6 +334,207 @@ class LLMMemberApp {
     }
   }
 
+  async loadCatalog() {
+    try {
+      const data = await this.apiCall("/api/admin/catalog");
+      this.updateCatalogTable(data.data || []);
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("Failed to load catalog:", error);
+      }
+    }
+  }
+
+  async discoverModels() {
+    try {
+      const resp = await this.apiCall("/api/admin/catalog/discover", {
+        method: "POST", body: JSON.stringify({}),
+      });
+      if (resp.error) {
+        this.showAlert(resp.error, "error");
+        return;
+      }
+      const summary = Object.entries(resp.result || {})
+        .map(([provider, result]) => `${provider}: ${result}`)
+        .join("，");
+      this.showAlert(summary || "没有支持自动发现的提供商", "info");
+      this.loadModelsPage();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.showAlert("发现模型失败: " + error.message, "error");
+      }
+    }
+  }
+
+  async toggleCatalogModel(id, enabled) {
+    try {
+      const resp = await this.apiCall(`/api/admin/catalog/${id}/toggle`, {
+        method: "POST", body: JSON.stringify({ enabled }),
+      });
+      if (resp.error) {
+        this.showAlert(resp.error, "error");
+        return;
+      }
+      this.loadModelsPage();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.showAlert("更新模型状态失败: " + error.message, "error");
+      }
+    }
+  }
+
+  updateCatalogTable(models) {
+    const tableDiv = document.getElementById("catalogTable");
+
+    if (models.length === 0) {
+      tableDiv.innerHTML =
+        '<p class="text-gray-500 text-center">暂无自动发现的模型</p>';
+      return;
+    }
+
+    tableDiv.innerHTML = `
+      <div class="overflow-x-auto">
+        <table class="min-w-full divide-y divide-gray-200">
+          <thead class="bg-gray-50">
+            <tr>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">模型 ID</th>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">渠道</th>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">所有者</th>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">同步时间</th>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">操作</th>
+            </tr>
+          </thead>
+          <tbody class="bg-white divide-y divide-gray-200">
+            ${models.map((model) => `
+              <tr>
+                <td class="px-6 py-4 whitespace-nowrap text-sm font-mono text-gray-900">${this.escapeHtml(model.modelId)}</td>
+                <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-900">${this.escapeHtml(model.provider)}</td>
+                <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-500">${this.escapeHtml(model.ownedBy || "-")}</td>
+                <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-500">${new Date(model.syncedAt).toLocaleString()}</td>
+                <td class="px-6 py-4 whitespace-nowrap text-sm">
+                  <button onclick="app.toggleCatalogModel(${model.id}, ${!model.enabled})"
+                    class="px-2 inline-flex text-xs leading-5 font-semibold rounded-full ${
+                      model.enabled ? "bg-green-100 text-green-800" : "bg-gray-100 text-gray-800"
+                    }">
+                    ${model.enabled ? "已启用" : "已禁用"}
+                  </button>
+                </td>
+              </tr>
+            `).join("")}
+          </tbody>
+        </table>
+      </div>
+    `;
+  }
+
+  async loadPrices() {
+    try {
+      const data = await this.apiCall("/api/admin/prices");
+      this.updatePricesTable(data.data || []);
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("Failed to load prices:", error);
+      }
+    }
+  }
+
+  async savePrice() {
+    const price = {
+      modelId: document.getElementById("priceModelId").value.trim(),
+      input: parseFloat(document.getElementById("priceInput").value) || 0,
+      output: parseFloat(document.getElementById("priceOutput").value) || 0,
+      cached: parseFloat(document.getElementById("priceCached").value) || 0,
+    };
+    try {
+      const resp = await this.apiCall("/api/admin/prices", {
+        method: "POST", body: JSON.stringify(price),
+      });
+      if (resp.error) {
+        this.showAlert(resp.error, "error");
+        return;
+      }
+      this.showAlert("价格保存成功", "success");
+      document.getElementById("priceForm").reset();
+      this.loadPrices();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.showAlert("保存价格失败: " + error.message, "error");
+      }
+    }
+  }
+
+  editPrice(price) {
+    document.getElementById("priceModelId").value = price.modelId;
+    document.getElementById("priceInput").value = price.input;
+    document.getElementById("priceOutput").value = price.output;
+    document.getElementById("priceCached").value = price.cached;
+  }
+
+  async deletePrice(id) {
+    if (!confirm("确定要删除该模型价格吗？")) {
+      return;
+    }
+    try {
+      const resp = await this.apiCall(`/api/admin/prices/${id}`, {
+        method: "DELETE",
+      });
+      if (resp.error) {
+        this.showAlert(resp.error, "error");
+        return;
+      }
+      this.loadPrices();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.showAlert("删除价格失败: " + error.message, "error");
+      }
+    }
+  }
+
+  updatePricesTable(prices) {
+    const tableDiv = document.getElementById("pricesTable");
+    this.prices = prices;
+
+    if (prices.length === 0) {
+      tableDiv.innerHTML =
+        '<p class="text-gray-500 text-center">暂未配置模型价格</p>';
+      return;
+    }
+
+    tableDiv.innerHTML = `
+      <div class="overflow-x-auto">
+        <table class="min-w-full divide-y divide-gray-200">
+          <thead class="bg-gray-50">
+            <tr>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">模型 ID</th>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">输入</th>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">输出</th>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">缓存</th>
+              <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">操作</th>
+            </tr>
+          </thead>
+          <tbody class="bg-white divide-y divide-gray-200">
+            ${prices.map((price, index) => `
+              <tr>
+                <td class="px-6 py-4 whitespace-nowrap text-sm font-mono text-gray-900">${this.escapeHtml(price.modelId)}</td>
+                <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-900">${price.input}</td>
+                <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-900">${price.output}</td>
+                <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-500">${price.cached}</td>
+                <td class="px-6 py-4 whitespace-nowrap text-sm">
+                  <button onclick="app.editPrice(app.prices[${index}])" class="text-blue-600 hover:text-blue-900 mr-3">
+                    <i class="fas fa-edit"></i>
+                  </button>
+                  <button onclick="app.deletePrice(${price.id})" class="text-red-600 hover:text-red-900">
+                    <i class="fas fa-trash"></i>
+                  </button>
+                </td>
+              </tr>
+            `).join("")}
+          </tbody>
+        </table>
+      </div>
+    `;
+  }
+
   updateModelsTable(models) {
     const tableDiv = document.getElementById("modelsTable");
 
@@ -278,6 +278,18 @@ class MemberManager {
                     class="text-blue-600 hover:text-blue-900 mr-3">
                     <i class="fas fa-key"></i> 重新生成Key
                   </button>
+                  <button onclick="app.memberManager.adjustWallet(${user.id}, ${user.balance || 0})"
+                    class="text-green-600 hover:text-green-900 mr-3">
+                    <i class="fas fa-wallet"></i> 余额
+                  </button>
+                  <button onclick="app.memberManager.editRateLimit(${user.id}, '${this.formatRateLimit(user.rateLimit)}')"
+                    class="text-yellow-600 hover:text-yellow-900 mr-3">
+                    <i class="fas fa-tachometer-alt"></i> 限流
+                  </button>
+                  <button onclick="app.memberManager.editModelAccess(${user.id}, '${this.formatModelAccess(user.modelAccess)}')"
+                    class="text-purple-600 hover:text-purple-900 mr-3">
+                    <i class="fas fa-robot"></i> 模型
+                  </button>
                   <button onclick="app.memberManager.toggleUserStatus(${user.id}, ${!user.isActive})" 
                     class="${
                       user.isActive
@@ -388,6 +400,89 @@ class MemberManager {
     }
   }
 
+  // 调整用户钱包余额，正数入账、负数扣减
+  async adjustWallet(userId, balance) {
+    const input = prompt(`当前余额 ${balance.toFixed(4)}，请输入调整金额（负数为扣减）`);
+    const amount = parseFloat(input);
+    if (input === null || !amount) {
+      return;
+    }
+    const remark = prompt("请输入备注", "") || "";
+
+    try {
+      const resp = await this.app.apiCall(`/api/admin/users/${userId}/wallet`, {
+        method: "POST",
+        body: JSON.stringify({ amount, remark }),
+      });
+      if (resp.error) {
+        this.app.showAlert(resp.error, "error");
+        return;
+      }
+      this.app.showAlert(`调整成功，当前余额 ${resp.data.balance.toFixed(4)}`, "success");
+      this.loadUsersPage();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.app.showAlert("操作失败: " + (error.message || "网络错误，请重试"));
+      }
+    }
+  }
+
+  formatRateLimit(limit) {
+    limit = limit || {};
+    return [limit.rpm || 0, limit.tpm || 0, limit.concurrency || 0].join(",");
+  }
+
+  // 设置用户级速率限制，0 表示沿用套餐设置
+  async editRateLimit(userId, current) {
+    const input = prompt("请输入 RPM,TPM,并发数（0 表示沿用套餐设置）", current);
+    if (input === null) {
+      return;
+    }
+
+    const [rpm, tpm, concurrency] = input.split(",").map((v) => parseInt(v) || 0);
+    try {
+      await this.app.apiCall(`/api/admin/users/${userId}`, {
+        method: "PUT",
+        body: JSON.stringify({ rateLimit: { rpm, tpm, concurrency } }),
+      });
+      this.app.showAlert("速率限制已更新", "success");
+      this.loadUsersPage();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.app.showAlert("操作失败: " + (error.message || "网络错误，请重试"));
+      }
+    }
+  }
+
+  formatModelAccess(access) {
+    access = access || {};
+    return [(access.allow || []).join(","), (access.deny || []).join(",")].join(";");
+  }
+
+  // 设置用户级模型访问控制，留空表示沿用套餐设置
+  async editModelAccess(userId, current) {
+    const input = prompt("请输入 允许模型;禁用模型（逗号分隔，支持 * 通配，留空沿用套餐设置）", current);
+    if (input === null) {
+      return;
+    }
+
+    const [allow, deny] = input.split(";").map((part) =>
+      (part || "").split(",").map((v) => v.trim()).filter((v) => v)
+    );
+    try {
+      await this.app.apiCall(`/api/admin/users/${userId}`, {
+        method: "PUT",
+        body: JSON.stringify({ modelAccess: { allow: allow || [], deny: deny || [] } }),
+      });
+      this.app.showAlert("模型权限已更新", "success");
+      this.loadUsersPage();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.app.showAlert("操作失败: " + (error.message || "网络错误，请重试"));
+      }
+    }
+  }
+
   async toggleUserStatus(userId, enable) {
     const action = enable ? "启用" : "禁用";
     if (!confirm(`确定要${action}此用户吗？`)) {
@@ -16,6 +16,16 @@ class OrdersManager {
     const userSearchInput = document.getElementById("userSearchInput");
     const prevPageBtn = document.getElementById("prevPageBtn");
     const nextPageBtn = document.getElementById("nextPageBtn");
+    const eventResultFilter = document.getElementById("eventResultFilter");
+    const jobNameFilter = document.getElementById("jobNameFilter");
+
+    if (eventResultFilter) {
+      eventResultFilter.addEventListener("change", () => this.loadPaymentEvents());
+    }
+
+    if (jobNameFilter) {
+      jobNameFilter.addEventListener("change", () => this.loadJobRuns());
+    }
 
     if (searchOrdersBtn) {
       searchOrdersBtn.addEventListener("click", () => {
@@ -97,6 +107,8 @@ class OrdersManager {
         this.totalOrders = resp.total;
         this.updateOrdersTable(resp.data);
         this.updateOrdersPagination();
+        this.loadPaymentEvents();
+        this.loadJobs();
       } else {
         this.app.showAlert(resp.message || "加载订单失败", "error");
       }
@@ -162,16 +174,32 @@ class OrdersManager {
                   ${this.formatDateTime(order.createdAt)}
                 </td>
                 <td class="px-6 py-4 whitespace-nowrap text-sm font-medium">
-                  <button onclick="app.ordersManager.viewOrderDetails('${order.id}')" 
+                  <button onclick="app.ordersManager.viewOrderDetails('${order.orderId}')" 
                     class="text-blue-600 hover:text-blue-900 mr-3">
                     <i class="fas fa-eye"></i> 查看
                   </button>
                   ${order.status === 'pending' ? `
-                    <button onclick="app.ordersManager.cancelOrder('${order.id}')" 
+                    <button onclick="app.ordersManager.cancelOrder('${order.orderId}')" 
                       class="text-red-600 hover:text-red-900">
                       <i class="fas fa-times"></i> 取消
                     </button>
                   ` : ''}
+                  ${order.method === 'mock' ? `
+                    <button onclick="app.ordersManager.setMockOutcome('${order.orderId}')" 
+                      class="text-gray-600 hover:text-gray-900 ml-3">
+                      <i class="fas fa-flask"></i> 模拟结果
+                    </button>
+                    <button onclick="app.ordersManager.sendMockWebhook('${order.orderId}')" 
+                      class="text-gray-600 hover:text-gray-900 ml-3">
+                      <i class="fas fa-paper-plane"></i> 模拟回调
+                    </button>
+                  ` : ''}
+                  ${['succeed', 'partially_refunded'].includes(order.status) ? `
+                    <button onclick="app.ordersManager.refundOrder('${order.orderId}', ${(order.amount || 0) - (order.refunded || 0)})" 
+                      class="text-purple-600 hover:text-purple-900">
+                      <i class="fas fa-undo"></i> 退款
+                    </button>
+                  ` : ''}
                 </td>
               </tr>
             `).join('')}
@@ -189,7 +217,9 @@ class OrdersManager {
       'wechat': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-green-100 text-green-800">微信支付</span>',
       'paypal': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-purple-100 text-purple-800">PayPal</span>',
       'stripe': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-violet-100 text-violet-800">Stripe</span>',
-      'creem': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-indigo-100 text-indigo-800">Creem</span>'
+      'creem': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-indigo-100 text-indigo-800">Creem</span>',
+      'mock': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-gray-100 text-gray-800">模拟支付</span>',
+      'union': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-red-100 text-red-800">银联支付</span>'
     };
     return badges[method] || `<span class="text-gray-500">${this.app.escapeHtml(method || '')}</span>`;
   }
@@ -197,9 +227,11 @@ class OrdersManager {
   getOrderStatusBadge(status) {
     const badges = {
       'pending': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-yellow-100 text-yellow-800">待支付</span>',
-      'paid': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-green-100 text-green-800">已支付</span>',
-      'cancelled': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-red-100 text-red-800">已取消</span>',
-      'expired': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-gray-100 text-gray-800">已过期</span>'
+      'succeed': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-green-100 text-green-800">已支付</span>',
+      'canceled': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-red-100 text-red-800">已取消</span>',
+      'expired': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-gray-100 text-gray-800">已过期</span>',
+      'refunded': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-purple-100 text-purple-800">已退款</span>',
+      'partially_refunded': '<span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-purple-100 text-purple-800">部分退款</span>'
     };
     return badges[status] || `<span class="text-gray-500">${this.app.escapeHtml(status || '')}</span>`;
   }
@@ -221,6 +253,11 @@ class OrdersManager {
     // 更新按钮状态
     const prevPageBtn = document.getElementById("prevPageBtn");
     const nextPageBtn = document.getElementById("nextPageBtn");
+    const eventResultFilter = document.getElementById("eventResultFilter");
+
+    if (eventResultFilter) {
+      eventResultFilter.addEventListener("change", () => this.loadPaymentEvents());
+    }
     
     if (prevPageBtn) {
       prevPageBtn.disabled = this.currentOrderPage <= 1;
@@ -278,19 +315,136 @@ class OrdersManager {
     });
   }
 
+  // 查看订单的状态变更和退款记录
   async viewOrderDetails(orderId) {
     try {
-      const response = await this.app.apiCall(`/api/admin/orders/${orderId}`);
-      if (response.success) {
-        // 这里可以显示订单详情弹窗
-        this.app.showAlert(`订单详情: ${JSON.stringify(response.data, null, 2)}`, "info");
+      const resp = await this.app.apiCall(`/api/admin/orders/${orderId}/history`);
+      if (resp.error) {
+        this.app.showAlert(resp.error, "error");
+        return;
+      }
+      this.updateOrderHistory(orderId, resp.data || []);
+      const refunds = await this.app.apiCall(`/api/admin/orders/${orderId}/refunds`);
+      this.updateOrderRefunds(refunds.data || []);
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("获取订单记录失败:", error);
+        this.app.showAlert("获取订单记录失败", "error");
+      }
+    }
+  }
+
+  updateOrderHistory(orderId, history) {
+    const sources = { user: "用户", webhook: "支付回调", query: "主动查询", admin: "管理员", job: "定时任务" };
+    document.getElementById("orderHistoryId").textContent = orderId;
+    const tableDiv = document.getElementById("orderHistoryTable");
+    if (history.length === 0) {
+      tableDiv.innerHTML = '<p class="text-gray-500 text-center">暂无变更记录</p>';
+    } else {
+      const th = "px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider";
+      const td = "px-6 py-4 whitespace-nowrap text-sm text-gray-900";
+      tableDiv.innerHTML = `
+        <div class="overflow-x-auto">
+          <table class="min-w-full divide-y divide-gray-200">
+            <thead class="bg-gray-50">
+              <tr>
+                <th class="${th}">时间</th>
+                <th class="${th}">状态</th>
+                <th class="${th}">来源</th>
+                <th class="${th}">操作者</th>
+                <th class="${th}">备注</th>
+              </tr>
+            </thead>
+            <tbody class="bg-white divide-y divide-gray-200">
+              ${history.map((item) => `
+                <tr>
+                  <td class="${td}">${this.formatDateTime(item.createdAt)}</td>
+                  <td class="${td}">${item.from ? this.getOrderStatusBadge(item.from) + " → " : ""}${this.getOrderStatusBadge(item.to)}</td>
+                  <td class="${td}">${sources[item.source] || this.app.escapeHtml(item.source)}</td>
+                  <td class="${td} font-mono">${this.app.escapeHtml(item.actor || "-")}</td>
+                  <td class="${td}">${this.app.escapeHtml(item.remark || "")}</td>
+                </tr>
+              `).join("")}
+            </tbody>
+          </table>
+        </div>
+      `;
+    }
+    document.getElementById("orderHistoryPanel").classList.remove("hidden");
+  }
+
+  updateOrderRefunds(refunds) {
+    const statuses = { pending: "处理中", succeed: "已退款", failed: "失败" };
+    const tableDiv = document.getElementById("orderRefundsTable");
+    if (refunds.length === 0) {
+      tableDiv.innerHTML = '<p class="text-gray-500 text-center">暂无退款记录</p>';
+      return;
+    }
+    const th = "px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider";
+    const td = "px-6 py-4 whitespace-nowrap text-sm text-gray-900";
+    tableDiv.innerHTML = `
+      <div class="overflow-x-auto">
+        <table class="min-w-full divide-y divide-gray-200">
+          <thead class="bg-gray-50">
+            <tr>
+              <th class="${th}">时间</th>
+              <th class="${th}">退款单号</th>
+              <th class="${th}">金额</th>
+              <th class="${th}">状态</th>
+              <th class="${th}">原因</th>
+              <th class="${th}">回滚</th>
+              <th class="${th}">操作者</th>
+            </tr>
+          </thead>
+          <tbody class="bg-white divide-y divide-gray-200">
+            ${refunds.map((item) => `
+              <tr>
+                <td class="${td}">${this.formatDateTime(item.CreatedAt)}</td>
+                <td class="${td} font-mono">${this.app.escapeHtml(item.refundId)}</td>
+                <td class="${td}">${item.amount.toFixed(2)} ${this.app.escapeHtml(item.currency || "")}</td>
+                <td class="${td}" title="${this.app.escapeHtml(item.error || "")}">${statuses[item.status] || this.app.escapeHtml(item.status)}</td>
+                <td class="${td}">${this.app.escapeHtml(item.reason || "")}</td>
+                <td class="${td}">${this.app.escapeHtml(item.reversal || "-")}</td>
+                <td class="${td} font-mono">${this.app.escapeHtml(item.actor || "-")}</td>
+              </tr>
+            `).join("")}
+          </tbody>
+        </table>
+      </div>
+    `;
+  }
+
+  // 退款并回滚订单发放的套餐或余额，金额小于可退金额时为部分退款
+  async refundOrder(orderId, refundable) {
+    const input = prompt(`退款金额（可退 ${refundable.toFixed(2)}，留空全额退款）：`, "");
+    if (input === null) {
+      return;
+    }
+    const amount = input.trim() ? parseFloat(input) : 0;
+    if (isNaN(amount) || amount < 0 || amount > refundable) {
+      this.app.showAlert("退款金额无效", "error");
+      return;
+    }
+    const reason = prompt("退款原因：", "");
+    if (!reason || !reason.trim()) {
+      return;
+    }
+
+    try {
+      const response = await this.app.apiCall(`/api/admin/orders/${orderId}/refund`, {
+        method: 'POST', body: JSON.stringify({ amount, reason: reason.trim() })
+      });
+
+      if (response.error) {
+        this.app.showAlert(response.error, "error");
       } else {
-        this.app.showAlert(response.message || "获取订单详情失败", "error");
+        this.app.showAlert(response.refund.status === "pending" ? response.message : `退款成功：${response.refund.reversal}`, "success");
+        this.loadOrdersPage();
       }
     } catch (error) {
       if (error.message !== "Unauthorized") {
-        console.error("获取订单详情失败:", error);
-        this.app.showAlert("获取订单详情失败", "error");
+        console.error("退款失败:", error);
+        this.app.showAlert("退款失败", "error");
       }
     }
   }
@@ -299,17 +453,17 @@ class OrdersManager {
     if (!confirm('确定要取消这个订单吗？')) {
       return;
     }
-    
+
     try {
       const response = await this.app.apiCall(`/api/admin/orders/${orderId}/cancel`, {
         method: 'POST'
       });
-      
-      if (response.success) {
+
+      if (response.error) {
+        this.app.showAlert(response.error, "error");
+      } else {
         this.app.showAlert("订单已取消", "success");
         this.loadOrdersPage();
-      } else {
-        this.app.showAlert(response.message || "取消订单失败", "error");
       }
     } catch (error) {
       if (error.message !== "Unauthorized") {
@@ -318,4 +472,270 @@ class OrdersManager {
       }
     }
   }
+
+  // 设置模拟支付订单的结果，下次查询或对账时生效
+  async setMockOutcome(orderId) {
+    const outcome = prompt("模拟结果（success、failure、delay、expiry）：", "success");
+    if (!outcome || !outcome.trim()) {
+      return;
+    }
+
+    try {
+      const response = await this.app.apiCall(`/api/admin/orders/${orderId}/mock`, {
+        method: 'POST', body: JSON.stringify({ outcome: outcome.trim() })
+      });
+
+      if (response.error) {
+        this.app.showAlert(response.error, "error");
+      } else {
+        this.app.showAlert("模拟结果已更新", "success");
+        this.loadOrdersPage();
+      }
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("设置模拟结果失败:", error);
+        this.app.showAlert("设置模拟结果失败", "error");
+      }
+    }
+  }
+
+  // 发送签名的模拟支付回调，金额留空时使用订单金额
+  async sendMockWebhook(orderId) {
+    const status = prompt("回调状态（success、failed、cancelled、refunded）：", "success");
+    if (!status || !status.trim()) {
+      return;
+    }
+    const input = prompt("回调金额（留空使用订单金额）：", "");
+    if (input === null) {
+      return;
+    }
+    const body = { status: status.trim() };
+    if (input.trim()) {
+      body.amount = parseFloat(input);
+      if (isNaN(body.amount) || body.amount < 0) {
+        this.app.showAlert("回调金额无效", "error");
+        return;
+      }
+    }
+
+    try {
+      const response = await this.app.apiCall(`/api/admin/orders/${orderId}/mock-webhook`, {
+        method: 'POST', body: JSON.stringify(body)
+      });
+
+      if (response.error) {
+        this.app.showAlert(response.error, "error");
+      } else {
+        this.app.showAlert(`模拟回调已发送：${response.event.id}`, "success");
+      }
+      this.loadOrdersPage();
+      this.loadPaymentEvents();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("发送模拟回调失败:", error);
+        this.app.showAlert("发送模拟回调失败", "error");
+      }
+    }
+  }
+
+  // 加载最近的支付回调事件
+  async loadPaymentEvents() {
+    const result = document.getElementById("eventResultFilter").value;
+    const params = { page: 1, size: 20, query: {} };
+    if (result) params.query.result = result;
+    try {
+      const resp = await this.app.apiCall("/api/admin/payment-events", {
+        method: "POST", body: JSON.stringify(params),
+      });
+      this.updatePaymentEventsTable(resp.data || []);
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("加载支付事件失败:", error);
+      }
+    }
+  }
+
+  // 重放支付回调事件
+  async replayPaymentEvent(id) {
+    if (!confirm("确定要重新处理该事件吗？")) {
+      return;
+    }
+    try {
+      const resp = await this.app.apiCall(`/api/admin/payment-events/${id}/replay`, {
+        method: "POST",
+      });
+      if (resp.error) {
+        this.app.showAlert(resp.error, "error");
+      } else {
+        this.app.showAlert("事件已重放", "success");
+      }
+      this.loadOrdersPage();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.app.showAlert("重放事件失败: " + error.message, "error");
+      }
+    }
+  }
+
+  updatePaymentEventsTable(events) {
+    const tableDiv = document.getElementById("paymentEventsTable");
+    if (events.length === 0) {
+      tableDiv.innerHTML = '<p class="text-gray-500 text-center">暂无支付事件</p>';
+      return;
+    }
+
+    const results = {
+      processed: "bg-green-100 text-green-800", ignored: "bg-gray-100 text-gray-800",
+      failed: "bg-red-100 text-red-800", rejected: "bg-red-100 text-red-800",
+      pending: "bg-yellow-100 text-yellow-800",
+    };
+    const th = "px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider";
+    const td = "px-6 py-4 whitespace-nowrap text-sm text-gray-900";
+    tableDiv.innerHTML = `
+      <div class="overflow-x-auto">
+        <table class="min-w-full divide-y divide-gray-200">
+          <thead class="bg-gray-50">
+            <tr>
+              <th class="${th}">时间</th>
+              <th class="${th}">渠道</th>
+              <th class="${th}">事件</th>
+              <th class="${th}">订单ID</th>
+              <th class="${th}">状态</th>
+              <th class="${th}">结果</th>
+              <th class="${th}">操作</th>
+            </tr>
+          </thead>
+          <tbody class="bg-white divide-y divide-gray-200">
+            ${events.map((event) => `
+              <tr>
+                <td class="${td}">${this.formatDateTime(event.CreatedAt)}</td>
+                <td class="${td}">${this.getPaymentMethodBadge(event.method)}</td>
+                <td class="${td} font-mono" title="${this.app.escapeHtml(event.eventId)}">${this.app.escapeHtml(event.type || "-")}</td>
+                <td class="${td} font-mono">${this.app.escapeHtml(event.orderId || "-")}</td>
+                <td class="${td}">${this.app.escapeHtml(event.status || "-")}</td>
+                <td class="${td}">
+                  <span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium ${results[event.result] || ""}"
+                    title="${this.app.escapeHtml(event.error || "")}">${this.app.escapeHtml(event.result)}</span>
+                  ${event.attempts > 1 ? `<span class="text-xs text-gray-500 ml-1">×${event.attempts}</span>` : ""}
+                </td>
+                <td class="${td}">
+                  ${event.verified ? `<button onclick="app.ordersManager.replayPaymentEvent(${event.id})"
+                    class="text-blue-600 hover:text-blue-800">重放</button>` : ""}
+                </td>
+              </tr>
+            `).join("")}
+          </tbody>
+        </table>
+      </div>
+    `;
+  }
+
+  // 加载定时任务状态和运行记录
+  async loadJobs() {
+    try {
+      const resp = await this.app.apiCall("/api/admin/jobs");
+      this.updateJobsSummary(resp);
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("加载定时任务失败:", error);
+      }
+    }
+    this.loadJobRuns();
+  }
+
+  async loadJobRuns() {
+    const name = document.getElementById("jobNameFilter").value;
+    const params = { page: 1, size: 20, query: {} };
+    if (name) params.query.name = name;
+    try {
+      const resp = await this.app.apiCall("/api/admin/job-runs", {
+        method: "POST", body: JSON.stringify(params),
+      });
+      this.updateJobRunsTable(resp.data || []);
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("加载任务运行记录失败:", error);
+      }
+    }
+  }
+
+  updateJobsSummary(status) {
+    const instance = document.getElementById("jobInstance");
+    instance.textContent = status.instance
+      ? `${status.instance}${status.leader ? "（主实例）" : "（备用实例）"}` : "";
+
+    const names = {
+      "order-expire": "超时关单", "order-reconcile": "支付对账",
+      "plan-expire": "套餐到期降级", "usage-flush": "用量回写",
+      "usage-reconcile": "用量对账", "catalog-discover": "模型发现",
+    };
+    const summary = document.getElementById("jobsSummary");
+    const jobs = status.jobs || [];
+    if (jobs.length === 0) {
+      summary.innerHTML = '<p class="text-gray-500">当前实例未启用定时任务</p>';
+      return;
+    }
+    summary.innerHTML = jobs.map((job) => {
+      const run = job.lastRun;
+      return `
+        <div class="border border-gray-200 rounded-lg p-4">
+          <div class="flex justify-between items-center">
+            <span class="font-medium text-gray-800">${this.app.escapeHtml(names[job.name] || job.name)}</span>
+            <span class="text-xs text-gray-500">每 ${this.app.escapeHtml(job.interval)}</span>
+          </div>
+          <p class="text-sm text-gray-600 mt-2">
+            ${run ? `最近运行 ${this.formatDateTime(run.startedAt)}，${this.app.escapeHtml(run.status)}，处理 ${run.processed}，失败 ${run.failed}` : "尚未运行"}
+          </p>
+        </div>
+      `;
+    }).join("");
+  }
+
+  updateJobRunsTable(runs) {
+    const tableDiv = document.getElementById("jobRunsTable");
+    if (runs.length === 0) {
+      tableDiv.innerHTML = '<p class="text-gray-500 text-center">暂无运行记录</p>';
+      return;
+    }
+
+    const statuses = {
+      succeed: "bg-green-100 text-green-800", failed: "bg-red-100 text-red-800",
+      running: "bg-yellow-100 text-yellow-800",
+    };
+    const th = "px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider";
+    const td = "px-6 py-4 whitespace-nowrap text-sm text-gray-900";
+    tableDiv.innerHTML = `
+      <div class="overflow-x-auto">
+        <table class="min-w-full divide-y divide-gray-200">
+          <thead class="bg-gray-50">
+            <tr>
+              <th class="${th}">开始时间</th>
+              <th class="${th}">任务</th>
+              <th class="${th}">实例</th>
+              <th class="${th}">状态</th>
+              <th class="${th}">处理</th>
+              <th class="${th}">失败</th>
+              <th class="${th}">耗时</th>
+            </tr>
+          </thead>
+          <tbody class="bg-white divide-y divide-gray-200">
+            ${runs.map((run) => `
+              <tr>
+                <td class="${td}">${this.formatDateTime(run.startedAt)}</td>
+                <td class="${td} font-mono">${this.app.escapeHtml(run.name)}</td>
+                <td class="${td} text-gray-500">${this.app.escapeHtml(run.instance || "-")}</td>
+                <td class="${td}">
+                  <span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium ${statuses[run.status] || ""}"
+                    title="${this.app.escapeHtml(run.message || "")}">${this.app.escapeHtml(run.status)}</span>
+                </td>
+                <td class="${td}">${run.processed}</td>
+                <td class="${td}">${run.failed}</td>
+                <td class="${td}">${run.duration} ms</td>
+              </tr>
+            `).join("")}
+          </tbody>
+        </table>
+      </div>
+    `;
+  }
 }
\ No newline at end of file
@@ -7,6 +7,12 @@ class PricingManager {
 
   // 绑定事件
   bindEvents() {
+    // 新建方案按钮
+    const createPlanBtn = document.getElementById("createPlan");
+    if (createPlanBtn) {
+      createPlanBtn.addEventListener("click", () => this.createPricingPlan());
+    }
+
     // 保存定价方案按钮
     const savePlanBtn = document.getElementById("savePlan");
     if (savePlanBtn) {
@@ -44,6 +50,15 @@ class PricingManager {
       });
     }
 
+    // 保存优惠券
+    const couponForm = document.getElementById("couponForm");
+    if (couponForm) {
+      couponForm.addEventListener("submit", (e) => {
+        e.preventDefault();
+        this.saveCoupon();
+      });
+    }
+
     // 编辑付费方案表单
     const editPlanForm = document.getElementById("editPlanForm");
     if (editPlanForm) {
@@ -58,7 +73,9 @@ class PricingManager {
   async loadPricingPlans() {
     try {
       const resp = await this.app.apiCall("/api/setup/pricing");
-      this.updatePricingPlansDisplay(resp?.plans || []);
+      this.plans = resp?.plans || [];
+      this.updatePricingPlansDisplay(this.plans);
+      this.loadCoupons();
     } catch (error) {
       if (error.message !== "Unauthorized") {
         console.error("Failed to load pricing plans:", error);
@@ -76,10 +93,8 @@ class PricingManager {
       return;
     }
 
-    const planOrder = ["basic", "extra", "ultra", "super"];
-    const sortedPlans = plans.sort((a, b) => {
-      return planOrder.indexOf(a.plan) - planOrder.indexOf(b.plan);
-    });
+    // 服务端已按展示顺序排列
+    const sortedPlans = plans;
 
     // 设置容器为横向网格布局
     container.className = "grid grid-cols-1 md:grid-cols-2 lg:grid-cols-3 xl:grid-cols-4 gap-6";
@@ -103,10 +118,19 @@ class PricingManager {
                   }">
                     ${plan.enabled ? "已启用" : "已禁用"}
                   </span>
+                  ${plan.archived ? '<span class="px-2 py-1 text-xs rounded-full bg-yellow-100 text-yellow-800">已下架</span>' : ""}
                   </div>
                   <p class="text-gray-600">${plan.brief}</p>
               </div>
               <div class="flex items-center space-x-2">
+                <button onclick="app.pricingManager.movePricingPlan('${ plan.plan }', -1)"
+                  class="text-gray-500 hover:text-gray-700" title="上移">
+                    <i class="fas fa-arrow-up"></i>
+                </button>
+                <button onclick="app.pricingManager.movePricingPlan('${ plan.plan }', 1)"
+                  class="text-gray-500 hover:text-gray-700" title="下移">
+                    <i class="fas fa-arrow-down"></i>
+                </button>
                 <button onclick="app.pricingManager.editPricingPlan('${ plan.plan }')"
                   class="text-blue-600 hover:text-blue-800">
                     <i class="fas fa-edit"></i>
@@ -151,17 +175,83 @@ class PricingManager {
     }
   }
 
+  // 新建付费方案，方案标识创建后不可修改
+  createPricingPlan() {
+    this.showEditPlanModal({
+      plan: "", name: "", brief: "", price: 0, usage: "", period: "1m",
+      features: [], enabled: true, sort: (this.plans || []).length,
+    });
+    document.getElementById("editPlanType").readOnly = false;
+  }
+
+  // 调整方案顺序，direction 为 -1 上移、1 下移
+  async movePricingPlan(key, direction) {
+    const keys = (this.plans || []).map((p) => p.plan);
+    const index = keys.indexOf(key);
+    const target = index + direction;
+    if (index < 0 || target < 0 || target >= keys.length) {
+      return;
+    }
+    [keys[index], keys[target]] = [keys[target], keys[index]];
+
+    try {
+      const resp = await this.app.apiCall("/api/setup/pricing/sort", {
+        method: "POST", body: JSON.stringify({ plans: keys }),
+      });
+      if (resp.error) {
+        this.app.showAlert(resp.error, "error");
+        return;
+      }
+      this.plans = resp.plans || [];
+      this.updatePricingPlansDisplay(this.plans);
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.app.showAlert("排序失败: " + (error.message || "网络错误，请重试"), "error");
+      }
+    }
+  }
+
   // 显示编辑付费方案弹窗
   showEditPlanModal(plan) {
+    this.editingPlan = plan;
     document.getElementById("editPlanType").value = plan.plan;
+    document.getElementById("editPlanType").readOnly = true;
     document.getElementById("editPlanName").value = plan.name;
     document.getElementById("editPlanBrief").value = plan.brief;
     document.getElementById("editPlanPrice").value = plan.price;
     document.getElementById("editPlanUsage").value = plan.usage;
+    document.getElementById("editPlanCurrency").value = plan.currency || "";
     document.getElementById("editPlanPeriod").value = plan.period;
     document.getElementById("editPlanFeatures").value =
       plan.features.join("\n");
     document.getElementById("editPlanEnabled").checked = plan.enabled;
+    document.getElementById("editPlanArchived").checked = !!plan.archived;
+    document.getElementById("editPlanCustomAmount").checked = !!plan.customAmount;
+    document.getElementById("editPlanProducts").value = Object.entries(plan.products || {})
+      .map(([method, p]) => `${method}=${p.productId || ""},${p.subscriptionId || ""}`)
+      .join("\n");
+    const cache = plan.cache || {};
+    document.getElementById("editPlanCacheEnabled").checked = !!cache.enabled;
+    document.getElementById("editPlanCacheTTL").value = cache.ttl || "";
+    document.getElementById("editPlanCacheRate").value = cache.rate || 0;
+    const ent = plan.entitlements || {};
+    this.editingEntitlements = ent;
+    document.getElementById("editPlanDailyTokens").value = ent.dailyTokens || "";
+    document.getElementById("editPlanMonthlyTokens").value = ent.monthlyTokens || "";
+    document.getElementById("editPlanDailyRequests").value = ent.dailyRequests || "";
+    document.getElementById("editPlanMonthlyRequests").value = ent.monthlyRequests || "";
+    document.getElementById("editPlanDailyCost").value = ent.dailyCost || "";
+    document.getElementById("editPlanMonthlyCost").value = ent.monthlyCost || "";
+    document.getElementById("editPlanRPM").value = ent.rpm || "";
+    document.getElementById("editPlanTPM").value = ent.tpm || "";
+    document.getElementById("editPlanConcurrency").value = ent.concurrency || "";
+    document.getElementById("editPlanModels").value = (ent.models || []).join(", ");
+    document.getElementById("editPlanDenyModels").value = (ent.denyModels || []).join(", ");
+    document.getElementById("editPlanMaxContext").value = ent.maxContext || "";
+    document.getElementById("editPlanMaxTokens").value = ent.maxTokens || "";
+    document.getElementById("editPlanFlags").value = Object.keys(ent.flags || {})
+      .map((key) => (ent.flags[key] ? key : "-" + key)).join(", ");
+    document.getElementById("editPlanMultiplier").value = plan.multiplier || "";
     document.getElementById("editPlanModal").classList.remove("hidden");
   }
 
@@ -169,6 +259,54 @@ class PricingManager {
   hideEditPlanModal() {
     document.getElementById("editPlanModal").classList.add("hidden");
     document.getElementById("editPlanForm").reset();
+    this.editingEntitlements = null;
+    this.editingPlan = null;
+  }
+
+  // 读取表单中的套餐权益，保留表单未展示的字段（如项目数上限）
+  collectEntitlements() {
+    const intValue = (id) => parseInt(document.getElementById(id).value) || 0;
+    const floatValue = (id) => parseFloat(document.getElementById(id).value) || 0;
+    const listValue = (id) => document.getElementById(id).value
+      .split(",").map((v) => v.trim()).filter((v) => v);
+
+    const flags = {};
+    // 以 - 开头表示关闭该功能，如 -stream
+    listValue("editPlanFlags").forEach((flag) => {
+      if (flag.startsWith("-")) flags[flag.slice(1)] = false;
+      else flags[flag] = true;
+    });
+    return {
+      ...(this.editingEntitlements || {}),
+      dailyTokens: intValue("editPlanDailyTokens"),
+      monthlyTokens: intValue("editPlanMonthlyTokens"),
+      dailyRequests: intValue("editPlanDailyRequests"),
+      monthlyRequests: intValue("editPlanMonthlyRequests"),
+      dailyCost: floatValue("editPlanDailyCost"),
+      monthlyCost: floatValue("editPlanMonthlyCost"),
+      rpm: intValue("editPlanRPM"),
+      tpm: intValue("editPlanTPM"),
+      concurrency: intValue("editPlanConcurrency"),
+      models: listValue("editPlanModels"),
+      denyModels: listValue("editPlanDenyModels"),
+      maxContext: intValue("editPlanMaxContext"),
+      maxTokens: intValue("editPlanMaxTokens"),
+      flags,
+    };
+  }
+
+  // 读取支付产品配置，每行格式为 支付方式=产品ID,订阅ID
+  collectProducts() {
+    const products = {};
+    document.getElementById("editPlanProducts").value.split("\n").forEach((line) => {
+      const [method, ids] = line.split("=").map((v) => (v || "").trim());
+      if (!method || !ids) {
+        return;
+      }
+      const [productId, subscriptionId] = ids.split(",").map((v) => (v || "").trim());
+      products[method] = { productId, subscriptionId };
+    });
+    return products;
   }
 
   // 保存付费方案
@@ -181,11 +319,23 @@ class PricingManager {
       usage: document.getElementById("editPlanUsage").value,
       period: document.getElementById("editPlanPeriod").value,
       price: parseFloat(document.getElementById("editPlanPrice").value),
+      currency: document.getElementById("editPlanCurrency").value.trim().toUpperCase(),
       features: document
         .getElementById("editPlanFeatures")
         .value.split("\n")
         .filter((f) => f.trim()),
       enabled: document.getElementById("editPlanEnabled").checked,
+      archived: document.getElementById("editPlanArchived").checked,
+      customAmount: document.getElementById("editPlanCustomAmount").checked,
+      sort: this.editingPlan?.sort || 0,
+      products: this.collectProducts(),
+      cache: {
+        enabled: document.getElementById("editPlanCacheEnabled").checked,
+        ttl: parseInt(document.getElementById("editPlanCacheTTL").value) || 0,
+        rate: parseFloat(document.getElementById("editPlanCacheRate").value) || 0,
+      },
+      multiplier: parseFloat(document.getElementById("editPlanMultiplier").value) || 0,
+      entitlements: this.collectEntitlements(),
     };
 
     try {
@@ -209,4 +359,114 @@ class PricingManager {
       }
     }
   }
+
+  // 加载优惠券
+  async loadCoupons() {
+    try {
+      const data = await this.app.apiCall("/api/admin/coupons");
+      this.updateCouponsTable(data.data || []);
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        console.error("Failed to load coupons:", error);
+      }
+    }
+  }
+
+  // 保存优惠券，优惠码已存在时更新
+  async saveCoupon() {
+    const expireAt = document.getElementById("couponExpireAt").value;
+    const coupon = {
+      code: document.getElementById("couponCode").value.trim(),
+      kind: document.getElementById("couponKind").value,
+      value: parseFloat(document.getElementById("couponValue").value) || 0,
+      expireAt: expireAt ? new Date(expireAt).toISOString() : null,
+      maxRedeem: parseInt(document.getElementById("couponMaxRedeem").value) || 0,
+      perUser: parseInt(document.getElementById("couponPerUser").value) || 0,
+      plans: document.getElementById("couponPlans").value
+        .split(",").map((p) => p.trim()).filter((p) => p),
+      enabled: true,
+    };
+    try {
+      const resp = await this.app.apiCall("/api/admin/coupons", {
+        method: "POST", body: JSON.stringify(coupon),
+      });
+      if (resp.error) {
+        this.app.showAlert(resp.error, "error");
+        return;
+      }
+      this.app.showAlert("优惠券保存成功", "success");
+      document.getElementById("couponForm").reset();
+      this.loadCoupons();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.app.showAlert("保存优惠券失败: " + error.message, "error");
+      }
+    }
+  }
+
+  // 启用或停用优惠券
+  async toggleCoupon(id, enabled) {
+    try {
+      const resp = await this.app.apiCall(`/api/admin/coupons/${id}/toggle`, {
+        method: "POST", body: JSON.stringify({ enabled }),
+      });
+      if (resp.error) {
+        this.app.showAlert(resp.error, "error");
+        return;
+      }
+      this.loadCoupons();
+    } catch (error) {
+      if (error.message !== "Unauthorized") {
+        this.app.showAlert("更新优惠券失败: " + error.message, "error");
+      }
+    }
+  }
+
+  // 更新优惠券列表
+  updateCouponsTable(coupons) {
+    const tableDiv = document.getElementById("couponsTable");
+    if (coupons.length === 0) {
+      tableDiv.innerHTML =
+        '<p class="text-gray-500 text-center">暂无优惠券</p>';
+      return;
+    }
+
+    const th = "px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider";
+    const td = "px-6 py-4 whitespace-nowrap text-sm text-gray-900";
+    tableDiv.innerHTML = `
+      <div class="overflow-x-auto">
+        <table class="min-w-full divide-y divide-gray-200">
+          <thead class="bg-gray-50">
+            <tr>
+              <th class="${th}">优惠码</th>
+              <th class="${th}">折扣</th>
+              <th class="${th}">适用套餐</th>
+              <th class="${th}">已兑换</th>
+              <th class="${th}">每人</th>
+              <th class="${th}">过期时间</th>
+              <th class="${th}">操作</th>
+            </tr>
+          </thead>
+          <tbody class="bg-white divide-y divide-gray-200">
+            ${coupons.map((coupon) => `
+              <tr>
+                <td class="${td} font-mono">${this.app.escapeHtml(coupon.code)}</td>
+                <td class="${td}">${coupon.kind === "percent" ? `${coupon.value}%` : `¥${coupon.value}`}</td>
+                <td class="${td}">${this.app.escapeHtml((coupon.plans || []).join(", ") || "全部")}</td>
+                <td class="${td}">${coupon.redeemed} / ${coupon.maxRedeem || "不限"}</td>
+                <td class="${td}">${coupon.perUser || "不限"}</td>
+                <td class="${td}">${coupon.expireAt ? new Date(coupon.expireAt).toLocaleString() : "永不过期"}</td>
+                <td class="${td}">
+                  <button onclick="app.pricingManager.toggleCoupon(${coupon.id}, ${!coupon.enabled})"
+                    class="${coupon.enabled ? "text-red-600 hover:text-red-800" : "text-green-600 hover:text-green-800"}">
+                    ${coupon.enabled ? "停用" : "启用"}
+                  </button>
+                </td>
+              </tr>
+            `).join("")}
+          </tbody>
+        </table>
+      </div>
+    `;
+  }
 }
\ No newline at end of file
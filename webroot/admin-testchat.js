@@ -25,10 +25,13 @@ class TestChatManager {
     }
   }
 
-  // 加载模型列表
+  // 加载当前 API Key 可调用的模型列表
   async loadModels() {
     try {
-      const data = await this.app.apiCall("/api/admin/models");
+      const apiKey = localStorage.getItem("apiKey");
+      const data = await this.app.apiCall("/v1/models", {
+        headers: { Authorization: `Bearer ${apiKey}` },
+      });
       this.updateModelSelect(data.data || []);
     } catch (error) {
       if (error.message !== "Unauthorized") {
@@ -118,6 +121,10 @@ class TestChatManager {
           }),
         });
 
+        if (data.error) {
+          this.showChatError(data.error);
+          return;
+        }
         const duration = Date.now() - startTime;
         this.showChatResponse(data, duration);
       }
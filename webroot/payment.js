@@ -3,8 +3,8 @@
 class PaymentManager {
   constructor() {
     this.plans = []
-    this.keyOfUsage = 'usage'
     this.selectedPlan = null;
+    this.quote = null;
     this.selectedPaymentMethod = null;
     this.customAmount = 0;
     this.currentOrderId = null;
@@ -125,11 +125,11 @@ class PaymentManager {
                     <div class="ml-4 text-right">
                         <div class="text-2xl font-bold text-blue-600">
                             ${
-                              plan.plan === this.keyOfUsage
+                              plan.customAmount
                                 ? "自定义金额" : `¥${plan.price}`
                             }
                         </div>
-                        ${ plan.plan !== this.keyOfUsage
+                        ${ !plan.customAmount
                             ? '<div class="text-sm text-gray-500">/月</div>'
                             : ""
                         }
@@ -210,7 +210,7 @@ class PaymentManager {
     planCard.classList.add("selected");
 
     this.selectedPlan = plan;
-    if (plan.plan === this.keyOfUsage) {
+    if (plan.customAmount) {
       // 获取基础版卡片内的金额输入框的值
       const basicAmountInput = document.querySelector("#basicAmount");
       basicAmountInput.value = plan.price;
@@ -219,7 +219,25 @@ class PaymentManager {
       this.customAmount = plan.price;
     }
 
+    this.quote = null;
     this.updateOrderSummary();
+    this.updateAutoRenew();
+    this.loadQuote(plan);
+  }
+
+  async loadQuote(plan) {
+    // 已有套餐时获取升级抵扣或降级生效时间
+    try {
+      const data = await Utils.apiRequest("/api/order/quote", {
+        body: JSON.stringify({ payPlan: plan.plan }),
+      });
+      if (data && data.action && this.selectedPlan === plan) {
+        this.quote = data;
+        this.updateOrderSummary();
+      }
+    } catch (error) {
+      console.error("获取套餐报价错误:", error);
+    }
   }
 
   selectPaymentMethod(method) {
@@ -235,9 +253,24 @@ class PaymentManager {
     methodCard.classList.add("selected");
 
     this.selectedPaymentMethod = method;
+    this.updateAutoRenew();
     this.updatePayButton();
   }
 
+  updateAutoRenew() {
+    // 仅 Stripe、Creem 支持订阅，自定义金额套餐不支持自动续费
+    const container = document.getElementById("autoRenewContainer");
+    const supported =
+      this.selectedPaymentMethod &&
+      ["stripe", "creem"].includes(this.selectedPaymentMethod.method) &&
+      this.selectedPlan &&
+      !this.selectedPlan.customAmount;
+    container.classList.toggle("hidden", !supported);
+    if (!supported) {
+      document.getElementById("autoRenew").checked = false;
+    }
+  }
+
   updateOrderSummary() {
     const selectedPlanName = document.getElementById("selectedPlanName");
     const selectedAmount = document.getElementById("selectedAmount");
@@ -249,8 +282,8 @@ class PaymentManager {
     if (this.selectedPlan) {
       selectedPlanName.textContent = this.selectedPlan.name;
 
-      if (this.selectedPlan.plan === this.keyOfUsage) {
-        // usage方案：显示输入框，隐藏固定金额
+      if (this.selectedPlan.customAmount) {
+        // 自定义金额套餐：显示输入框，隐藏固定金额
         selectedAmount.classList.add("hidden");
         basicAmountContainer.classList.remove("hidden");
         totalAmount.textContent = `¥${this.customAmount}`;
@@ -261,22 +294,48 @@ class PaymentManager {
         selectedAmount.textContent = `¥${this.selectedPlan.price}`;
         totalAmount.textContent = `¥${this.selectedPlan.price}`;
       }
+      this.updateQuote();
     } else {
       selectedPlanName.textContent = "请选择套餐";
       selectedAmount.classList.remove("hidden");
       basicAmountContainer.classList.add("hidden");
       selectedAmount.textContent = "¥0";
       totalAmount.textContent = "¥0";
+      this.updateQuote();
     }
 
     this.updatePayButton();
   }
 
+  updateQuote() {
+    const creditRow = document.getElementById("creditRow");
+    const quoteNotice = document.getElementById("quoteNotice");
+    const quote = this.quote;
+    creditRow.classList.add("hidden");
+    quoteNotice.classList.add("hidden");
+    if (!quote) return;
+
+    const date = (value) => new Date(value).toLocaleDateString();
+    if (quote.action === "upgrade") {
+      creditRow.classList.remove("hidden");
+      document.getElementById("creditAmount").textContent = `-¥${quote.credit}`;
+      document.getElementById("totalAmount").textContent = `¥${quote.amount}`;
+      quoteNotice.textContent = `升级立即生效，有效期至 ${date(quote.expireAt)}`;
+    } else if (quote.action === "downgrade") {
+      quoteNotice.textContent = `当前套餐到期后于 ${date(quote.effectiveAt)} 切换，有效期至 ${date(quote.expireAt)}`;
+    } else if (quote.action === "renew") {
+      quoteNotice.textContent = `续费后有效期顺延至 ${date(quote.expireAt)}`;
+    } else {
+      return;
+    }
+    quoteNotice.classList.remove("hidden");
+  }
+
   updatePayButton() {
     const payBtn = document.getElementById("payBtn");
     if (!payBtn) return;
     
-    const hasNum = (!this.selectedPlan || this.selectedPlan.plan !== this.keyOfUsage || this.customAmount > 0)
+    const hasNum = (!this.selectedPlan || !this.selectedPlan.customAmount || this.customAmount > 0)
     const canPay = this.selectedPlan && this.selectedPaymentMethod && hasNum;
 
     payBtn.disabled = !canPay;
@@ -290,7 +349,7 @@ class PaymentManager {
   }
 
   bindEvents() {
-    // usage方案的金额输入框
+    // 自定义金额套餐的金额输入框
     const basicAmountInput = document.getElementById("basicAmount");
     basicAmountInput.addEventListener("input", (e) => {
       this.customAmount = parseFloat(e.target.value) || 0;
@@ -325,8 +384,8 @@ class PaymentManager {
       return;
     }
 
-    if (this.selectedPlan.plan === this.keyOfUsage && this.customAmount < 10) {
-      alert("充值金额不能少于10元");
+    if (this.selectedPlan.customAmount && this.customAmount < this.selectedPlan.price) {
+      alert(`金额不能少于${this.selectedPlan.price}元`);
       return;
     }
 
@@ -340,9 +399,16 @@ class PaymentManager {
         method: this.selectedPaymentMethod.method,
       };
 
-      if (this.selectedPlan.plan === this.keyOfUsage) {
+      if (this.selectedPlan.customAmount) {
         paymentData.amount = this.customAmount;
       }
+      if (document.getElementById("autoRenew").checked) {
+        paymentData.kind = "subscribe";
+      }
+      const couponCode = document.getElementById("couponCode").value.trim();
+      if (couponCode) {
+        paymentData.couponCode = couponCode;
+      }
 
       const url = "/api/order/create";
       const data = await Utils.apiRequest(url, {
@@ -350,7 +416,11 @@ class PaymentManager {
       });
 
       if (data && data.orderId) {
-        if (!data.qrcode && data.payUrl) {
+        if (data.status === "succeed") {
+          // 优惠码全额抵扣，无需支付
+          this.currentOrderId = data.orderId;
+          this.showPaymentSuccess();
+        } else if (!data.qrcode && data.payUrl) {
           window.open(data.payUrl, '_blank');
           this.currentOrderId = data.orderId;
           this.showPaymentRedirect();
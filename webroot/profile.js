@@ -4,6 +4,7 @@ const ProfileApp = {
   currentTab: "usage",
   usage: {}, limit: {},
   user: null, apiKey: null,
+  plans: [],
 };
 
 // 数据管理
@@ -70,6 +71,7 @@ const DataManager = {
     }
     try {
       const data = await Utils.apiRequest(`/api/pricing-plans`);
+      ProfileApp.plans = data.plans || [];
       this.updateBillingUI(upgradeOptions, data.plans);
     } catch (error) {
       Utils.showNotification(error.message, "error");
@@ -209,7 +211,7 @@ const DataManager = {
     document.getElementById("totalTokens").textContent = Utils.formatNumber(
       usage.totalTokens || 0
     );
-    const planName = this.getPlanName(ProfileApp.user?.userPlan || 'basic');
+    const planName = this.getPlanName(ProfileApp.user?.userPlan);
     document.getElementById("currentPlan").textContent = planName;
 
     // 更新进度条（这里需要实际的当日/当月使用数据）
@@ -245,13 +247,22 @@ const DataManager = {
       }
     }
 
-    document.getElementById("dailyUsage").textContent = `${dailyUsed} / ${Utils.formatNumber(dailyLimit)}`;
-    document.getElementById("monthlyUsage").textContent = `${Utils.formatNumber(totalUsed)} / ${Utils.formatNumber(totalLimit)}`;
+    // 上限为 0 表示不限制
+    const formatLimit = (value) => (value ? Utils.formatNumber(value) : "不限");
+    document.getElementById("dailyUsage").textContent = `${dailyUsed} / ${formatLimit(dailyLimit)}`;
+    document.getElementById("monthlyUsage").textContent = `${Utils.formatNumber(totalUsed)} / ${formatLimit(totalLimit)}`;
 
-    const dailyPercent = (dailyUsed / dailyLimit) * 100;
-    const totalPercent = (totalUsed / totalLimit) * 100;
+    const dailyPercent = dailyLimit ? (dailyUsed / dailyLimit) * 100 : 0;
+    const totalPercent = totalLimit ? (totalUsed / totalLimit) * 100 : 0;
     document.getElementById("dailyProgress").style.width = `${Math.min(dailyPercent, 100)}%`;
     document.getElementById("monthlyProgress").style.width = `${Math.min(totalPercent, 100)}%`;
+
+    // 周期用量按购买日起每月重置
+    const cycleReset = document.getElementById("cycleReset");
+    if (usage.cycleEnd) {
+      cycleReset.textContent = `将于 ${new Date(usage.cycleEnd).toLocaleString()} 重置`;
+      cycleReset.classList.remove("hidden");
+    }
   },
 
   // 更新API密钥UI
@@ -333,7 +344,9 @@ const DataManager = {
       succeed: "bg-green-100 text-green-800",
       failed: "bg-red-100 text-red-800",
       refunded: "bg-red-100 text-gray-800",
+      partially_refunded: "bg-red-100 text-gray-800",
       canceled: "bg-gray-100 text-gray-800",
+      expired: "bg-gray-100 text-gray-800",
     };
     return statusClasses[status] || "bg-gray-100 text-gray-800";
   },
@@ -345,7 +358,9 @@ const DataManager = {
       succeed: "已支付",
       failed: "支付失败",
       canceled: "已取消",
+      expired: "已过期",
       refunded: "已退款",
+      partially_refunded: "部分退款",
     };
     return statusTexts[status] || status;
   },
@@ -382,13 +397,8 @@ const DataManager = {
 
   // 获取套餐显示名称
   getPlanName(plan) {
-    const planNames = {
-      basic: "基础版",
-      extra: "基础版",
-      ultra: "专业版",
-      super: "企业版",
-    };
-    return planNames[plan] || plan;
+    const found = ProfileApp.plans.find((p) => p.plan === plan);
+    return found?.name || plan;
   },
 };
 